@@ -0,0 +1,128 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+const AccessPolicyFilename = "forge_access_policy.json"
+
+// access policy modes, open is the default when there's no policy file so existing installs keep working
+const accessModeOpen = "open"
+const accessModeLeadOnly = "lead_only"
+const accessModeAllowlist = "allowlist"
+const accessModeDenySpectators = "deny_spectators"
+
+var operatorAccessDeniedError = errors.New("operator isn't allowed to make this change")
+
+// accessPolicy controls who can run forge's management actions (forge_support, forge_create, and
+// forge_register -remove/-global). Mythic doesn't send an operator's role with tasking, so roles are listed by username.
+// When RequireToolApproval is set, new or updated tools are quarantined until someone in Approvers (or anyone allowed
+// to make management changes if there aren't any approvers) approves them.
+type accessPolicy struct {
+	Mode                string   `json:"mode"`
+	Leads               []string `json:"leads"`
+	AllowedOperators    []string `json:"allowed_operators"`
+	Spectators          []string `json:"spectators"`
+	RequireToolApproval bool     `json:"require_tool_approval"`
+	Approvers           []string `json:"approvers"`
+}
+
+func getAccessPolicy() (accessPolicy, error) {
+	policy := accessPolicy{Mode: accessModeOpen}
+	policyBytes, err := os.ReadFile(AccessPolicyFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, err
+	}
+	if err = json.Unmarshal(policyBytes, &policy); err != nil {
+		return policy, fmt.Errorf("failed to parse %s: %w", AccessPolicyFilename, err)
+	}
+	if policy.Mode == "" {
+		policy.Mode = accessModeOpen
+	}
+	switch policy.Mode {
+	case accessModeOpen, accessModeLeadOnly, accessModeAllowlist, accessModeDenySpectators:
+		return policy, nil
+	default:
+		return policy, fmt.Errorf("unknown mode %q in %s", policy.Mode, AccessPolicyFilename)
+	}
+}
+
+// allows reports if an operator can make management changes. Leads are always allowed unless listed as spectators.
+func (p accessPolicy) allows(username string) bool {
+	if slices.Contains(p.Spectators, username) {
+		return false
+	}
+	switch p.Mode {
+	case accessModeLeadOnly:
+		return slices.Contains(p.Leads, username)
+	case accessModeAllowlist:
+		return slices.Contains(p.Leads, username) || slices.Contains(p.AllowedOperators, username)
+	default:
+		return true
+	}
+}
+
+// checkOperatorAccess fails a management task when the operator that issued it isn't allowed by the access policy.
+// A policy file that can't be read or parsed denies everything rather than falling back to open.
+func checkOperatorAccess(action string, taskData *agentstructs.PTTaskMessageAllData) error {
+	username := taskData.Task.OperatorUsername
+	policy, err := getAccessPolicy()
+	if err != nil {
+		logging.LogError(err, "failed to load access policy")
+		err = fmt.Errorf("%w: %s", operatorAccessDeniedError, err.Error())
+	} else if !policy.allows(username) {
+		err = fmt.Errorf("%w: %s can't %s under the %s access policy", operatorAccessDeniedError, username, action, policy.Mode)
+	}
+	if err != nil {
+		sendForgeEventLog(taskData, fmt.Sprintf("%s denied %s to %s: %s", PayloadTypeName, username, action, err.Error()), true)
+	}
+	return err
+}
+
+// checkToolApprover is checkOperatorAccess with the additional approvers list for approving or rejecting tools
+func checkToolApprover(action string, taskData *agentstructs.PTTaskMessageAllData) error {
+	if err := checkOperatorAccess(action, taskData); err != nil {
+		return err
+	}
+	policy, _ := getAccessPolicy()
+	if len(policy.Approvers) == 0 || slices.Contains(policy.Approvers, taskData.Task.OperatorUsername) {
+		return nil
+	}
+	err := fmt.Errorf("%w: %s isn't one of the approvers", operatorAccessDeniedError, taskData.Task.OperatorUsername)
+	sendForgeEventLog(taskData, fmt.Sprintf("%s denied %s to %s: %s", PayloadTypeName, taskData.Task.OperatorUsername, action, err.Error()), true)
+	return err
+}
+
+// recordForgeChange writes a permitted management change to the operation's event log and the container's log
+func recordForgeChange(taskData *agentstructs.PTTaskMessageAllData, change string) {
+	logging.LogInfo("forge change", "operator", taskData.Task.OperatorUsername, "operation", taskData.Callback.OperationID,
+		"task", taskData.Task.ID, "change", change)
+	sendForgeEventLog(taskData, fmt.Sprintf("%s %s (%s)", taskData.Task.OperatorUsername, change, PayloadTypeName), false)
+}
+
+func sendForgeEventLog(taskData *agentstructs.PTTaskMessageAllData, message string, warning bool) {
+	eventResp, err := mythicrpc.SendMythicRPCOperationEventLogCreate(mythicrpc.MythicRPCOperationEventLogCreateMessage{
+		TaskID:       &taskData.Task.ID,
+		Message:      message,
+		Warning:      warning,
+		MessageLevel: mythicrpc.MESSAGE_LEVEL_INFO,
+	})
+	if err != nil {
+		logging.LogError(err, "failed to send event log message")
+		return
+	}
+	if !eventResp.Success {
+		logging.LogError(errors.New(eventResp.Error), "failed to create event log message")
+	}
+}
@@ -0,0 +1,44 @@
+package agentfunctions
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAccessPolicyModes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	policy, err := getAccessPolicy()
+	if err != nil || policy.Mode != accessModeOpen || !policy.allows("anyone") {
+		t.Fatalf("expected a missing policy file to allow everyone, got %+v %v", policy, err)
+	}
+	for _, test := range []struct {
+		policy   accessPolicy
+		username string
+		allowed  bool
+	}{
+		{accessPolicy{Mode: accessModeLeadOnly, Leads: []string{"lead"}}, "lead", true},
+		{accessPolicy{Mode: accessModeLeadOnly, Leads: []string{"lead"}}, "operator", false},
+		{accessPolicy{Mode: accessModeAllowlist, Leads: []string{"lead"}, AllowedOperators: []string{"operator"}}, "operator", true},
+		{accessPolicy{Mode: accessModeAllowlist, Leads: []string{"lead"}, AllowedOperators: []string{"operator"}}, "lead", true},
+		{accessPolicy{Mode: accessModeAllowlist, AllowedOperators: []string{"operator"}}, "other", false},
+		{accessPolicy{Mode: accessModeDenySpectators, Spectators: []string{"viewer"}}, "viewer", false},
+		{accessPolicy{Mode: accessModeDenySpectators, Spectators: []string{"viewer"}}, "operator", true},
+		{accessPolicy{Mode: accessModeLeadOnly, Leads: []string{"lead"}, Spectators: []string{"lead"}}, "lead", false},
+	} {
+		if allowed := test.policy.allows(test.username); allowed != test.allowed {
+			t.Errorf("%s policy for %s: expected allowed=%v, got %v", test.policy.Mode, test.username, test.allowed, allowed)
+		}
+	}
+}
+
+func TestAccessPolicyRejectsUnknownModes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeJSONFile(t, AccessPolicyFilename, accessPolicy{Mode: "leads"})
+	if _, err := getAccessPolicy(); err == nil {
+		t.Fatalf("expected an unknown mode to be an error")
+	}
+	os.WriteFile(AccessPolicyFilename, []byte("{"), 0644)
+	if _, err := getAccessPolicy(); err == nil {
+		t.Fatalf("expected invalid json to be an error")
+	}
+}
@@ -0,0 +1,527 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+var cnaInterpolation = regexp.MustCompile(`\$[A-Za-z0-9_-]+`)
+
+var noAggressorCommandsError = errors.New("no bof commands could be translated from the aggressor scripts")
+
+// bofPackTypes maps bof_pack format characters to extension.json argument types
+var bofPackTypes = map[rune]string{
+	'z': "string",
+	'Z': "wstring",
+	'i': "int",
+	's': "short",
+	'b': "file",
+}
+
+const (
+	cnaTokenString   = 's'
+	cnaTokenVariable = 'v'
+	cnaTokenIdent    = 'i'
+	cnaTokenNumber   = 'n'
+	cnaTokenPunct    = 'p'
+)
+
+type cnaToken struct {
+	kind byte
+	text string
+	// interpolated is set for double quoted strings that reference a variable
+	interpolated bool
+	line         int
+}
+
+func isCnaIdentRune(r rune) bool {
+	return r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// tokenizeAggressorScript splits a Sleep script into the tokens needed to find aliases and the calls inside them,
+// comments are dropped
+func tokenizeAggressorScript(script string) ([]cnaToken, error) {
+	tokens := []cnaToken{}
+	runes := []rune(script)
+	line := 1
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+		case r == ' ' || r == '\t' || r == '\r':
+		case r == '#':
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '"' || r == '\'':
+			startLine := line
+			value := strings.Builder{}
+			interpolated := false
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == r {
+					closed = true
+					break
+				}
+				if runes[i] == '\n' {
+					line++
+				}
+				if runes[i] == '\\' && r == '"' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						value.WriteRune('\n')
+					case 't':
+						value.WriteRune('\t')
+					default:
+						value.WriteRune(runes[i])
+					}
+					continue
+				}
+				if runes[i] == '$' && r == '"' && i+1 < len(runes) && isCnaIdentRune(runes[i+1]) {
+					interpolated = true
+				}
+				value.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("line %d: unterminated string", startLine)
+			}
+			tokens = append(tokens, cnaToken{kind: cnaTokenString, text: value.String(), interpolated: interpolated, line: startLine})
+		case (r == '$' || r == '@' || r == '%') && i+1 < len(runes) && isCnaIdentRune(runes[i+1]):
+			start := i
+			for i+1 < len(runes) && isCnaIdentRune(runes[i+1]) {
+				i++
+			}
+			tokens = append(tokens, cnaToken{kind: cnaTokenVariable, text: string(runes[start : i+1]), line: line})
+		case r >= '0' && r <= '9':
+			start := i
+			for i+1 < len(runes) && (isCnaIdentRune(runes[i+1]) || runes[i+1] == '.') {
+				i++
+			}
+			tokens = append(tokens, cnaToken{kind: cnaTokenNumber, text: string(runes[start : i+1]), line: line})
+		case isCnaIdentRune(r):
+			start := i
+			for i+1 < len(runes) && isCnaIdentRune(runes[i+1]) {
+				i++
+			}
+			tokens = append(tokens, cnaToken{kind: cnaTokenIdent, text: string(runes[start : i+1]), line: line})
+		default:
+			tokens = append(tokens, cnaToken{kind: cnaTokenPunct, text: string(r), line: line})
+		}
+	}
+	return tokens, nil
+}
+
+// matchingCnaToken returns the index of the bracket that closes the one at start, or -1
+func matchingCnaToken(tokens []cnaToken, start int) int {
+	open := tokens[start].text
+	closeText := map[string]string{"(": ")", "{": "}", "[": "]"}[open]
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		if tokens[i].kind != cnaTokenPunct {
+			continue
+		}
+		if tokens[i].text == open {
+			depth++
+		} else if tokens[i].text == closeText {
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// cnaCall is a function call found in a script, with each argument's tokens
+type cnaCall struct {
+	name string
+	args [][]cnaToken
+	line int
+}
+
+// findCnaCalls returns every call to one of names in tokens, in order
+func findCnaCalls(tokens []cnaToken, names ...string) []cnaCall {
+	calls := []cnaCall{}
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].kind != cnaTokenIdent || !slices.Contains(names, tokens[i].text) || tokens[i+1].text != "(" {
+			continue
+		}
+		end := matchingCnaToken(tokens, i+1)
+		if end < 0 {
+			continue
+		}
+		call := cnaCall{name: tokens[i].text, line: tokens[i].line}
+		argument := []cnaToken{}
+		depth := 0
+		for _, token := range tokens[i+2 : end] {
+			if token.kind == cnaTokenPunct {
+				switch token.text {
+				case "(", "{", "[":
+					depth++
+				case ")", "}", "]":
+					depth--
+				case ",":
+					if depth == 0 {
+						call.args = append(call.args, argument)
+						argument = []cnaToken{}
+						continue
+					}
+				}
+			}
+			argument = append(argument, token)
+		}
+		if len(argument) > 0 || len(call.args) > 0 {
+			call.args = append(call.args, argument)
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// cnaStringValue evaluates an argument made of string literals joined with the . operator
+func cnaStringValue(argument []cnaToken) (string, bool) {
+	if len(argument) == 0 {
+		return "", false
+	}
+	value := strings.Builder{}
+	for i, token := range argument {
+		if i%2 == 1 {
+			if token.kind != cnaTokenPunct || token.text != "." {
+				return "", false
+			}
+			continue
+		}
+		if token.kind != cnaTokenString || token.interpolated {
+			return "", false
+		}
+		value.WriteString(token.text)
+	}
+	return value.String(), len(argument)%2 == 1
+}
+
+func cnaTokensText(argument []cnaToken) string {
+	text := make([]string, len(argument))
+	for i, token := range argument {
+		if token.kind == cnaTokenString {
+			text[i] = strconv.Quote(token.text)
+		} else {
+			text[i] = token.text
+		}
+	}
+	return strings.Join(text, " ")
+}
+
+// cnaObjectPattern turns the argument of script_resource into a glob for the object file's name, anything that isn't
+// a string literal (ex: $barch) becomes a wildcard
+func cnaObjectPattern(argument []cnaToken) string {
+	pattern := strings.Builder{}
+	for _, token := range argument {
+		switch token.kind {
+		case cnaTokenString:
+			text := token.text
+			if token.interpolated {
+				text = cnaInterpolation.ReplaceAllString(text, "*")
+			}
+			pattern.WriteString(text)
+		case cnaTokenPunct:
+			// concatenation operators
+		default:
+			pattern.WriteString("*")
+		}
+	}
+	return path.Base(strings.ReplaceAll(pattern.String(), "\\", "/"))
+}
+
+// cnaLiteralDefaults finds variables in an alias that are assigned a literal (ex: $count = 0;), they're treated as
+// optional arguments with that default since the script fills them in when they aren't given
+func cnaLiteralDefaults(body []cnaToken) map[string]interface{} {
+	defaults := make(map[string]interface{})
+	for i := 0; i+3 < len(body); i++ {
+		if body[i].kind != cnaTokenVariable || body[i+1].text != "=" || body[i+3].text != ";" {
+			continue
+		}
+		name := strings.TrimPrefix(body[i].text, "$")
+		if _, ok := defaults[name]; ok {
+			continue
+		}
+		switch body[i+2].kind {
+		case cnaTokenString:
+			if !body[i+2].interpolated {
+				defaults[name] = body[i+2].text
+			}
+		case cnaTokenNumber:
+			if number, err := strconv.ParseInt(body[i+2].text, 0, 64); err == nil {
+				defaults[name] = float64(number)
+			}
+		}
+	}
+	return defaults
+}
+
+// translateBofPack turns the arguments of a bof_pack call into extension.json arguments
+func translateBofPack(call cnaCall, defaults map[string]interface{}) ([]bofCommandDefinitionArguments, error) {
+	if len(call.args) < 2 {
+		return nil, errors.New("bof_pack needs a beacon id and a format string")
+	}
+	format, ok := cnaStringValue(call.args[1])
+	if !ok {
+		return nil, fmt.Errorf("bof_pack format %s isn't a string literal", cnaTokensText(call.args[1]))
+	}
+	values := call.args[2:]
+	if len([]rune(format)) != len(values) {
+		return nil, fmt.Errorf("bof_pack format %q has %d values but %d were given", format, len([]rune(format)), len(values))
+	}
+	arguments := []bofCommandDefinitionArguments{}
+	for i, packType := range []rune(format) {
+		argType, ok := bofPackTypes[packType]
+		if !ok {
+			return nil, fmt.Errorf("bof_pack format character %q isn't supported", packType)
+		}
+		value := values[i]
+		if len(value) != 1 || value[0].kind != cnaTokenVariable || !strings.HasPrefix(value[0].text, "$") {
+			return nil, fmt.Errorf("bof_pack value %s can't be mapped to a command argument", cnaTokensText(value))
+		}
+		name := strings.TrimPrefix(value[0].text, "$")
+		if position, err := strconv.Atoi(name); err == nil {
+			if position < 2 {
+				return nil, fmt.Errorf("bof_pack value %s is the beacon id, not a command argument", value[0].text)
+			}
+			name = fmt.Sprintf("arg%d", position-1)
+		}
+		argument := bofCommandDefinitionArguments{Name: name, Type: argType}
+		for suffix := 2; slices.ContainsFunc(arguments, func(a bofCommandDefinitionArguments) bool { return a.Name == argument.Name }); suffix++ {
+			argument.Name = fmt.Sprintf("%s%d", name, suffix)
+		}
+		if defaultValue, ok := defaults[name]; ok && argType != "file" {
+			argument.Optional = true
+			argument.Default = defaultValue
+		}
+		arguments = append(arguments, argument)
+	}
+	return arguments, nil
+}
+
+// translateAggressorAlias builds an extension.json command for a single alias, warnings are for things that were
+// translated but might not behave the same as in Cobalt Strike
+func translateAggressorAlias(name string, body []cnaToken, objectFiles []string) (*bofCommandDefinition, []string, error) {
+	warnings := []string{}
+	executeCalls := findCnaCalls(body, "beacon_inline_execute")
+	if len(executeCalls) == 0 {
+		return nil, nil, errors.New("doesn't call beacon_inline_execute, so it isn't a bof")
+	}
+	commandDefinition := &bofCommandDefinition{CommandName: name, Entrypoint: "go"}
+	if len(executeCalls[0].args) >= 3 {
+		if entrypoint, ok := cnaStringValue(executeCalls[0].args[2]); ok {
+			commandDefinition.Entrypoint = entrypoint
+		} else {
+			warnings = append(warnings, fmt.Sprintf("entrypoint %s isn't a string literal, using go", cnaTokensText(executeCalls[0].args[2])))
+		}
+	}
+	packCalls := findCnaCalls(body, "bof_pack")
+	if len(packCalls) > 1 {
+		warnings = append(warnings, fmt.Sprintf("has %d bof_pack calls, only the one on line %d is used", len(packCalls), packCalls[0].line))
+	}
+	if len(packCalls) > 0 {
+		arguments, err := translateBofPack(packCalls[0], cnaLiteralDefaults(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		commandDefinition.Arguments = arguments
+	}
+	patterns := []string{}
+	for _, call := range findCnaCalls(body, "script_resource") {
+		if len(call.args) > 0 {
+			patterns = append(patterns, cnaObjectPattern(call.args[0]))
+		}
+	}
+	for _, call := range findCnaCalls(body, "readbof") {
+		// TrustedSec's helper: readbof($1, "name", ...) reads name.<arch>.o
+		if len(call.args) > 1 {
+			if objectName, ok := cnaStringValue(call.args[1]); ok {
+				patterns = append(patterns, objectName+".*o")
+			}
+		}
+	}
+	patterns = append(patterns, name+".*o")
+	for _, pattern := range patterns {
+		for _, objectFile := range objectFiles {
+			if matched, err := path.Match(pattern, objectFile); err != nil || !matched || !strings.HasSuffix(objectFile, ".o") {
+				continue
+			}
+			arch := objectFileArch(objectFile)
+			if slices.ContainsFunc(commandDefinition.Files, func(f bofCommandDefinitionFiles) bool { return f.Arch == arch }) {
+				continue
+			}
+			commandDefinition.Files = append(commandDefinition.Files, bofCommandDefinitionFiles{OS: "windows", Arch: arch, Path: objectFile})
+		}
+		if len(commandDefinition.Files) > 0 {
+			break
+		}
+	}
+	if len(commandDefinition.Files) == 0 {
+		return nil, nil, fmt.Errorf("none of the uploaded object files match %s", strings.Join(patterns, ", "))
+	}
+	return commandDefinition, warnings, nil
+}
+
+// translateAggressorScripts generates an extension.json package from the aliases and beacon_command_register calls in
+// Cobalt Strike aggressor scripts. Anything that can't be translated is returned as a report line instead of failing
+// the whole import.
+func translateAggressorScripts(packageName string, scripts map[string]string, objectFiles []string) (bofCommandDefinition, []string, error) {
+	packageDefinition := bofCommandDefinition{Name: packageName, PackageName: packageName, Entrypoint: "go"}
+	report := []string{}
+	scriptNames := make([]string, 0, len(scripts))
+	for scriptName := range scripts {
+		scriptNames = append(scriptNames, scriptName)
+	}
+	slices.Sort(scriptNames)
+	for _, scriptName := range scriptNames {
+		tokens, err := tokenizeAggressorScript(scripts[scriptName])
+		if err != nil {
+			report = append(report, fmt.Sprintf("[!] %s: %s", scriptName, err.Error()))
+			continue
+		}
+		helpText := make(map[string][2]string)
+		for _, call := range findCnaCalls(tokens, "beacon_command_register") {
+			if len(call.args) == 0 {
+				continue
+			}
+			commandName, ok := cnaStringValue(call.args[0])
+			if !ok {
+				report = append(report, fmt.Sprintf("[!] %s line %d: beacon_command_register name %s isn't a string literal",
+					scriptName, call.line, cnaTokensText(call.args[0])))
+				continue
+			}
+			help := [2]string{}
+			for i := 1; i < len(call.args) && i < 3; i++ {
+				if text, ok := cnaStringValue(call.args[i]); ok {
+					help[i-1] = text
+				}
+			}
+			helpText[commandName] = help
+		}
+		for i := 0; i+2 < len(tokens); i++ {
+			if tokens[i].kind != cnaTokenIdent || tokens[i].text != "alias" {
+				continue
+			}
+			name := tokens[i+1].text
+			if (tokens[i+1].kind != cnaTokenIdent && tokens[i+1].kind != cnaTokenString) || tokens[i+2].text != "{" {
+				continue
+			}
+			end := matchingCnaToken(tokens, i+2)
+			if end < 0 {
+				report = append(report, fmt.Sprintf("[!] %s line %d: alias %s is missing its closing brace", scriptName, tokens[i].line, name))
+				break
+			}
+			commandDefinition, warnings, err := translateAggressorAlias(name, tokens[i+3:end], objectFiles)
+			i = end
+			if err != nil {
+				report = append(report, fmt.Sprintf("[!] %s: skipped %s: %s", scriptName, name, err.Error()))
+				continue
+			}
+			if slices.ContainsFunc(packageDefinition.Commands, func(c *bofCommandDefinition) bool { return c.CommandName == name }) {
+				report = append(report, fmt.Sprintf("[!] %s: skipped %s: it's already defined by another script", scriptName, name))
+				continue
+			}
+			if help, ok := helpText[name]; ok {
+				commandDefinition.Help = help[0]
+				commandDefinition.LongHelp = help[1]
+			} else {
+				warnings = append(warnings, "isn't registered with beacon_command_register, so it has no help text")
+			}
+			for _, warning := range warnings {
+				report = append(report, fmt.Sprintf("[!] %s: %s %s", scriptName, name, warning))
+			}
+			packageDefinition.Commands = append(packageDefinition.Commands, commandDefinition)
+		}
+	}
+	if len(packageDefinition.Commands) == 0 {
+		return packageDefinition, report, noAggressorCommandsError
+	}
+	return packageDefinition, report, nil
+}
+
+// importAggressorScripts translates uploaded .cna files into an extension.json for the uploaded object files and
+// registers it with Mythic, returning its file id so the rest of forge_create can treat it like an uploaded one
+func importAggressorScripts(taskData *agentstructs.PTTaskMessageAllData, packageName string, objectFileIDs []string, scriptFileIDs []string) (string, error) {
+	objectFiles := []string{}
+	for _, objectFileID := range objectFileIDs {
+		searchResp, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
+			TaskID:      taskData.Task.ID,
+			AgentFileID: objectFileID,
+		})
+		if err != nil {
+			return "", err
+		}
+		if !searchResp.Success {
+			return "", errors.New(searchResp.Error)
+		}
+		if len(searchResp.Files) > 0 {
+			objectFiles = append(objectFiles, searchResp.Files[0].Filename)
+		}
+	}
+	scripts := make(map[string]string)
+	for _, scriptFileID := range scriptFileIDs {
+		searchResp, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
+			TaskID:      taskData.Task.ID,
+			AgentFileID: scriptFileID,
+		})
+		if err != nil {
+			return "", err
+		}
+		if !searchResp.Success || len(searchResp.Files) == 0 {
+			return "", fmt.Errorf("failed to find aggressor script %s: %s", scriptFileID, searchResp.Error)
+		}
+		contentResp, err := mythicrpc.SendMythicRPCFileGetContent(mythicrpc.MythicRPCFileGetContentMessage{
+			AgentFileID: scriptFileID,
+		})
+		if err != nil {
+			return "", err
+		}
+		if !contentResp.Success {
+			return "", errors.New(contentResp.Error)
+		}
+		scripts[searchResp.Files[0].Filename] = string(contentResp.Content)
+	}
+	packageDefinition, report, err := translateAggressorScripts(packageName, scripts, objectFiles)
+	for _, commandDefinition := range packageDefinition.Commands {
+		report = append(report, fmt.Sprintf("[*] %s", bofArgumentUsage(BofPrefix+commandDefinition.CommandName, commandDefinition.Arguments)))
+	}
+	if len(report) > 0 {
+		mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+			TaskID:   taskData.Task.ID,
+			Response: []byte(strings.Join(report, "\n") + "\n"),
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	extensionContents, err := json.MarshalIndent(packageDefinition, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	uploadResponse, err := mythicrpc.SendMythicRPCFileCreate(mythicrpc.MythicRPCFileCreateMessage{
+		TaskID:       taskData.Task.ID,
+		Filename:     "extension.json",
+		Comment:      fmt.Sprintf("Generated from %s's aggressor scripts", packageName),
+		FileContents: extensionContents,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !uploadResponse.Success {
+		return "", errors.New(uploadResponse.Error)
+	}
+	return uploadResponse.AgentFileID, nil
+}
@@ -0,0 +1,124 @@
+package agentfunctions
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testAggressorScript = `
+# ldapsearch and whoami, trimmed down from a typical situational awareness script
+alias ldapsearch {
+	local('$barch $handle $data $args $query $attributes $count');
+	$attributes = "*";
+	$count = 0;
+	$query = $2;
+	if (size(@_) > 2) {
+		$attributes = $3;
+	}
+	$barch  = barch($1);
+	$handle = openf(script_resource("ldapsearch/ldapsearch." . $barch . ".o"));
+	$data   = readb($handle, -1);
+	closef($handle);
+	$args = bof_pack($1, "zzi", $query, $attributes, $count);
+	beacon_inline_execute($1, $data, "go", $args);
+}
+
+beacon_command_register(
+	"ldapsearch",
+	"Perform LDAP search.",
+	"Usage: ldapsearch <query> " .
+	"[attributes] [count]"
+);
+
+alias whoami {
+	beacon_inline_execute($1, readbof($1, "whoami"), "go", $null);
+}
+
+alias netuse {
+	$args = bof_pack($1, "zz", $2, "C$");
+	beacon_inline_execute($1, readbof($1, "netuse"), "go", $args);
+}
+
+alias psh {
+	bpowershell($1, $2);
+}
+`
+
+func TestTranslateAggressorScripts(t *testing.T) {
+	objectFiles := []string{"ldapsearch.x64.o", "ldapsearch.x86.o", "whoami.x64.o", "netuse.x64.o"}
+	packageDefinition, report, err := translateAggressorScripts("SA", map[string]string{"SA.cna": testAggressorScript}, objectFiles)
+	if err != nil {
+		t.Fatalf("expected the script to translate, got %v", err)
+	}
+	commandDefinitions := expandBofCommandDefinitions(packageDefinition)
+	if len(commandDefinitions) != 2 {
+		t.Fatalf("expected ldapsearch and whoami, got %+v", commandDefinitions)
+	}
+	ldapsearch := commandDefinitions[0]
+	if ldapsearch.CommandName != "ldapsearch" || ldapsearch.Help != "Perform LDAP search." ||
+		ldapsearch.LongHelp != "Usage: ldapsearch <query> [attributes] [count]" || ldapsearch.Entrypoint != "go" {
+		t.Fatalf("unexpected ldapsearch definition: %+v", ldapsearch)
+	}
+	expectedArguments := []bofCommandDefinitionArguments{
+		{Name: "query", Type: "string"},
+		{Name: "attributes", Type: "string", Optional: true, Default: "*"},
+		{Name: "count", Type: "int", Optional: true, Default: float64(0)},
+	}
+	if !slices.Equal(ldapsearch.Arguments, expectedArguments) {
+		t.Fatalf("expected %+v, got %+v", expectedArguments, ldapsearch.Arguments)
+	}
+	expectedFiles := []bofCommandDefinitionFiles{
+		{OS: "windows", Arch: "amd64", Path: "ldapsearch.x64.o"},
+		{OS: "windows", Arch: "386", Path: "ldapsearch.x86.o"},
+	}
+	if !slices.Equal(ldapsearch.Files, expectedFiles) {
+		t.Fatalf("expected %+v, got %+v", expectedFiles, ldapsearch.Files)
+	}
+	if whoami := commandDefinitions[1]; len(whoami.Arguments) != 0 || len(whoami.Files) != 1 || whoami.Files[0].Path != "whoami.x64.o" {
+		t.Fatalf("unexpected whoami definition: %+v", whoami)
+	}
+	joinedReport := strings.Join(report, "\n")
+	for _, expected := range []string{
+		`skipped netuse: bof_pack value "C$" can't be mapped to a command argument`,
+		"skipped psh: doesn't call beacon_inline_execute",
+		"whoami isn't registered with beacon_command_register",
+	} {
+		if !strings.Contains(joinedReport, expected) {
+			t.Fatalf("expected the report to contain %q, got:\n%s", expected, joinedReport)
+		}
+	}
+}
+
+func TestTranslateAggressorScriptsWithoutCommands(t *testing.T) {
+	_, report, err := translateAggressorScripts("SA", map[string]string{"SA.cna": testAggressorScript}, []string{"other.x64.o"})
+	if !errors.Is(err, noAggressorCommandsError) {
+		t.Fatalf("expected no commands to be translated, got %v", err)
+	}
+	if len(report) == 0 {
+		t.Fatalf("expected every skipped alias to be reported")
+	}
+	if _, _, err = translateAggressorScripts("SA", map[string]string{"bad.cna": `alias x { "unterminated }`}, nil); !errors.Is(err, noAggressorCommandsError) {
+		t.Fatalf("expected a script that doesn't parse to be reported, got %v", err)
+	}
+}
+
+func TestTranslateBofPackPositionalArguments(t *testing.T) {
+	tokens, err := tokenizeAggressorScript(`bof_pack($1, "Zsb", $2, $3, $file)`)
+	if err != nil {
+		t.Fatalf("failed to tokenize: %v", err)
+	}
+	arguments, err := translateBofPack(findCnaCalls(tokens, "bof_pack")[0], nil)
+	if err != nil {
+		t.Fatalf("expected bof_pack to translate, got %v", err)
+	}
+	expected := []bofCommandDefinitionArguments{{Name: "arg1", Type: "wstring"}, {Name: "arg2", Type: "short"}, {Name: "file", Type: "file"}}
+	if !slices.Equal(arguments, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, arguments)
+	}
+	tokens, _ = tokenizeAggressorScript(`bof_pack($1, "zx", $2, $3)`)
+	if _, err = translateBofPack(findCnaCalls(tokens, "bof_pack")[0], nil); err == nil {
+		t.Fatalf("expected an unsupported format character to be rejected")
+	}
+}
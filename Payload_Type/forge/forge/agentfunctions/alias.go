@@ -0,0 +1,401 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+// AliasPrefix is used for commands made from Sliver armory aliases, which run .NET assemblies or dlls instead of bofs
+const AliasPrefix = "forge_alias_"
+
+const aliasManifestFilename = "alias.json"
+
+var aliasNotSupportedError = errors.New("this callback's payload type can't run this alias")
+
+// isAliasManifest tells an alias.json apart from an extension.json, aliases always say if they're an assembly
+func isAliasManifest(contents []byte) bool {
+	manifest := map[string]json.RawMessage{}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return false
+	}
+	_, hasAssembly := manifest["is_assembly"]
+	_, hasReflective := manifest["is_reflective"]
+	return hasAssembly || hasReflective
+}
+
+// readAliasDefinitions parses an alias.json into a single command definition
+func readAliasDefinitions(contents []byte) ([]bofCommandDefinition, error) {
+	aliasDefinition := bofCommandDefinition{}
+	if err := json.Unmarshal(contents, &aliasDefinition); err != nil {
+		return nil, err
+	}
+	if aliasDefinition.CommandName == "" {
+		return nil, errors.New("alias.json does not define a command_name")
+	}
+	aliasDefinition.alias = true
+	aliasDefinition.Arguments = nil
+	aliasDefinition.Commands = nil
+	if aliasDefinition.LongHelp == "" {
+		aliasDefinition.LongHelp = aliasDefinition.Help
+	}
+	return []bofCommandDefinition{aliasDefinition}, nil
+}
+
+func (commandDefinition bofCommandDefinition) commandPrefix() string {
+	if commandDefinition.alias {
+		return AliasPrefix
+	}
+	return BofPrefix
+}
+
+// executionMethods are the ways an alias can be run, the first one is the default
+func (commandDefinition bofCommandDefinition) executionMethods() []string {
+	if commandDefinition.IsAssembly {
+		return []string{"execute_assembly", "inline_assembly"}
+	}
+	return []string{dllExecutionMethod}
+}
+
+// selectCallbackFile picks the file from an extension.json or alias.json that matches the callback's architecture
+func selectCallbackFile(files []bofCommandDefinitionFiles, callbackArchitecture string) (string, []string) {
+	targetFilename := ""
+	validArchitectures := make([]string, len(files))
+	for i, f := range files {
+		validArchitectures[i] = f.Arch
+		if f.OS != "windows" {
+			continue
+		}
+		if f.Arch == "amd64" && slices.Contains([]string{"x64", "amd64", "x86_64"}, strings.ToLower(callbackArchitecture)) {
+			targetFilename = f.Path
+		}
+		if f.Arch == "386" && slices.Contains([]string{"x86", "i386"}, strings.ToLower(callbackArchitecture)) {
+			targetFilename = f.Path
+		}
+	}
+	return targetFilename, validArchitectures
+}
+
+// registerToolFile makes sure Mythic has a copy of a tool's file so it can be sent to the callback, returning its id
+func registerToolFile(taskData *agentstructs.PTTaskMessageAllData, filename string, comment string, contents []byte) (string, error) {
+	fileSearch, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
+		TaskID:     taskData.Task.ID,
+		Filename:   filename,
+		MaxResults: 1,
+		Comment:    comment,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !fileSearch.Success {
+		return "", errors.New(fileSearch.Error)
+	}
+	if len(fileSearch.Files) > 0 {
+		return fileSearch.Files[0].AgentFileID, nil
+	}
+	mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+		TaskID:   taskData.Task.ID,
+		Response: []byte(fmt.Sprintf("[*] Registering %s with Mythic...\n", filename)),
+	})
+	uploadResponse, err := mythicrpc.SendMythicRPCFileCreate(mythicrpc.MythicRPCFileCreateMessage{
+		TaskID:       taskData.Task.ID,
+		Filename:     filename,
+		Comment:      comment,
+		FileContents: contents,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !uploadResponse.Success {
+		return "", errors.New(uploadResponse.Error)
+	}
+	return uploadResponse.AgentFileID, nil
+}
+
+// validateAliasFile checks an alias's assembly or dll before it's registered, returning a summary for the task output
+func validateAliasFile(contents []byte, file bofCommandDefinitionFiles, aliasDefinition bofCommandDefinition) (string, error) {
+	if aliasDefinition.IsAssembly {
+		metadata, err := inspectAssembly(contents)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", file.Path, err)
+		}
+		return fmt.Sprintf(".NET assembly %s", metadata.String()), nil
+	}
+	dll, err := pe.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return "", fmt.Errorf("%s isn't a PE file: %w", file.Path, err)
+	}
+	defer dll.Close()
+	if dll.Characteristics&pe.IMAGE_FILE_DLL == 0 {
+		return "", fmt.Errorf("%s isn't a dll", file.Path)
+	}
+	if expectedMachine, ok := bofArchMachines[file.Arch]; ok && expectedMachine != dll.Machine {
+		return "", fmt.Errorf("%s is listed as %s but it's built for machine type 0x%x", file.Path, file.Arch, dll.Machine)
+	}
+	kind := "dll"
+	if aliasDefinition.IsReflective {
+		kind = "reflective dll"
+	}
+	if aliasDefinition.Entrypoint != "" {
+		return fmt.Sprintf("%s, entrypoint %s", kind, aliasDefinition.Entrypoint), nil
+	}
+	return kind, nil
+}
+
+// buildAliasCommand makes a command for a Sliver armory alias that hands the assembly or dll to the agent's
+// execute_assembly/inline_assembly or dll command
+func buildAliasCommand(commandSource collectionSourceCommandData, collectionSourceData collectionSource, aliasDefinition bofCommandDefinition) agentstructs.Command {
+	prefixedCommandName := forgeCommandName(AliasPrefix, commandSource, collectionSourceData, aliasDefinition.CommandName)
+	executionMethods := aliasDefinition.executionMethods()
+	commandParameters := []agentstructs.CommandParameter{}
+	if aliasDefinition.AllowArgs {
+		commandParameters = append(commandParameters, agentstructs.CommandParameter{
+			Name:             "args",
+			ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+			Description:      "Arguments to pass to the alias",
+			DefaultValue:     aliasDefinition.DefaultArgs,
+			ModalDisplayName: "Argument String",
+			ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+				{
+					ParameterIsRequired: false,
+					UIModalPosition:     0,
+				},
+			},
+		})
+	}
+	if aliasDefinition.IsAssembly {
+		commandParameters = append(commandParameters, agentstructs.CommandParameter{
+			Name:             "execution",
+			ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE,
+			Choices:          executionMethods,
+			Description:      "Specify how the assembly should execute. Execute_assembly is a fork-and-run style architecture, inline_assembly is within the current process.",
+			DefaultValue:     executionMethods[0],
+			ModalDisplayName: "Execution Options",
+			ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+				{
+					ParameterIsRequired: false,
+					UIModalPosition:     1,
+				},
+			},
+		})
+	}
+	getExecutionMethod := func(taskData *agentstructs.PTTaskMessageAllData, registeredAgents []agentDefinition) (string, error) {
+		if !aliasDefinition.IsAssembly {
+			return dllExecutionMethod, nil
+		}
+		return getAssemblyExecutionMethod(taskData, registeredAgents)
+	}
+	if aliasDefinition.AllowArgs {
+		commandParameters = withPreset(commandParameters)
+	}
+	helpString := aliasDefinition.LongHelp
+	if helpString == "" {
+		helpString = prefixedCommandName
+	}
+	return agentstructs.Command{
+		Name: prefixedCommandName,
+		Description: fmt.Sprintf("%s\nFrom: %s\nVersion: %s%s",
+			aliasDefinition.Help, aliasDefinition.RepoURL, aliasDefinition.Version, commandSource.OPSEC.description()),
+		HelpString:          helpString,
+		Version:             1,
+		Author:              fmt.Sprintf("Original: %s", aliasDefinition.OriginalAuthor),
+		MitreAttackMappings: getMitreMappings(collectionSourceData.Name, aliasDefinition.CommandName, commandSource.CommandName, commandSource.Name),
+		SupportedUIFeatures: []string{},
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:        []string{agentstructs.SUPPORTED_OS_WINDOWS},
+			CommandIsSuggested: true,
+		},
+		CommandParameters: commandParameters,
+		TaskFunctionOPSECPre: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTTaskOPSECPreTaskMessageResponse {
+			registeredAgents, err := readRegisteredAgents()
+			if err != nil {
+				return agentstructs.PTTTaskOPSECPreTaskMessageResponse{TaskID: taskData.Task.ID, Success: false, Error: err.Error()}
+			}
+			executionMethod, err := getExecutionMethod(taskData, registeredAgents)
+			if err != nil {
+				return agentstructs.PTTTaskOPSECPreTaskMessageResponse{TaskID: taskData.Task.ID, Success: false, Error: err.Error()}
+			}
+			return forgeOPSECPre(taskData, newEngagementTask(taskData, collectionSourceData.Name, executionMethod,
+				commandSource.Name, aliasDefinition.CommandName, prefixedCommandName), commandSource.OPSEC)
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				Success: true,
+				TaskID:  taskData.Task.ID,
+			}
+			if err := checkOperationScope(prefixedCommandName, taskData); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			if err := checkToolApproval(collectionSourceData.Name, commandSource.Name); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			arguments := aliasDefinition.DefaultArgs
+			displayPreset := ""
+			if aliasDefinition.AllowArgs {
+				userArguments, err := taskData.Args.GetStringArg("args")
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if userArguments != "" {
+					arguments = userArguments
+				}
+				presetArguments, presetName, err := presetArgumentString(taskData, prefixedCommandName, userArguments)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if presetName != "" {
+					arguments = presetArguments
+					displayPreset = fmt.Sprintf("-preset %s ", presetName)
+				}
+			}
+			arguments, err := expandContextVariables(taskData, arguments)
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			registeredAgents, err := readRegisteredAgents()
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			executionMethod, err := getExecutionMethod(taskData, registeredAgents)
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			displayParams := fmt.Sprintf("%s-args \"%s\" -execution %s", displayPreset, arguments, executionMethod)
+			response.DisplayParams = &displayParams
+			err = checkEngagementPolicy(taskData, newEngagementTask(taskData, collectionSourceData.Name, executionMethod,
+				commandSource.Name, aliasDefinition.CommandName, prefixedCommandName))
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			targetFilename, validArchitectures := selectCallbackFile(aliasDefinition.Files, taskData.Callback.Architecture)
+			if targetFilename == "" {
+				response.Success = false
+				response.Error = fmt.Sprintf("Callback architecture, %s, doesn't match any alias supported architectures: %s",
+					taskData.Callback.Architecture, strings.Join(validArchitectures, ", "))
+				return response
+			}
+			downloadPath := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSource.CommandName, targetFilename)
+			downloadFile, err := readStoredFile(downloadPath)
+			if errors.Is(err, os.ErrNotExist) {
+				// file doesn't exist on disk, try to fetch it first
+				if err = downloadBofFile(commandSource, collectionSourceData, taskData); err == nil {
+					if err = quarantineTaskDownload(taskData, commandSource, collectionSourceData); err == nil {
+						downloadFile, err = readStoredFile(downloadPath)
+					}
+				}
+			}
+			if err != nil {
+				logging.LogError(err, "Failed to read alias file", "path", downloadPath)
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			binaryFileID, err := registerToolFile(taskData, filepath.Base(targetFilename),
+				fmt.Sprintf("Community Collection's %s version %s", aliasDefinition.CommandName, targetFilename), downloadFile)
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			for _, agent := range registeredAgents {
+				if agent.Agent != taskData.PayloadType {
+					continue
+				}
+				commandName, commandFileArg, commandArgsArg, entrypointArg := agent.DllCommand, agent.DllFileParameterName,
+					agent.DllArgumentParameterName, agent.DllEntryPointParameterName
+				switch executionMethod {
+				case "execute_assembly":
+					commandName, commandFileArg, commandArgsArg, entrypointArg = agent.ExecuteAssemblyCommand,
+						agent.ExecuteAssemblyFileParameterName, agent.ExecuteAssemblyArgumentParameterName, ""
+				case "inline_assembly":
+					commandName, commandFileArg, commandArgsArg, entrypointArg = agent.InlineAssemblyCommand,
+						agent.InlineAssemblyFileParameterName, agent.InlineAssemblyArgumentParameterName, ""
+				}
+				if commandName == "" {
+					response.Success = false
+					response.Error = fmt.Sprintf("%s: %s has no %s command in %s", aliasNotSupportedError.Error(), agent.Agent,
+						executionMethod, PayloadTypeSupportFilename)
+					return response
+				}
+				response.CommandName = &commandName
+				response.ReprocessAtNewCommandPayloadType = agent.Agent
+				taskData.Args.RemoveArg("args")
+				taskData.Args.RemoveArg("execution")
+				taskData.Args.AddArg(agentstructs.CommandParameter{
+					Name:          commandFileArg,
+					ParameterType: agentstructs.COMMAND_PARAMETER_TYPE_FILE,
+					DefaultValue:  binaryFileID,
+				})
+				taskData.Args.AddArg(agentstructs.CommandParameter{
+					Name:          commandArgsArg,
+					ParameterType: agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+					DefaultValue:  arguments,
+				})
+				if entrypointArg != "" && aliasDefinition.Entrypoint != "" {
+					taskData.Args.AddArg(agentstructs.CommandParameter{
+						Name:          entrypointArg,
+						ParameterType: agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+						DefaultValue:  aliasDefinition.Entrypoint,
+					})
+				}
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(fmt.Sprintf("[*] Passing execution to %s's \"%s\" command for further processing...\n", agent.Agent, commandName)),
+				})
+				updatedStatus := fmt.Sprintf("%s preparing task...", agent.Agent)
+				mythicrpc.SendMythicRPCTaskUpdate(mythicrpc.MythicRPCTaskUpdateMessage{
+					TaskID:       taskData.Task.ID,
+					UpdateStatus: &updatedStatus,
+				})
+				return response
+			}
+			response.Success = false
+			response.Error = "Failed to find matching payload type for this callback when looking for supported agents."
+			response.Error += fmt.Sprintf("\nModify the %s file to add support for this callback's payload type.", PayloadTypeSupportFilename)
+			return response
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			input = strings.TrimSpace(input)
+			if len(input) == 0 {
+				return nil
+			}
+			if strings.HasPrefix(input, "{") {
+				return args.LoadArgsFromJSONString(input)
+			}
+			if !aliasDefinition.AllowArgs {
+				return fmt.Errorf("%s doesn't take arguments", prefixedCommandName)
+			}
+			// aliases take a single argument string, the same as running the tool on the command line
+			return args.SetArgValue("args", input)
+		},
+	}
+}
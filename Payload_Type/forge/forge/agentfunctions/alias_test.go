@@ -0,0 +1,142 @@
+package agentfunctions
+
+import (
+	"archive/tar"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// nativeDLL is nativePE marked as a dll
+func nativeDLL() []byte {
+	contents := nativePE()
+	characteristics := binary.LittleEndian.Uint16(contents[0x56:])
+	binary.LittleEndian.PutUint16(contents[0x56:], characteristics|pe.IMAGE_FILE_DLL)
+	return contents
+}
+
+// setupAliasFixture replaces the fixture's extension.json with an alias.json for a 32-bit dll
+func setupAliasFixture(tb testing.TB, manifest string) (collectionSourceCommandData, collectionSource) {
+	tb.Helper()
+	setupRegistryFixture(tb, 1)
+	bofCommandFolder := filepath.Join(".", PayloadTypeName, "collections", "Bench", "bof-0")
+	os.Remove(filepath.Join(bofCommandFolder, "extension.json"))
+	if err := os.WriteFile(filepath.Join(bofCommandFolder, aliasManifestFilename), []byte(manifest), 0644); err != nil {
+		tb.Fatalf("failed to write alias.json: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(bofCommandFolder, "bof-0.x86.dll"), nativeDLL(), 0644); err != nil {
+		tb.Fatalf("failed to write dll: %v", err)
+	}
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	return commandSource, source
+}
+
+func TestAliasManifest(t *testing.T) {
+	commandSource, source := setupAliasFixture(t, `{"name": "bof-0", "command_name": "sharp-thing", "help": "runs a thing",
+		"is_assembly": false, "is_reflective": true, "entrypoint": "Run", "allow_args": true, "default_args": "-h",
+		"files": [{"os": "windows", "arch": "386", "path": "bof-0.x86.dll"}]}`)
+	if !isAliasManifest([]byte(`{"command_name": "x", "is_assembly": true}`)) {
+		t.Fatalf("expected a manifest with is_assembly to be an alias")
+	}
+	if isAliasManifest([]byte(`{"command_name": "x", "arguments": []}`)) {
+		t.Fatalf("expected an extension.json to not be an alias")
+	}
+	definitions, err := loadBofCommandDefinitions(commandSource, source)
+	if err != nil {
+		t.Fatalf("expected alias.json to be read, got %v", err)
+	}
+	if len(definitions) != 1 || !definitions[0].alias || !definitions[0].AllowArgs || definitions[0].DefaultArgs != "-h" {
+		t.Fatalf("unexpected alias definitions: %+v", definitions)
+	}
+	if names := getBofCommandNamesForSource(commandSource, source); !slices.Equal(names, []string{AliasPrefix + "sharp-thing"}) {
+		t.Fatalf("expected the alias prefix, got %v", names)
+	}
+	if methods := definitions[0].executionMethods(); !slices.Equal(methods, []string{dllExecutionMethod}) {
+		t.Fatalf("expected dll aliases to only run as a dll, got %v", methods)
+	}
+	objects, err := validateBofObjects(commandSource, source)
+	if err != nil {
+		t.Fatalf("expected the dll to be valid, got %v", err)
+	}
+	if report := coffObjectReport(objects); !strings.Contains(report, "reflective dll, entrypoint Run") {
+		t.Fatalf("expected the report to describe the dll, got %q", report)
+	}
+	if compatibility := getBofCompatibility(commandSource, source, []agentDefinition{{Agent: "a", BofCommand: "bof"}}); compatibility != nil {
+		t.Fatalf("expected aliases to skip the Beacon API check, got %+v", compatibility)
+	}
+}
+
+func TestValidateAliasFile(t *testing.T) {
+	dll := bofCommandDefinition{alias: true}
+	if _, err := validateAliasFile(nativeDLL(), bofCommandDefinitionFiles{Arch: "amd64", Path: "x.dll"}, dll); err == nil {
+		t.Fatalf("expected a 32-bit dll listed as amd64 to be rejected")
+	}
+	if _, err := validateAliasFile(nativePE(), bofCommandDefinitionFiles{Arch: "386", Path: "x.dll"}, dll); err == nil {
+		t.Fatalf("expected an exe to be rejected for a dll alias")
+	}
+	assembly := bofCommandDefinition{alias: true, IsAssembly: true}
+	if _, err := validateAliasFile(nativeDLL(), bofCommandDefinitionFiles{Arch: "386", Path: "x.exe"}, assembly); err == nil {
+		t.Fatalf("expected a native dll to be rejected for an assembly alias")
+	}
+}
+
+func TestSelectCallbackFile(t *testing.T) {
+	files := []bofCommandDefinitionFiles{
+		{OS: "windows", Arch: "amd64", Path: "tool.x64.dll"},
+		{OS: "windows", Arch: "386", Path: "tool.x86.dll"},
+	}
+	if target, _ := selectCallbackFile(files, "x86_64"); target != "tool.x64.dll" {
+		t.Fatalf("expected the 64-bit dll, got %q", target)
+	}
+	if target, _ := selectCallbackFile(files, "x86"); target != "tool.x86.dll" {
+		t.Fatalf("expected the 32-bit dll, got %q", target)
+	}
+	if target, archs := selectCallbackFile(files, "arm64"); target != "" || !slices.Equal(archs, []string{"amd64", "386"}) {
+		t.Fatalf("expected no match for arm64, got %q %v", target, archs)
+	}
+}
+
+// TestArmoryAliasPackage extracts a package laid out like the armory's alias releases (alias.json next to the assembly)
+func TestArmoryAliasPackage(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	collectionPath := filepath.Join(".", PayloadTypeName, "collections", "Bench")
+	extractPath := filepath.Join(collectionPath, "bof-0") + string(os.PathSeparator)
+	os.Remove(filepath.Join(extractPath, "extension.json"))
+	archive := gzipBytes(t, buildTestTar(t, []testArchiveEntry{
+		{name: "./", typeflag: tar.TypeDir},
+		{name: "./alias.json", typeflag: tar.TypeReg, contents: `{"name": "seatbelt", "version": "v0.0.4",
+			"command_name": "seatbelt", "original_author": "@harmj0y", "repo_url": "https://github.com/sliverarmory/Seatbelt",
+			"help": "Seatbelt host survey", "entrypoint": "Main", "allow_args": true, "default_args": "",
+			"is_reflective": false, "is_assembly": true, "files": [{"os": "windows", "arch": "amd64", "path": "Seatbelt.exe"},
+			{"os": "windows", "arch": "386", "path": "Seatbelt.exe"}]}`},
+		{name: "./Seatbelt.exe", typeflag: tar.TypeReg, contents: string(testAssembly("Seatbelt"))},
+	}))
+	archivePath := filepath.Join(collectionPath, "bof-0.tar.gz")
+	if err := os.WriteFile(archivePath, archive, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	if err := extractBofAsset(archivePath, archiveFormatForName(archivePath), extractPath); err != nil {
+		t.Fatalf("failed to extract the alias package: %v", err)
+	}
+	forgeRegistry.invalidateBofDefinitions("Bench", "bof-0")
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	definitions, err := loadBofCommandDefinitions(commandSource, source)
+	if err != nil || len(definitions) != 1 || !definitions[0].alias || !definitions[0].IsAssembly {
+		t.Fatalf("expected an assembly alias, got %+v, %v", definitions, err)
+	}
+	if names := getBofCommandNamesForSource(commandSource, source); !slices.Equal(names, []string{AliasPrefix + "seatbelt"}) {
+		t.Fatalf("expected forge_alias_seatbelt, got %v", names)
+	}
+	if methods := definitions[0].executionMethods(); !slices.Contains(methods, "execute_assembly") {
+		t.Fatalf("expected assembly aliases to run as assemblies, got %v", methods)
+	}
+	if _, err = validateBofObjects(commandSource, source); err != nil {
+		t.Fatalf("expected the assembly to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+package agentfunctions
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/ulikunitz/xz"
+)
+
+const archiveFormatTarGz = "tar.gz"
+const archiveFormatTarXz = "tar.xz"
+const archiveFormatZip = "zip"
+const archiveFormatObject = "o"
+
+// bofAssetFormats is the order release assets are looked for when a BOF is downloaded from GitHub
+var bofAssetFormats = []string{archiveFormatTarGz, archiveFormatTarXz, archiveFormatZip}
+
+const maxExtractedFileSize = 64 * 1024 * 1024
+const maxExtractedTotalSize = 256 * 1024 * 1024
+const maxExtractedFileCount = 4096
+
+var unsafeArchiveEntryError = errors.New("archive entry is not allowed")
+var archiveTooLargeError = errors.New("archive exceeds extraction size limits")
+
+// archiveFormatForName figures out how to extract a downloaded asset based on its name or url
+func archiveFormatForName(name string) string {
+	name = strings.ToLower(name)
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveFormatTarGz
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return archiveFormatTarXz
+	case strings.HasSuffix(name, ".zip"):
+		return archiveFormatZip
+	case strings.HasSuffix(name, ".o"):
+		return archiveFormatObject
+	default:
+		return ""
+	}
+}
+
+// archiveExtractor writes archive entries under root, refusing anything that would escape it or exceed the size limits
+type archiveExtractor struct {
+	root         string
+	maxFileSize  int64
+	maxTotalSize int64
+	maxFiles     int
+	totalSize    int64
+	fileCount    int
+	// plaintext skips storage encryption, for files other programs need to read (ex: source code for the compiler)
+	plaintext bool
+}
+
+func newArchiveExtractor(root string) *archiveExtractor {
+	return &archiveExtractor{
+		root:         filepath.Clean(root),
+		maxFileSize:  maxExtractedFileSize,
+		maxTotalSize: maxExtractedTotalSize,
+		maxFiles:     maxExtractedFileCount,
+	}
+}
+
+// targetPath cleans an archive entry's name and makes sure it resolves inside of the extraction root
+func (e *archiveExtractor) targetPath(name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(strings.ReplaceAll(name, "\\", "/")))
+	if cleaned == "." {
+		return e.root, nil
+	}
+	if !filepath.IsLocal(cleaned) {
+		return "", fmt.Errorf("%w: %s resolves outside of the extraction folder", unsafeArchiveEntryError, name)
+	}
+	target := filepath.Join(e.root, cleaned)
+	relativePath, err := filepath.Rel(e.root, target)
+	if err != nil || !filepath.IsLocal(relativePath) {
+		return "", fmt.Errorf("%w: %s resolves outside of the extraction folder", unsafeArchiveEntryError, name)
+	}
+	return target, nil
+}
+
+func (e *archiveExtractor) writeDir(name string) error {
+	target, err := e.targetPath(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(target, os.ModePerm)
+}
+
+func (e *archiveExtractor) writeFile(name string, size int64, contents io.Reader) error {
+	target, err := e.targetPath(name)
+	if err != nil {
+		return err
+	}
+	if target == e.root {
+		return fmt.Errorf("%w: %s is not a file", unsafeArchiveEntryError, name)
+	}
+	e.fileCount++
+	if e.fileCount > e.maxFiles {
+		return fmt.Errorf("%w: more than %d files", archiveTooLargeError, e.maxFiles)
+	}
+	if size > e.maxFileSize {
+		return fmt.Errorf("%w: %s is %d bytes", archiveTooLargeError, name, size)
+	}
+	err = os.MkdirAll(filepath.Dir(target), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	// an existing symlink at the target would otherwise be followed
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s is an existing symlink", unsafeArchiveEntryError, name)
+	}
+	outFile, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	// sizes in headers can lie, so limit what's actually read too
+	var written int64
+	if e.plaintext {
+		written, err = io.Copy(outFile, io.LimitReader(contents, e.maxFileSize+1))
+	} else {
+		written, err = copyToStoredFile(outFile, io.LimitReader(contents, e.maxFileSize+1))
+	}
+	closeErr := outFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && written > e.maxFileSize {
+		err = fmt.Errorf("%w: %s is larger than %d bytes", archiveTooLargeError, name, e.maxFileSize)
+	}
+	if err == nil {
+		e.totalSize += written
+		if e.totalSize > e.maxTotalSize {
+			err = fmt.Errorf("%w: more than %d bytes total", archiveTooLargeError, e.maxTotalSize)
+		}
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
+
+func (e *archiveExtractor) extractTar(stream io.Reader) error {
+	tarReader := tar.NewReader(stream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			logging.LogError(err, "extractTar: Next() failed")
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.writeDir(header.Name)
+		case tar.TypeReg:
+			logging.LogInfo("extracting", "header files", header.Name, "extract path", e.root)
+			err = e.writeFile(header.Name, header.Size, tarReader)
+		case tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeSymlink, tar.TypeLink:
+			err = fmt.Errorf("%w: %s is a link", unsafeArchiveEntryError, header.Name)
+		default:
+			err = fmt.Errorf("%w: %s has unsupported type %q", unsafeArchiveEntryError, header.Name, header.Typeflag)
+		}
+		if err != nil {
+			logging.LogError(err, "extractTar: failed to extract entry", "filename", header.Name)
+			return err
+		}
+	}
+}
+
+func (e *archiveExtractor) extractZip(zipContents []byte) error {
+	zipReader, err := zip.NewReader(bytes.NewReader(zipContents), int64(len(zipContents)))
+	if err != nil {
+		logging.LogError(err, "extractZip: NewReader failed")
+		return err
+	}
+	for _, zipFile := range zipReader.File {
+		mode := zipFile.Mode()
+		switch {
+		case mode.IsDir():
+			err = e.writeDir(zipFile.Name)
+		case mode&os.ModeSymlink != 0:
+			err = fmt.Errorf("%w: %s is a link", unsafeArchiveEntryError, zipFile.Name)
+		case !mode.IsRegular():
+			err = fmt.Errorf("%w: %s has unsupported mode %s", unsafeArchiveEntryError, zipFile.Name, mode)
+		default:
+			logging.LogInfo("extracting", "header files", zipFile.Name, "extract path", e.root)
+			var contents io.ReadCloser
+			contents, err = zipFile.Open()
+			if err == nil {
+				err = e.writeFile(zipFile.Name, int64(zipFile.UncompressedSize64), contents)
+				contents.Close()
+			}
+		}
+		if err != nil {
+			logging.LogError(err, "extractZip: failed to extract entry", "filename", zipFile.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractTarGz extracts a gzipped tarball into extractPath
+func ExtractTarGz(gzipStream io.Reader, extractPath string) error {
+	uncompressedStream, err := gzip.NewReader(gzipStream)
+	if err != nil {
+		logging.LogError(err, "ExtractTarGz: NewReader failed")
+		return err
+	}
+	defer uncompressedStream.Close()
+	return newArchiveExtractor(extractPath).extractTar(uncompressedStream)
+}
+
+// ExtractTarXz extracts an xz compressed tarball into extractPath
+func ExtractTarXz(xzStream io.Reader, extractPath string) error {
+	uncompressedStream, err := xz.NewReader(xzStream)
+	if err != nil {
+		logging.LogError(err, "ExtractTarXz: NewReader failed")
+		return err
+	}
+	return newArchiveExtractor(extractPath).extractTar(uncompressedStream)
+}
+
+// ExtractZip extracts a zip file on disk into extractPath
+func ExtractZip(zipPath string, extractPath string) error {
+	zipContents, err := readStoredFile(zipPath)
+	if err != nil {
+		return err
+	}
+	return newArchiveExtractor(extractPath).extractZip(zipContents)
+}
+
+// extractBofAsset unpacks a downloaded BOF release archive based on its format
+func extractBofAsset(assetPath string, format string, extractPath string) error {
+	if format == archiveFormatZip {
+		return ExtractZip(assetPath, extractPath)
+	}
+	// the archive might be stored encrypted, so it's read into memory instead of streamed
+	assetContents, err := readStoredFile(assetPath)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case archiveFormatTarXz:
+		return ExtractTarXz(bytes.NewReader(assetContents), extractPath)
+	default:
+		return ExtractTarGz(bytes.NewReader(assetContents), extractPath)
+	}
+}
+
+// objectFileArch guesses a bare object file's architecture from common naming schemes (ex: whoami.x64.o)
+func objectFileArch(filename string) string {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.Contains(name, "x86_64"), strings.Contains(name, "x64"), strings.Contains(name, "amd64"):
+		return "amd64"
+	case strings.Contains(name, "x86"), strings.Contains(name, "386"), strings.Contains(name, "i686"):
+		return "386"
+	default:
+		return "amd64"
+	}
+}
+
+// writeBareObjectExtension creates an extension.json for BOFs that are published as bare object files without one
+func writeBareObjectExtension(commandSource collectionSourceCommandData, extractPath string, objectFiles []string) error {
+	extensionPath := filepath.Join(extractPath, "extension.json")
+	if _, err := os.Stat(extensionPath); err == nil {
+		return nil
+	}
+	definition := bofCommandDefinition{
+		Name:        commandSource.Name,
+		CommandName: commandSource.CommandName,
+		RepoURL:     commandSource.RepoURL,
+		Help:        commandSource.Description,
+		Entrypoint:  "go",
+	}
+	seenArchs := make(map[string]bool)
+	for _, objectFile := range objectFiles {
+		arch := objectFileArch(objectFile)
+		if seenArchs[arch] {
+			continue
+		}
+		seenArchs[arch] = true
+		definition.Files = append(definition.Files, bofCommandDefinitionFiles{
+			OS:   "windows",
+			Arch: arch,
+			Path: filepath.Base(objectFile),
+		})
+	}
+	extension, err := json.MarshalIndent(definition, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoredFile(extensionPath, extension, 0644)
+}
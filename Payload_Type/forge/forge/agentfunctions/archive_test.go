@@ -0,0 +1,165 @@
+package agentfunctions
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+type testArchiveEntry struct {
+	name     string
+	typeflag byte
+	contents string
+}
+
+func buildTestTar(t *testing.T, entries []testArchiveEntry) []byte {
+	t.Helper()
+	buffer := bytes.Buffer{}
+	tarWriter := tar.NewWriter(&buffer)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Mode: 0644, Size: int64(len(entry.contents))}
+		if entry.typeflag == tar.TypeSymlink {
+			header.Linkname = entry.contents
+			header.Size = 0
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if entry.typeflag == tar.TypeReg {
+			tarWriter.Write([]byte(entry.contents))
+		}
+	}
+	tarWriter.Close()
+	return buffer.Bytes()
+}
+
+func gzipBytes(t *testing.T, contents []byte) []byte {
+	t.Helper()
+	buffer := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&buffer)
+	gzipWriter.Write(contents)
+	gzipWriter.Close()
+	return buffer.Bytes()
+}
+
+func TestExtractTarGzWritesFilesInsideExtractPath(t *testing.T) {
+	extractPath := t.TempDir()
+	archive := gzipBytes(t, buildTestTar(t, []testArchiveEntry{
+		{name: "./", typeflag: tar.TypeDir},
+		{name: "./extension.json", typeflag: tar.TypeReg, contents: "{}"},
+		{name: "./bin/whoami.x64.o", typeflag: tar.TypeReg, contents: "object"},
+	}))
+	if err := ExtractTarGz(bytes.NewReader(archive), extractPath); err != nil {
+		t.Fatalf("unexpected extraction error: %v", err)
+	}
+	contents, err := os.ReadFile(filepath.Join(extractPath, "bin", "whoami.x64.o"))
+	if err != nil || string(contents) != "object" {
+		t.Fatalf("unexpected extracted contents %q: %v", contents, err)
+	}
+}
+
+func TestExtractTarGzRejectsUnsafeEntries(t *testing.T) {
+	for name, entry := range map[string]testArchiveEntry{
+		"parent traversal": {name: "./../../escaped.o", typeflag: tar.TypeReg, contents: "x"},
+		"absolute path":    {name: "/tmp/escaped.o", typeflag: tar.TypeReg, contents: "x"},
+		"symlink":          {name: "link.o", typeflag: tar.TypeSymlink, contents: "/etc/passwd"},
+		"hard link":        {name: "link.o", typeflag: tar.TypeLink, contents: "/etc/passwd"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			extractPath := filepath.Join(root, "collection", "command")
+			archive := gzipBytes(t, buildTestTar(t, []testArchiveEntry{entry}))
+			err := ExtractTarGz(bytes.NewReader(archive), extractPath)
+			if !errors.Is(err, unsafeArchiveEntryError) {
+				t.Fatalf("expected unsafe entry error, got %v", err)
+			}
+			if _, err = os.Stat(filepath.Join(root, "escaped.o")); !os.IsNotExist(err) {
+				t.Fatalf("expected nothing to be written outside of the extraction folder")
+			}
+		})
+	}
+}
+
+func TestArchiveExtractorEnforcesSizeLimits(t *testing.T) {
+	extractor := newArchiveExtractor(t.TempDir())
+	extractor.maxFileSize = 4
+	extractor.maxTotalSize = 6
+	if err := extractor.writeFile("a.o", -1, bytes.NewReader([]byte("12345"))); !errors.Is(err, archiveTooLargeError) {
+		t.Fatalf("expected per-file limit error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(extractor.root, "a.o")); !os.IsNotExist(err) {
+		t.Fatalf("expected oversized file to be removed")
+	}
+	if err := extractor.writeFile("b.o", 4, bytes.NewReader([]byte("1234"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := extractor.writeFile("c.o", 4, bytes.NewReader([]byte("1234"))); !errors.Is(err, archiveTooLargeError) {
+		t.Fatalf("expected total limit error, got %v", err)
+	}
+}
+
+func TestExtractZipAndTarXz(t *testing.T) {
+	zipBuffer := bytes.Buffer{}
+	zipWriter := zip.NewWriter(&zipBuffer)
+	fileWriter, _ := zipWriter.Create("whoami/extension.json")
+	fileWriter.Write([]byte("{}"))
+	zipWriter.Close()
+	zipPath := filepath.Join(t.TempDir(), "whoami.zip")
+	os.WriteFile(zipPath, zipBuffer.Bytes(), 0644)
+	extractPath := t.TempDir()
+	if err := extractBofAsset(zipPath, archiveFormatForName(zipPath), extractPath); err != nil {
+		t.Fatalf("unexpected zip extraction error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(extractPath, "whoami", "extension.json")); err != nil {
+		t.Fatalf("expected zip contents to be extracted: %v", err)
+	}
+
+	xzBuffer := bytes.Buffer{}
+	xzWriter, _ := xz.NewWriter(&xzBuffer)
+	xzWriter.Write(buildTestTar(t, []testArchiveEntry{{name: "whoami.x64.o", typeflag: tar.TypeReg, contents: "object"}}))
+	xzWriter.Close()
+	xzPath := filepath.Join(t.TempDir(), "whoami.tar.xz")
+	os.WriteFile(xzPath, xzBuffer.Bytes(), 0644)
+	if err := extractBofAsset(xzPath, archiveFormatForName(xzPath), extractPath); err != nil {
+		t.Fatalf("unexpected tar.xz extraction error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(extractPath, "whoami.x64.o")); err != nil {
+		t.Fatalf("expected tar.xz contents to be extracted: %v", err)
+	}
+}
+
+func TestSelectBofReleaseAssetsFallsBackToObjectFiles(t *testing.T) {
+	assets := selectBofReleaseAssets([]githubReleaseAsset{
+		{Name: "whoami.zip", URL: "zip"},
+		{Name: "whoami.tar.xz", URL: "xz"},
+		{Name: "whoami2.tar.gz", URL: "other"},
+	}, "whoami")
+	if len(assets) != 1 || assets[0].URL != "xz" {
+		t.Fatalf("expected tar.xz to be preferred over zip, got %v", assets)
+	}
+	assets = selectBofReleaseAssets([]githubReleaseAsset{
+		{Name: "whoami.x64.o", URL: "x64"},
+		{Name: "whoami.x86.o", URL: "x86"},
+		{Name: "whoami2.x64.o", URL: "other"},
+	}, "whoami")
+	if len(assets) != 2 {
+		t.Fatalf("expected both object files to be selected, got %v", assets)
+	}
+	extractPath := t.TempDir()
+	err := writeBareObjectExtension(collectionSourceCommandData{Name: "whoami", CommandName: "whoami"}, extractPath,
+		[]string{"whoami.x64.o", "whoami.x86.o"})
+	if err != nil {
+		t.Fatalf("unexpected error writing extension.json: %v", err)
+	}
+	contents, _ := os.ReadFile(filepath.Join(extractPath, "extension.json"))
+	if !bytes.Contains(contents, []byte(`"arch": "386"`)) || !bytes.Contains(contents, []byte(`"arch": "amd64"`)) {
+		t.Fatalf("expected both architectures in generated extension.json, got %s", contents)
+	}
+}
@@ -0,0 +1,90 @@
+package agentfunctions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// allowedAssemblyReferencesEnv is a comma separated list of extra assembly names that are expected to be on targets
+const allowedAssemblyReferencesEnv = "FORGE_ALLOWED_ASSEMBLY_REFERENCES"
+
+var missingAssemblyDependenciesError = errors.New("assembly depends on DLLs that aren't part of the .NET Framework")
+
+// frameworkAssemblies are the assemblies outside of the System.* namespace that ship with the .NET Framework or Windows
+var frameworkAssemblies = []string{
+	"mscorlib", "System", "netstandard", "WindowsBase", "PresentationCore", "PresentationFramework", "Accessibility",
+	"ReachFramework", "UIAutomationClient", "UIAutomationProvider", "UIAutomationTypes", "CustomMarshalers",
+	"Microsoft.CSharp", "Microsoft.VisualBasic", "Microsoft.VisualC", "Microsoft.JScript", "Microsoft.Build",
+	"Microsoft.Build.Framework", "Microsoft.Build.Tasks.v4.0", "Microsoft.Build.Utilities.v4.0", "Microsoft.Build.Engine",
+	"Microsoft.Management.Infrastructure",
+}
+
+// outOfBandAssemblies are System.* assemblies that only come from NuGet packages, so targets won't have them
+var outOfBandAssemblies = []string{
+	"System.Buffers", "System.Collections.Immutable", "System.IO.Pipelines", "System.Memory", "System.Memory.Data",
+	"System.Numerics.Vectors", "System.Reflection.Metadata", "System.Runtime.CompilerServices.Unsafe",
+	"System.Text.Encodings.Web", "System.Text.Json", "System.Threading.Channels", "System.Threading.Tasks.Extensions",
+}
+
+func isFrameworkAssembly(name string) bool {
+	if slices.Contains(frameworkAssemblies, name) {
+		return true
+	}
+	for _, allowed := range strings.Split(os.Getenv(allowedAssemblyReferencesEnv), ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), name) {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, "System.") && !slices.Contains(outOfBandAssemblies, name)
+}
+
+// isEmbeddedAssembly checks for a reference that's bundled as a resource, like Costura.Fody's
+// costura.newtonsoft.json.dll.compressed, which the assembly loads itself
+func (m assemblyMetadata) isEmbeddedAssembly(name string) bool {
+	embeddedName := strings.ToLower(name) + ".dll"
+	for _, resource := range m.Resources {
+		resource = strings.ToLower(resource)
+		if resource == embeddedName || strings.HasSuffix(resource, "."+embeddedName) || strings.Contains(resource, "."+embeddedName+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// thirdPartyReferences lists the assembly's references that won't be on a target and that it doesn't bundle itself
+func (m assemblyMetadata) thirdPartyReferences() []string {
+	references := []string{}
+	for _, reference := range m.References {
+		if !isFrameworkAssembly(reference) && !m.isEmbeddedAssembly(reference) && !slices.Contains(references, reference) {
+			references = append(references, reference)
+		}
+	}
+	return references
+}
+
+// describeAssemblyDependencies is a line per third party reference
+func describeAssemblyDependencies(references []string) string {
+	lines := []string{}
+	for _, reference := range references {
+		lines = append(lines, fmt.Sprintf("  - %s.dll", reference))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkAssemblyDependencies refuses to task an assembly that would fail with a FileNotFoundException on the target
+// because it references DLLs that aren't part of the .NET Framework and aren't embedded in it
+func checkAssemblyDependencies(contents []byte, name string) error {
+	metadata, err := inspectAssembly(contents)
+	if err != nil {
+		return err
+	}
+	references := metadata.thirdPartyReferences()
+	if len(references) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s would fail with a FileNotFoundException on the target\n%s\nMerge them into the assembly (ex: with ILMerge or Costura.Fody) and add it with forge_create, or set %s to assembly names that are already on targets to allow them",
+		missingAssemblyDependenciesError, name, describeAssemblyDependencies(references), allowedAssemblyReferencesEnv)
+}
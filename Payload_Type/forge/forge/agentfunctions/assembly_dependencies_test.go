@@ -0,0 +1,44 @@
+package agentfunctions
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestThirdPartyReferences(t *testing.T) {
+	metadata, err := inspectAssembly(testAssembly("Seatbelt", "mscorlib", "System.Core", "System.Management.Automation",
+		"Newtonsoft.Json", "System.Text.Json", "CommandLine", "Fody.Embedded"))
+	if err != nil {
+		t.Fatalf("failed to inspect the test assembly: %v", err)
+	}
+	if len(metadata.References) != 7 {
+		t.Fatalf("expected every AssemblyRef to be read, got %v", metadata.References)
+	}
+	metadata.Resources = []string{"costura.fody.embedded.dll.compressed", "Seatbelt.Properties.Resources.resources"}
+	expected := []string{"Newtonsoft.Json", "System.Text.Json", "CommandLine"}
+	if references := metadata.thirdPartyReferences(); !slices.Equal(references, expected) {
+		t.Fatalf("expected %v, got %v", expected, references)
+	}
+	t.Setenv(allowedAssemblyReferencesEnv, "commandline, Other")
+	expected = []string{"Newtonsoft.Json", "System.Text.Json"}
+	if references := metadata.thirdPartyReferences(); !slices.Equal(references, expected) {
+		t.Fatalf("expected %v to be allowed, got %v", allowedAssemblyReferencesEnv, references)
+	}
+}
+
+func TestCheckAssemblyDependencies(t *testing.T) {
+	if err := checkAssemblyDependencies(testAssembly("Seatbelt", "mscorlib", "System"), "Seatbelt.exe"); err != nil {
+		t.Fatalf("expected an assembly that only uses the framework to be allowed, got %v", err)
+	}
+	err := checkAssemblyDependencies(testAssembly("Tool", "mscorlib", "Newtonsoft.Json", "CommandLine"), "Tool.exe")
+	if !errors.Is(err, missingAssemblyDependenciesError) {
+		t.Fatalf("expected third party references to be refused, got %v", err)
+	}
+	for _, expected := range []string{"Tool.exe", "  - Newtonsoft.Json.dll", "  - CommandLine.dll", "ILMerge"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected the error to contain %q, got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+var assemblyRandomizationError = errors.New("failed to randomize the assembly's metadata")
+
+// PE header fields that get rewritten, as offsets from the start of the optional header or a section header
+const (
+	optionalHeaderSectionAlignment = 32
+	optionalHeaderFileAlignment    = 36
+	optionalHeaderSizeOfImage      = 56
+	optionalHeaderCheckSum         = 64
+	optionalHeaderDataDirectory32  = 96
+	optionalHeaderDataDirectory64  = 112
+	sectionHeaderSize              = 40
+	sectionVirtualSize             = 8
+	sectionSizeOfRawData           = 16
+	debugDirectoryEntrySize        = 28
+)
+
+// randomizedAssembly is a per-task copy of an assembly with new names and MVID so it doesn't match the public build
+type randomizedAssembly struct {
+	Contents     []byte
+	OriginalName string
+	Name         string
+	ModuleName   string
+	MVID         string
+	SHA256       string
+}
+
+// randomIdentifier makes a random name that's valid as both an assembly and file name, ex: Kqvhtwza
+func randomIdentifier() string {
+	random := make([]byte, 13)
+	rand.Read(random)
+	name := make([]byte, 6+int(random[0])%7)
+	for i := range name {
+		name[i] = 'a' + random[i+1]%26
+	}
+	name[0] -= 'a' - 'A'
+	return string(name)
+}
+
+// formatGUID prints a GUID the way .NET does, with the first three groups stored little endian
+func formatGUID(guid []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x", binary.LittleEndian.Uint32(guid), binary.LittleEndian.Uint16(guid[4:]),
+		binary.LittleEndian.Uint16(guid[6:]), guid[8:10], guid[10:16])
+}
+
+// stringReferences returns every #Strings index in the metadata tables along with where it's stored
+func (m *metadataTables) stringReferences() map[int]uint32 {
+	references := map[int]uint32{}
+	for table := 0; table < metadataTableCount; table++ {
+		for column, columnType := range metadataSchema[table] {
+			if columnType.heap != 's' {
+				continue
+			}
+			for row := uint32(1); row <= m.rows[table]; row++ {
+				references[m.cellOffset(table, row, column)] = m.cell(table, row, column)
+			}
+		}
+	}
+	return references
+}
+
+func (m *metadataTables) setCell(table int, row uint32, column int, value uint32) {
+	offset := m.cellOffset(table, row, column)
+	if m.columnWidth(metadataSchema[table][column]) == 2 {
+		binary.LittleEndian.PutUint16(m.tables[offset:], uint16(value))
+	} else {
+		binary.LittleEndian.PutUint32(m.tables[offset:], value)
+	}
+}
+
+// rvaToFileOffset maps a relative virtual address to where it's stored in the file
+func rvaToFileOffset(peFile *pe.File, rva uint32) (int, error) {
+	for _, section := range peFile.Sections {
+		if rva >= section.VirtualAddress && rva < section.VirtualAddress+section.Size {
+			return int(section.Offset + rva - section.VirtualAddress), nil
+		}
+	}
+	return 0, fmt.Errorf("no section contains 0x%x", rva)
+}
+
+// peChecksum calculates the optional header's CheckSum, skipping over the CheckSum field itself
+func peChecksum(image []byte, checksumOffset int) uint32 {
+	sum := uint64(0)
+	for i := 0; i < len(image); i += 2 {
+		if i == checksumOffset || i == checksumOffset+2 {
+			continue
+		}
+		word := uint64(image[i])
+		if i+1 < len(image) {
+			word |= uint64(image[i+1]) << 8
+		}
+		sum += word
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	sum = (sum & 0xFFFF) + (sum >> 16)
+	return uint32(sum) + uint32(len(image))
+}
+
+func alignUp(value uint32, alignment uint32) uint32 {
+	if alignment == 0 {
+		return value
+	}
+	return (value + alignment - 1) / alignment * alignment
+}
+
+// randomizeAssembly gives an assembly a new random assembly name, module name, and MVID, and strips its debug
+// directory so the PDB path is gone. The new names don't fit in the original #Strings heap, so the metadata is
+// rebuilt with them appended and moved to the end of the last section, and the original metadata is zeroed out.
+// Any Authenticode signature is dropped since it no longer matches.
+func randomizeAssembly(contents []byte) (randomizedAssembly, error) {
+	result := randomizedAssembly{}
+	original, err := inspectAssembly(contents)
+	if err != nil {
+		return result, err
+	}
+	result.OriginalName = original.Name
+	peFile, err := pe.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return result, fmt.Errorf("%w: %s", assemblyRandomizationError, err.Error())
+	}
+	defer peFile.Close()
+	image := bytes.Clone(contents)
+	optionalHeaderOffset := int(binary.LittleEndian.Uint32(image[0x3c:])) + 24
+	dataDirectoryOffset := optionalHeaderOffset + optionalHeaderDataDirectory32
+	if _, ok := peFile.OptionalHeader.(*pe.OptionalHeader64); ok {
+		dataDirectoryOffset = optionalHeaderOffset + optionalHeaderDataDirectory64
+	}
+	sectionTableOffset := optionalHeaderOffset + int(peFile.FileHeader.SizeOfOptionalHeader)
+
+	clrHeaderOffset, err := rvaToFileOffset(peFile, clrDirectory(peFile).VirtualAddress)
+	if err != nil {
+		return result, fmt.Errorf("%w: %s", assemblyRandomizationError, err.Error())
+	}
+	metadataOffset, err := rvaToFileOffset(peFile, binary.LittleEndian.Uint32(image[clrHeaderOffset+8:]))
+	if err != nil {
+		return result, fmt.Errorf("%w: %s", assemblyRandomizationError, err.Error())
+	}
+	metadataRoot := bytes.Clone(image[metadataOffset : metadataOffset+int(binary.LittleEndian.Uint32(image[clrHeaderOffset+12:]))])
+	_, streams, err := readMetadataStreams(metadataRoot)
+	if err != nil {
+		return result, fmt.Errorf("%w: %s", assemblyRandomizationError, err.Error())
+	}
+	streamData := map[string][]byte{}
+	for _, stream := range streams {
+		streamData[stream.name] = metadataRoot[stream.offset : stream.offset+stream.size]
+	}
+	tableStreamName := "#~"
+	if _, ok := streamData[tableStreamName]; !ok {
+		tableStreamName = "#-"
+	}
+	tables, err := parseMetadataTables(streamData[tableStreamName], streamData["#Strings"], streamData["#Blob"])
+	if err != nil {
+		return result, fmt.Errorf("%w: %s", assemblyRandomizationError, err.Error())
+	}
+
+	// append the new names to #Strings and point the Assembly and Module rows at them
+	stringsHeap := streamData["#Strings"]
+	assemblyNameIndex := tables.cell(tableAssembly, 1, 7)
+	moduleNameIndex := tables.cell(tableModule, 1, 1)
+	result.Name = randomIdentifier()
+	result.ModuleName = result.Name + path.Ext(tables.string(moduleNameIndex))
+	newAssemblyNameIndex := uint32(len(stringsHeap))
+	newModuleNameIndex := newAssemblyNameIndex + uint32(len(result.Name)) + 1
+	newStringsHeap := append(bytes.Clone(stringsHeap), []byte(result.Name+"\x00"+result.ModuleName+"\x00")...)
+	newStringsHeap = append(newStringsHeap, make([]byte, alignUp(uint32(len(newStringsHeap)), 4)-uint32(len(newStringsHeap)))...)
+	if tables.heapSizes&0x01 == 0 && len(newStringsHeap) > 0xFFFF {
+		return result, fmt.Errorf("%w: the #Strings heap is too large to add names to", assemblyRandomizationError)
+	}
+	assemblyNameCell := tables.cellOffset(tableAssembly, 1, 7)
+	moduleNameCell := tables.cellOffset(tableModule, 1, 1)
+	references := tables.stringReferences()
+	// the original names are zeroed when nothing else still uses their bytes, ex: a namespace with the same name, or a
+	// longer identifier that the compiler merged them into as a shared suffix
+	for _, oldIndex := range []uint32{assemblyNameIndex, moduleNameIndex} {
+		oldLength := uint32(len(tables.string(oldIndex)))
+		inUse := false
+		for cellOffset, index := range references {
+			if cellOffset != assemblyNameCell && cellOffset != moduleNameCell && index < oldIndex+oldLength &&
+				index+uint32(len(tables.string(index))) > oldIndex {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			clear(newStringsHeap[oldIndex : oldIndex+oldLength])
+		}
+	}
+	tables.tables = bytes.Clone(streamData[tableStreamName])
+	tables.setCell(tableAssembly, 1, 7, newAssemblyNameIndex)
+	tables.setCell(tableModule, 1, 1, newModuleNameIndex)
+
+	// replace the MVID with a random version 4 GUID
+	newGUIDHeap := bytes.Clone(streamData["#GUID"])
+	mvidIndex := tables.cell(tableModule, 1, 2)
+	if mvidIndex == 0 || int(mvidIndex)*16 > len(newGUIDHeap) {
+		return result, fmt.Errorf("%w: the module doesn't have an MVID", assemblyRandomizationError)
+	}
+	mvid := newGUIDHeap[(mvidIndex-1)*16 : mvidIndex*16]
+	rand.Read(mvid)
+	mvid[7] = mvid[7]&0x0F | 0x40
+	mvid[8] = mvid[8]&0x3F | 0x80
+	result.MVID = formatGUID(mvid)
+
+	// rebuild the metadata with the streams in their original order
+	newStreams := map[string][]byte{tableStreamName: tables.tables, "#Strings": newStringsHeap, "#GUID": newGUIDHeap}
+	sortedStreams := slices.Clone(streams)
+	slices.SortFunc(sortedStreams, func(a, b metadataStream) int { return int(a.offset) - int(b.offset) })
+	headerEnd := uint32(len(metadataRoot))
+	for _, stream := range streams {
+		headerEnd = min(headerEnd, stream.offset)
+	}
+	newMetadata := bytes.Clone(metadataRoot[:headerEnd])
+	for _, stream := range sortedStreams {
+		data, ok := newStreams[stream.name]
+		if !ok {
+			data = streamData[stream.name]
+		}
+		newMetadata = append(newMetadata, make([]byte, alignUp(uint32(len(newMetadata)), 4)-uint32(len(newMetadata)))...)
+		binary.LittleEndian.PutUint32(newMetadata[stream.headerOffset:], uint32(len(newMetadata)))
+		binary.LittleEndian.PutUint32(newMetadata[stream.headerOffset+4:], uint32(len(data)))
+		newMetadata = append(newMetadata, data...)
+	}
+	clear(image[metadataOffset : metadataOffset+len(metadataRoot)])
+
+	// strip the debug directory along with the CodeView data that has the PDB path
+	debugDirectory := dataDirectoryOffset + pe.IMAGE_DIRECTORY_ENTRY_DEBUG*8
+	if debugRVA, debugSize := binary.LittleEndian.Uint32(image[debugDirectory:]), binary.LittleEndian.Uint32(image[debugDirectory+4:]); debugRVA != 0 {
+		debugOffset, err := rvaToFileOffset(peFile, debugRVA)
+		if err != nil || debugOffset+int(debugSize) > len(image) {
+			return result, fmt.Errorf("%w: the debug directory is corrupt", assemblyRandomizationError)
+		}
+		for entry := debugOffset; entry+debugDirectoryEntrySize <= debugOffset+int(debugSize); entry += debugDirectoryEntrySize {
+			dataSize := int(binary.LittleEndian.Uint32(image[entry+16:]))
+			dataOffset := int(binary.LittleEndian.Uint32(image[entry+24:]))
+			if dataOffset > 0 && dataOffset+dataSize <= len(image) {
+				clear(image[dataOffset : dataOffset+dataSize])
+			}
+		}
+		clear(image[debugOffset : debugOffset+int(debugSize)])
+		clear(image[debugDirectory : debugDirectory+8])
+	}
+	securityDirectory := dataDirectoryOffset + pe.IMAGE_DIRECTORY_ENTRY_SECURITY*8
+	clear(image[securityDirectory : securityDirectory+8])
+
+	// move the new metadata to the end of the last section, which also drops anything appended after it
+	lastSection := 0
+	for i, section := range peFile.Sections {
+		if section.Offset > peFile.Sections[lastSection].Offset {
+			lastSection = i
+		}
+	}
+	section := peFile.Sections[lastSection]
+	for _, other := range peFile.Sections {
+		if other.VirtualAddress > section.VirtualAddress {
+			return result, fmt.Errorf("%w: the sections aren't laid out in order", assemblyRandomizationError)
+		}
+	}
+	if section.Characteristics&pe.IMAGE_SCN_MEM_READ == 0 {
+		return result, fmt.Errorf("%w: the last section isn't readable", assemblyRandomizationError)
+	}
+	if uint64(section.Offset)+uint64(section.Size) > uint64(len(image)) {
+		return result, fmt.Errorf("%w: the last section is truncated", assemblyRandomizationError)
+	}
+	fileAlignment := binary.LittleEndian.Uint32(image[optionalHeaderOffset+optionalHeaderFileAlignment:])
+	sectionAlignment := binary.LittleEndian.Uint32(image[optionalHeaderOffset+optionalHeaderSectionAlignment:])
+	metadataStart := alignUp(max(section.VirtualSize, section.Size), 4)
+	virtualSize := metadataStart + uint32(len(newMetadata))
+	rawSize := alignUp(virtualSize, fileAlignment)
+	image = append(image[:section.Offset+section.Size], make([]byte, rawSize-section.Size)...)
+	copy(image[section.Offset+metadataStart:], newMetadata)
+	sectionHeader := sectionTableOffset + lastSection*sectionHeaderSize
+	binary.LittleEndian.PutUint32(image[sectionHeader+sectionVirtualSize:], virtualSize)
+	binary.LittleEndian.PutUint32(image[sectionHeader+sectionSizeOfRawData:], rawSize)
+	binary.LittleEndian.PutUint32(image[optionalHeaderOffset+optionalHeaderSizeOfImage:], alignUp(section.VirtualAddress+virtualSize, sectionAlignment))
+	binary.LittleEndian.PutUint32(image[clrHeaderOffset+8:], section.VirtualAddress+metadataStart)
+	binary.LittleEndian.PutUint32(image[clrHeaderOffset+12:], uint32(len(newMetadata)))
+	checksumOffset := optionalHeaderOffset + optionalHeaderCheckSum
+	binary.LittleEndian.PutUint32(image[checksumOffset:], peChecksum(image, checksumOffset))
+
+	randomized, err := inspectAssembly(image)
+	if err != nil {
+		return result, fmt.Errorf("%w: %s", assemblyRandomizationError, err.Error())
+	}
+	if randomized.Name != result.Name || randomized.EntryPoint != original.EntryPoint ||
+		!slices.Equal(randomized.References, original.References) || !slices.Equal(randomized.Resources, original.Resources) {
+		return result, fmt.Errorf("%w: the rewritten assembly doesn't match", assemblyRandomizationError)
+	}
+	result.Contents = image
+	hash := sha256.Sum256(image)
+	result.SHA256 = hex.EncodeToString(hash[:])
+	return result, nil
+}
+
+// uploadRandomizedAssembly registers a randomized copy of an assembly with Mythic for just this task and records its
+// new name, MVID, and hash in the task's output so the file that ran can be matched up later
+func uploadRandomizedAssembly(taskData *agentstructs.PTTaskMessageAllData, contents []byte, name string, assemblyVersion string) (string, error) {
+	randomized, err := randomizeAssembly(contents)
+	if err != nil {
+		return "", err
+	}
+	uploadResponse, err := mythicrpc.SendMythicRPCFileCreate(mythicrpc.MythicRPCFileCreateMessage{
+		TaskID:       taskData.Task.ID,
+		Filename:     randomized.ModuleName,
+		Comment:      fmt.Sprintf("Randomized %s.exe version %s, sha256 %s", name, assemblyVersion, randomized.SHA256),
+		FileContents: randomized.Contents,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !uploadResponse.Success {
+		return "", errors.New(uploadResponse.Error)
+	}
+	mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+		TaskID: taskData.Task.ID,
+		Response: []byte(fmt.Sprintf("[*] Randomized %s.exe as %s (assembly %s, MVID %s)\n[*] sha256 %s\n",
+			name, randomized.ModuleName, randomized.Name, randomized.MVID, randomized.SHA256)),
+	})
+	return uploadResponse.AgentFileID, nil
+}
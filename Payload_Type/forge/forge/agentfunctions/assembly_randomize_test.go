@@ -0,0 +1,72 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestRandomizeAssembly(t *testing.T) {
+	original := testAssembly("Seatbelt")
+	randomized, err := randomizeAssembly(original)
+	if err != nil {
+		t.Fatalf("expected the assembly to be randomized, got %v", err)
+	}
+	if randomized.OriginalName != "Seatbelt" || randomized.Name == "Seatbelt" || randomized.ModuleName != randomized.Name+".exe" {
+		t.Fatalf("unexpected names: %+v", randomized)
+	}
+	metadata, err := inspectAssembly(randomized.Contents)
+	if err != nil {
+		t.Fatalf("expected the randomized assembly to parse, got %v", err)
+	}
+	// the namespace shares the assembly name's string, so it has to survive the rename
+	if metadata.Name != randomized.Name || metadata.EntryPoint != "Seatbelt.Program.Main" {
+		t.Fatalf("unexpected randomized metadata: %+v", metadata)
+	}
+	for _, removed := range []string{"Seatbelt.exe", "Seatbelt.pdb", "RSDS", "0123456789abcdef"} {
+		if bytes.Contains(randomized.Contents, []byte(removed)) {
+			t.Fatalf("expected %q to be removed from the randomized assembly", removed)
+		}
+	}
+	hash := sha256.Sum256(randomized.Contents)
+	if randomized.SHA256 != hex.EncodeToString(hash[:]) || len(randomized.MVID) != 36 {
+		t.Fatalf("unexpected hash or MVID: %+v", randomized)
+	}
+	again, err := randomizeAssembly(original)
+	if err != nil || again.SHA256 == randomized.SHA256 || again.MVID == randomized.MVID {
+		t.Fatalf("expected every randomization to be unique, got %+v: %v", again, err)
+	}
+	if !bytes.Equal(original, testAssembly("Seatbelt")) {
+		t.Fatalf("expected the original assembly to be left alone")
+	}
+}
+
+func TestRandomizeAssemblyKeepsSharedStrings(t *testing.T) {
+	// the module name, Seatbelt.exe, is stored inside the reference's name as a shared suffix
+	randomized, err := randomizeAssembly(testAssembly("Seatbelt", "Lib.Seatbelt.exe"))
+	if err != nil {
+		t.Fatalf("expected the assembly to be randomized, got %v", err)
+	}
+	metadata, err := inspectAssembly(randomized.Contents)
+	if err != nil {
+		t.Fatalf("expected the randomized assembly to parse, got %v", err)
+	}
+	if len(metadata.References) != 1 || metadata.References[0] != "Lib.Seatbelt.exe" {
+		t.Fatalf("expected the reference sharing the module name's bytes to survive, got %v", metadata.References)
+	}
+}
+
+func TestRandomizeAssemblyRejectsTruncatedFiles(t *testing.T) {
+	original := testAssembly("Seatbelt")
+	if _, err := randomizeAssembly(original[:len(original)-0x100]); !errors.Is(err, assemblyRandomizationError) {
+		t.Fatalf("expected an assembly with a truncated last section to be rejected, got %v", err)
+	}
+}
+
+func TestRandomizeAssemblyRejectsNativeFiles(t *testing.T) {
+	if _, err := randomizeAssembly(nativePE()); !errors.Is(err, notDotNetAssemblyError) {
+		t.Fatalf("expected a native executable to be rejected, got %v", err)
+	}
+}
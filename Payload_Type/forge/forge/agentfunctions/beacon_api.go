@@ -0,0 +1,160 @@
+package agentfunctions
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+const beaconAPIActionWarn = "warn"
+const beaconAPIActionBlock = "block"
+
+const beaconAPIStatusCompatible = "compatible"
+const beaconAPIStatusMissing = "missing"
+const beaconAPIStatusUnknown = "unknown"
+
+var unsupportedBeaconAPIError = errors.New("bof uses Beacon API functions this agent's loader doesn't support")
+
+// bofAgentCompatibility is how well a single agent's bof loader covers the Beacon API functions a bof imports
+type bofAgentCompatibility struct {
+	Agent   string   `json:"agent"`
+	Status  string   `json:"status"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// loaderResolvedImports are the Win32 functions bofs commonly import without a LIBRARY$ prefix. Bof loaders resolve
+// these from kernel32 themselves, so they aren't part of the Beacon API an agent has to declare.
+var loaderResolvedImports = []string{"LoadLibraryA", "GetModuleHandleA", "GetProcAddress", "FreeLibrary"}
+
+// beaconAPIImports filters an object file's imports down to the functions the bof loader has to provide. Everything
+// else is a LIBRARY$Function import that's resolved from the target's own DLLs, or one of loaderResolvedImports.
+func beaconAPIImports(imports []string) []string {
+	beaconImports := []string{}
+	for _, name := range imports {
+		if !strings.Contains(name, "$") && !slices.Contains(loaderResolvedImports, name) {
+			beaconImports = append(beaconImports, name)
+		}
+	}
+	return beaconImports
+}
+
+// declaresBeaconAPI reports if the agent lists the Beacon API functions its loader supports. Agents that don't are
+// assumed to support everything so existing payload_type_support.json files keep working.
+func (agent agentDefinition) declaresBeaconAPI() bool {
+	return len(agent.BofBeaconAPI) > 0
+}
+
+// missingBeaconAPI returns the Beacon API functions in imports that the agent's loader doesn't support, "bof_beacon_api"
+// entries can be glob patterns (ex: BeaconFormat*)
+func (agent agentDefinition) missingBeaconAPI(imports []string) []string {
+	missing := []string{}
+	if !agent.declaresBeaconAPI() {
+		return missing
+	}
+	for _, name := range beaconAPIImports(imports) {
+		supported := false
+		for _, pattern := range agent.BofBeaconAPI {
+			if matched, err := path.Match(pattern, name); err == nil && matched {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// readBofImports parses every object file of a downloaded bof, returning the functions imported for each architecture.
+// Aliases are skipped since they don't run through the bof loader.
+func readBofImports(commandSource collectionSourceCommandData, collectionSourceData collectionSource) (map[string][]string, error) {
+	commandDefinitions, err := loadBofCommandDefinitions(commandSource, collectionSourceData)
+	if err != nil {
+		return nil, err
+	}
+	bofCommandFolder := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSource.CommandName)
+	imports := make(map[string][]string)
+	for _, commandDefinition := range commandDefinitions {
+		if commandDefinition.alias {
+			continue
+		}
+		for _, file := range commandDefinition.Files {
+			contents, err := readStoredFile(filepath.Join(bofCommandFolder, file.Path))
+			if err != nil {
+				return nil, err
+			}
+			object, _, err := inspectCOFF(contents)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file.Path, err)
+			}
+			imports[file.Arch] = append(imports[file.Arch], object.Imports...)
+		}
+	}
+	for arch := range imports {
+		slices.Sort(imports[arch])
+		imports[arch] = slices.Compact(imports[arch])
+	}
+	return imports, nil
+}
+
+// getBofCompatibility compares a downloaded bof's imports against every agent that can run bofs
+func getBofCompatibility(commandSource collectionSourceCommandData, collectionSourceData collectionSource, agents []agentDefinition) []bofAgentCompatibility {
+	importsByArch, err := forgeRegistry.getBofImports(commandSource, collectionSourceData)
+	if err != nil || len(importsByArch) == 0 {
+		// aliases don't have any object files to check
+		return nil
+	}
+	imports := []string{}
+	for _, archImports := range importsByArch {
+		imports = append(imports, archImports...)
+	}
+	slices.Sort(imports)
+	imports = slices.Compact(imports)
+	compatibility := []bofAgentCompatibility{}
+	for _, agent := range agents {
+		if agent.BofCommand == "" {
+			continue
+		}
+		result := bofAgentCompatibility{Agent: agent.Agent, Status: beaconAPIStatusUnknown}
+		if agent.declaresBeaconAPI() {
+			result.Status = beaconAPIStatusCompatible
+			if result.Missing = agent.missingBeaconAPI(imports); len(result.Missing) > 0 {
+				result.Status = beaconAPIStatusMissing
+			}
+		}
+		compatibility = append(compatibility, result)
+	}
+	return compatibility
+}
+
+// checkBeaconAPICompatibility is run when a bof is tasked with the object file that's about to be sent to the
+// callback. Missing functions fail the task unless the agent's "bof_unsupported_api_action" is warn.
+func checkBeaconAPICompatibility(taskData *agentstructs.PTTaskMessageAllData, agent agentDefinition, objectFile []byte) error {
+	if !agent.declaresBeaconAPI() {
+		return nil
+	}
+	object, _, err := inspectCOFF(objectFile)
+	if err != nil {
+		return err
+	}
+	missing := agent.missingBeaconAPI(object.Imports)
+	if len(missing) == 0 {
+		return nil
+	}
+	if agent.BofUnsupportedAPIAction == beaconAPIActionWarn {
+		mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+			TaskID: taskData.Task.ID,
+			Response: []byte(fmt.Sprintf("[!] %s's bof loader doesn't support %s, the bof might crash or fail\n",
+				agent.Agent, strings.Join(missing, ", "))),
+		})
+		return nil
+	}
+	return fmt.Errorf("%w: %s doesn't support %s", unsupportedBeaconAPIError, agent.Agent, strings.Join(missing, ", "))
+}
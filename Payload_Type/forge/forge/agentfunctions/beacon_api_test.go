@@ -0,0 +1,43 @@
+package agentfunctions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBofCompatibility(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	objectPath := filepath.Join(".", PayloadTypeName, "collections", "Bench", "bof-0", "bof-0.x64.o")
+	os.WriteFile(objectPath, testCoffObject(t, "amd64"), 0644)
+	agents := []agentDefinition{
+		{Agent: "full", BofCommand: "bof", BofBeaconAPI: []string{"BeaconPrintf", "BeaconOutput"}},
+		{Agent: "partial", BofCommand: "bof", BofBeaconAPI: []string{"BeaconOutput", "BeaconFormat*"}},
+		{Agent: "undeclared", BofCommand: "bof"},
+		{Agent: "assemblies_only", ExecuteAssemblyCommand: "execute_assembly"},
+	}
+	compatibility := getBofCompatibility(commandSource, source, agents)
+	expected := []bofAgentCompatibility{
+		{Agent: "full", Status: beaconAPIStatusCompatible, Missing: []string{}},
+		{Agent: "partial", Status: beaconAPIStatusMissing, Missing: []string{"BeaconPrintf"}},
+		{Agent: "undeclared", Status: beaconAPIStatusUnknown},
+	}
+	if !slices.EqualFunc(compatibility, expected, func(a bofAgentCompatibility, b bofAgentCompatibility) bool {
+		return a.Agent == b.Agent && a.Status == b.Status && slices.Equal(a.Missing, b.Missing)
+	}) {
+		t.Fatalf("expected %+v, got %+v", expected, compatibility)
+	}
+	if err := checkBeaconAPICompatibility(nil, agents[1], testCoffObject(t, "amd64")); !errors.Is(err, unsupportedBeaconAPIError) {
+		t.Fatalf("expected tasking a bof with a missing function to be blocked, got %v", err)
+	}
+	if err := checkBeaconAPICompatibility(nil, agents[2], testCoffObject(t, "amd64")); err != nil {
+		t.Fatalf("expected agents that don't declare their Beacon API to allow everything, got %v", err)
+	}
+	if missing := agents[1].missingBeaconAPI([]string{"BeaconFormatAlloc", "KERNEL32$GetLastError", "LoadLibraryA", "GetProcAddress"}); len(missing) != 0 {
+		t.Fatalf("expected glob patterns to match and library and loader resolved imports to be ignored, got %v", missing)
+	}
+}
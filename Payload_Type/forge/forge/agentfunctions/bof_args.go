@@ -0,0 +1,201 @@
+package agentfunctions
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var bofUsageError = errors.New("invalid arguments")
+
+// splitCommandLine splits a command line into words the way a shell would, except backslashes outside of quotes are
+// kept as is so Windows paths (ex: \\server\share) don't have to be escaped. Inside double quotes, \" and \\ are escapes.
+func splitCommandLine(input string) ([]string, error) {
+	words := []string{}
+	current := strings.Builder{}
+	inWord := false
+	var quote rune
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
+
+// bofArgumentTypeName is how an extension.json argument type is shown in usage messages
+func bofArgumentTypeName(argType string) string {
+	switch argType {
+	case "int", "integer", "i":
+		return "int"
+	case "short", "s":
+		return "short"
+	case "file", "b":
+		return "file"
+	case "wstring", "Z":
+		return "wstring"
+	default:
+		return "string"
+	}
+}
+
+// bofArgumentUsage builds a usage message from the extension.json arguments, in the order they're passed to the bof
+func bofArgumentUsage(commandName string, arguments []bofCommandDefinitionArguments) string {
+	usage := strings.Builder{}
+	usage.WriteString("usage: " + commandName)
+	for _, arg := range arguments {
+		if arg.Optional {
+			usage.WriteString(fmt.Sprintf(" [%s]", arg.Name))
+		} else {
+			usage.WriteString(fmt.Sprintf(" <%s>", arg.Name))
+		}
+	}
+	for _, arg := range arguments {
+		usage.WriteString(fmt.Sprintf("\n  %s (%s", arg.Name, bofArgumentTypeName(arg.Type)))
+		if arg.Optional {
+			usage.WriteString(", optional")
+			if arg.Default != nil {
+				usage.WriteString(fmt.Sprintf(", default %v", arg.Default))
+			}
+		}
+		usage.WriteString(")")
+		if arg.Description != "" {
+			usage.WriteString(": " + arg.Description)
+		}
+	}
+	return usage.String()
+}
+
+// convertBofArgument converts a command line word to the value Mythic expects for the argument's parameter type,
+// numbers are float64 like they would be coming from JSON. Numbers with context variables (ex: {{callback.pid}}) are
+// left as strings until the task is created and the variables can be expanded.
+func convertBofArgument(arg bofCommandDefinitionArguments, value string) (interface{}, error) {
+	if strings.Contains(value, "{{") && (bofArgumentTypeName(arg.Type) == "int" || bofArgumentTypeName(arg.Type) == "short") {
+		return value, nil
+	}
+	switch bofArgumentTypeName(arg.Type) {
+	case "int":
+		number, err := strconv.ParseInt(value, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a 32-bit integer, got %q", arg.Name, value)
+		}
+		return float64(number), nil
+	case "short":
+		number, err := strconv.ParseInt(value, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a 16-bit integer, got %q", arg.Name, value)
+		}
+		return float64(number), nil
+	default:
+		return value, nil
+	}
+}
+
+// parseBofArgString parses positional and -name value arguments for a generated bof command. Named arguments can
+// appear anywhere, and every other word fills the next argument that hasn't been set yet in extension.json order.
+// Optional arguments that aren't given are left out so their defaults apply.
+func parseBofArgString(commandName string, arguments []bofCommandDefinitionArguments, input string) (map[string]interface{}, error) {
+	words, err := splitCommandLine(input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s\n%s", bofUsageError, err.Error(), bofArgumentUsage(commandName, arguments))
+	}
+	return parseBofArgWords(commandName, arguments, words, true)
+}
+
+// parseBofArgWords is parseBofArgString for a command line that's already split. Without requireAll, missing required
+// arguments are left out too (ex: a preset fills them in).
+func parseBofArgWords(commandName string, arguments []bofCommandDefinitionArguments, words []string, requireAll bool) (map[string]interface{}, error) {
+	usageError := func(message string) error {
+		return fmt.Errorf("%w: %s\n%s", bofUsageError, message, bofArgumentUsage(commandName, arguments))
+	}
+	var err error
+	values := make(map[string]interface{})
+	rawValues := make(map[string]string)
+	positional := []string{}
+	for i := 0; i < len(words); i++ {
+		if words[i] == "--" {
+			// everything after -- is positional, even if it looks like an argument name
+			positional = append(positional, words[i+1:]...)
+			break
+		}
+		argIndex := -1
+		if strings.HasPrefix(words[i], "-") {
+			for j, arg := range arguments {
+				if strings.EqualFold(strings.TrimPrefix(words[i], "-"), arg.Name) {
+					argIndex = j
+					break
+				}
+			}
+		}
+		if argIndex < 0 {
+			positional = append(positional, words[i])
+			continue
+		}
+		if i+1 >= len(words) {
+			return nil, usageError(fmt.Sprintf("%s needs a value", words[i]))
+		}
+		i++
+		rawValues[arguments[argIndex].Name] = words[i]
+	}
+	for _, arg := range arguments {
+		if len(positional) == 0 {
+			break
+		}
+		if _, ok := rawValues[arg.Name]; ok {
+			continue
+		}
+		rawValues[arg.Name] = positional[0]
+		positional = positional[1:]
+	}
+	if len(positional) > 0 {
+		return nil, usageError(fmt.Sprintf("too many arguments: %s", strings.Join(positional, " ")))
+	}
+	for _, arg := range arguments {
+		rawValue, ok := rawValues[arg.Name]
+		if !ok {
+			if !arg.Optional && requireAll {
+				return nil, usageError(fmt.Sprintf("missing %s", arg.Name))
+			}
+			continue
+		}
+		if values[arg.Name], err = convertBofArgument(arg, rawValue); err != nil {
+			return nil, usageError(err.Error())
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,55 @@
+package agentfunctions
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	words, err := splitCommandLine(`\\server\share "domain user" 'it''s' "say \"hi\"" C:\Temp\`)
+	expected := []string{`\\server\share`, "domain user", "its", `say "hi"`, `C:\Temp\`}
+	if err != nil || !slices.Equal(words, expected) {
+		t.Fatalf("expected %q, got %q: %v", expected, words, err)
+	}
+	if _, err = splitCommandLine(`"unterminated`); err == nil {
+		t.Fatalf("expected an unterminated quote to fail")
+	}
+}
+
+func TestParseBofArgString(t *testing.T) {
+	arguments := []bofCommandDefinitionArguments{
+		{Name: "share", Description: "UNC path of the share", Type: "Z"},
+		{Name: "user", Type: "z", Optional: true},
+		{Name: "count", Type: "i", Optional: true, Default: 5},
+		{Name: "flags", Type: "s", Optional: true},
+	}
+	tests := []struct {
+		input    string
+		expected map[string]interface{}
+	}{
+		{`\\server\share`, map[string]interface{}{"share": `\\server\share`}},
+		{`\\server\share admin 10 0x10`, map[string]interface{}{"share": `\\server\share`, "user": "admin", "count": float64(10), "flags": float64(16)}},
+		{`-count 3 \\server\share -USER "domain admin"`, map[string]interface{}{"share": `\\server\share`, "user": "domain admin", "count": float64(3)}},
+		{`\\server\share -- -user`, map[string]interface{}{"share": `\\server\share`, "user": "-user"}},
+		{`\\server\share admin -5`, map[string]interface{}{"share": `\\server\share`, "user": "admin", "count": float64(-5)}},
+		{`\\server\share -count {{callback.pid}}`, map[string]interface{}{"share": `\\server\share`, "count": "{{callback.pid}}"}},
+	}
+	for _, test := range tests {
+		values, err := parseBofArgString("forge_bof_test", arguments, test.input)
+		if err != nil || !maps.Equal(values, test.expected) {
+			t.Fatalf("%s: expected %v, got %v: %v", test.input, test.expected, values, err)
+		}
+	}
+	for _, input := range []string{"", `\\server\share admin notanumber`, `\\server\share admin 1 70000`, "a b c d e", "a -user"} {
+		_, err := parseBofArgString("forge_bof_test", arguments, input)
+		if !errors.Is(err, bofUsageError) || !strings.Contains(err.Error(), "usage: forge_bof_test <share> [user] [count] [flags]") {
+			t.Fatalf("%q: expected a usage error, got %v", input, err)
+		}
+		if !strings.Contains(err.Error(), "share (wstring): UNC path of the share") || !strings.Contains(err.Error(), "default 5") {
+			t.Fatalf("expected the usage to describe each argument, got %v", err)
+		}
+	}
+}
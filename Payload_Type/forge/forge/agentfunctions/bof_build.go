@@ -0,0 +1,317 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// BofBuildManifestFilename is the build manifest forge_build looks for at the root of a bof's source
+const BofBuildManifestFilename = "forge_build.json"
+
+const buildSourcesEnv = "FORGE_BUILD_SOURCES"
+const defaultBuildSourcesDirectory = "build_sources"
+const mingwX64Env = "FORGE_MINGW_X64"
+const mingwX86Env = "FORGE_MINGW_X86"
+const defaultMingwX64 = "x86_64-w64-mingw32-gcc"
+const defaultMingwX86 = "i686-w64-mingw32-gcc"
+const bofBuildTimeout = 2 * time.Minute
+
+var invalidBuildManifestError = errors.New("invalid build manifest")
+var bofBuildFailedError = errors.New("bof failed to compile")
+
+// bofCompilerFlags keep the object small and free of anything the object loader can't handle
+var bofCompilerFlags = []string{"-c", "-Os", "-Wall", "-fno-asynchronous-unwind-tables", "-fno-ident", "-fno-stack-protector"}
+
+var bofBuildDefine = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(=.*)?$`)
+
+// bofBuildArchSuffixes are the names used for each architecture's object file (ex: whoami.x64.o)
+var bofBuildArchSuffixes = map[string]string{
+	"amd64": "x64",
+	"386":   "x86",
+}
+
+// bofBuildManifest describes how to compile a bof's C source. Extension is an extension.json in the source to use for
+// the command, otherwise one is generated from Help, Entrypoint, and Arguments.
+type bofBuildManifest struct {
+	CommandName string                          `json:"command_name"`
+	Sources     []string                        `json:"sources"`
+	Arch        []string                        `json:"arch"`
+	Defines     []string                        `json:"defines"`
+	IncludeDirs []string                        `json:"include_dirs"`
+	Extension   string                          `json:"extension"`
+	Help        string                          `json:"help"`
+	Entrypoint  string                          `json:"entrypoint"`
+	Arguments   []bofCommandDefinitionArguments `json:"arguments"`
+}
+
+// bofBuildOutput is a single compiled object file
+type bofBuildOutput struct {
+	Arch     string
+	Filename string
+	Contents []byte
+}
+
+func getBuildSourcesDirectory() string {
+	if directory := os.Getenv(buildSourcesEnv); directory != "" {
+		return directory
+	}
+	return defaultBuildSourcesDirectory
+}
+
+// resolveBuildSourcePath makes sure a source path given to forge_build is inside the build sources folder
+func resolveBuildSourcePath(sourcePath string) (string, error) {
+	root, err := filepath.Abs(getBuildSourcesDirectory())
+	if err != nil {
+		return "", err
+	}
+	target := sourcePath
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	relativePath, err := filepath.Rel(root, filepath.Clean(target))
+	if err != nil || (relativePath != "." && !filepath.IsLocal(relativePath)) {
+		return "", fmt.Errorf("%s isn't inside the build sources folder %s", sourcePath, root)
+	}
+	if info, err := os.Stat(target); err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("%s isn't a folder", sourcePath)
+	}
+	return target, nil
+}
+
+// extractBuildSources unpacks an uploaded source archive, the files are left unencrypted so the compiler can read them
+func extractBuildSources(archiveName string, contents []byte, sourceDir string) error {
+	extractor := newArchiveExtractor(sourceDir)
+	extractor.plaintext = true
+	switch archiveFormatForName(archiveName) {
+	case archiveFormatZip:
+		return extractor.extractZip(contents)
+	case archiveFormatTarXz:
+		stream, err := xz.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return err
+		}
+		return extractor.extractTar(stream)
+	case archiveFormatTarGz:
+		stream, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		return extractor.extractTar(stream)
+	default:
+		return fmt.Errorf("%s isn't a .zip, .tar.gz, or .tar.xz archive", archiveName)
+	}
+}
+
+// readBofBuildManifest reads and checks the build manifest at the root of the source folder. Archives that wrap
+// everything in a single top level folder are handled by returning that folder as the source folder.
+func readBofBuildManifest(sourceDir string) (bofBuildManifest, string, error) {
+	manifest := bofBuildManifest{}
+	manifestContents, err := os.ReadFile(filepath.Join(sourceDir, BofBuildManifestFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		entries, readErr := os.ReadDir(sourceDir)
+		if readErr == nil && len(entries) == 1 && entries[0].IsDir() {
+			return readBofBuildManifest(filepath.Join(sourceDir, entries[0].Name()))
+		}
+		return manifest, sourceDir, fmt.Errorf("%w: %s not found", invalidBuildManifestError, BofBuildManifestFilename)
+	}
+	if err != nil {
+		return manifest, sourceDir, err
+	}
+	if err = json.Unmarshal(manifestContents, &manifest); err != nil {
+		return manifest, sourceDir, fmt.Errorf("%w: %s", invalidBuildManifestError, err.Error())
+	}
+	if len(manifest.Arch) == 0 {
+		manifest.Arch = []string{"amd64", "386"}
+	}
+	if manifest.Entrypoint == "" {
+		manifest.Entrypoint = "go"
+	}
+	return manifest, sourceDir, manifest.validate(sourceDir)
+}
+
+func (manifest bofBuildManifest) validate(sourceDir string) error {
+	if manifest.CommandName == "" || !filepath.IsLocal(manifest.CommandName) || strings.ContainsAny(manifest.CommandName, `/\`) {
+		return fmt.Errorf("%w: command_name must be a simple name", invalidBuildManifestError)
+	}
+	if len(manifest.Sources) == 0 {
+		return fmt.Errorf("%w: no sources listed", invalidBuildManifestError)
+	}
+	localPaths := append(append([]string{}, manifest.Sources...), manifest.IncludeDirs...)
+	if manifest.Extension != "" {
+		localPaths = append(localPaths, manifest.Extension)
+	}
+	for _, localPath := range localPaths {
+		if !filepath.IsLocal(filepath.FromSlash(localPath)) {
+			return fmt.Errorf("%w: %s isn't inside the source folder", invalidBuildManifestError, localPath)
+		}
+		if _, err := os.Stat(filepath.Join(sourceDir, filepath.FromSlash(localPath))); err != nil {
+			return fmt.Errorf("%w: %s doesn't exist", invalidBuildManifestError, localPath)
+		}
+	}
+	for _, arch := range manifest.Arch {
+		if _, ok := bofBuildArchSuffixes[arch]; !ok {
+			return fmt.Errorf("%w: arch must be amd64 or 386, not %s", invalidBuildManifestError, arch)
+		}
+	}
+	for _, define := range manifest.Defines {
+		if !bofBuildDefine.MatchString(define) {
+			return fmt.Errorf("%w: %q isn't a valid define, use NAME or NAME=value", invalidBuildManifestError, define)
+		}
+	}
+	return nil
+}
+
+func bofCompilerForArch(arch string) string {
+	if arch == "386" {
+		if compiler := os.Getenv(mingwX86Env); compiler != "" {
+			return compiler
+		}
+		return defaultMingwX86
+	}
+	if compiler := os.Getenv(mingwX64Env); compiler != "" {
+		return compiler
+	}
+	return defaultMingwX64
+}
+
+// bofCompilerArgs builds the compiler's arguments for a single source file
+func (manifest bofBuildManifest) bofCompilerArgs(source string, objectPath string) []string {
+	args := append([]string{}, bofCompilerFlags...)
+	for _, define := range manifest.Defines {
+		args = append(args, "-D"+define)
+	}
+	for _, includeDir := range manifest.IncludeDirs {
+		args = append(args, "-I", filepath.FromSlash(includeDir))
+	}
+	// sources are always passed as ./path so a file named like a flag (ex: -fplugin=...) is never read as one
+	return append(args, "-o", objectPath, "."+string(filepath.Separator)+filepath.FromSlash(source))
+}
+
+// runBofCompiler runs the compiler in the source folder, adding the command line and its output to the build log
+func runBofCompiler(ctx context.Context, sourceDir string, compiler string, args []string, buildLog *strings.Builder) error {
+	buildLog.WriteString(fmt.Sprintf("$ %s %s\n", compiler, strings.Join(args, " ")))
+	cmd := exec.CommandContext(ctx, compiler, args...)
+	cmd.Dir = sourceDir
+	output, err := cmd.CombinedOutput()
+	buildLog.Write(output)
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %s timed out after %s", bofBuildFailedError, compiler, bofBuildTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %s", bofBuildFailedError, compiler, err.Error())
+	}
+	return nil
+}
+
+// compileBof builds an object file for every architecture in the manifest. Multiple sources are compiled separately
+// and then linked into a single relocatable object, since a bof has to be one object file.
+func compileBof(ctx context.Context, sourceDir string, manifest bofBuildManifest, buildLog *strings.Builder) ([]bofBuildOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, bofBuildTimeout)
+	defer cancel()
+	outputDir, err := os.MkdirTemp("", "forge-build-output-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outputDir)
+	outputs := []bofBuildOutput{}
+	for _, arch := range manifest.Arch {
+		compiler := bofCompilerForArch(arch)
+		filename := fmt.Sprintf("%s.%s.o", manifest.CommandName, bofBuildArchSuffixes[arch])
+		objectPath := filepath.Join(outputDir, filename)
+		objectPaths := []string{}
+		for i, source := range manifest.Sources {
+			sourceObjectPath := objectPath
+			if len(manifest.Sources) > 1 {
+				sourceObjectPath = filepath.Join(outputDir, fmt.Sprintf("%s.%d.%s.o", manifest.CommandName, i, bofBuildArchSuffixes[arch]))
+			}
+			if err = runBofCompiler(ctx, sourceDir, compiler, manifest.bofCompilerArgs(source, sourceObjectPath), buildLog); err != nil {
+				return nil, err
+			}
+			objectPaths = append(objectPaths, sourceObjectPath)
+		}
+		if len(objectPaths) > 1 {
+			linkArgs := append([]string{"-r", "-nostdlib", "-o", objectPath}, objectPaths...)
+			if err = runBofCompiler(ctx, sourceDir, compiler, linkArgs, buildLog); err != nil {
+				return nil, err
+			}
+		}
+		contents, err := os.ReadFile(objectPath)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, bofBuildOutput{Arch: arch, Filename: filename, Contents: contents})
+	}
+	return outputs, nil
+}
+
+// buildBofExtension returns the extension.json for the compiled objects. One from the source is checked against
+// what was built, and its files are filled in if it doesn't list any.
+func buildBofExtension(sourceDir string, manifest bofBuildManifest, outputs []bofBuildOutput) ([]byte, error) {
+	builtFiles := make([]bofCommandDefinitionFiles, len(outputs))
+	for i, output := range outputs {
+		builtFiles[i] = bofCommandDefinitionFiles{OS: "windows", Arch: output.Arch, Path: output.Filename}
+	}
+	if manifest.Extension == "" {
+		return json.MarshalIndent(bofCommandDefinition{
+			Name:        manifest.CommandName,
+			CommandName: manifest.CommandName,
+			Help:        manifest.Help,
+			Entrypoint:  manifest.Entrypoint,
+			Files:       builtFiles,
+			Arguments:   manifest.Arguments,
+		}, "", "\t")
+	}
+	extensionContents, err := os.ReadFile(filepath.Join(sourceDir, filepath.FromSlash(manifest.Extension)))
+	if err != nil {
+		return nil, err
+	}
+	extension := bofCommandDefinition{}
+	if err = json.Unmarshal(extensionContents, &extension); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", invalidBuildManifestError, manifest.Extension, err.Error())
+	}
+	if getBofCommandSourceName(extension) != manifest.CommandName {
+		return nil, fmt.Errorf("%w: %s is for %s, not %s", invalidBuildManifestError, manifest.Extension,
+			getBofCommandSourceName(extension), manifest.CommandName)
+	}
+	commandDefinitions := expandBofCommandDefinitions(extension)
+	if len(commandDefinitions) == 0 {
+		return nil, fmt.Errorf("%w: %s does not define any commands", invalidBuildManifestError, manifest.Extension)
+	}
+	if len(extension.Files) == 0 && !slices.ContainsFunc(commandDefinitions, func(c bofCommandDefinition) bool { return len(c.Files) > 0 }) {
+		extension.Files = builtFiles
+		return json.MarshalIndent(extension, "", "\t")
+	}
+	for _, commandDefinition := range commandDefinitions {
+		for _, file := range commandDefinition.Files {
+			if !slices.Contains(builtFiles, bofCommandDefinitionFiles{OS: file.OS, Arch: file.Arch, Path: file.Path}) {
+				return nil, fmt.Errorf("%w: %s lists %s (%s) for %s, but the build produced %s", invalidBuildManifestError,
+					manifest.Extension, file.Path, file.Arch, commandDefinition.CommandName, bofBuildOutputNames(outputs))
+			}
+		}
+	}
+	return extensionContents, nil
+}
+
+func bofBuildOutputNames(outputs []bofBuildOutput) string {
+	names := make([]string, len(outputs))
+	for i, output := range outputs {
+		names[i] = fmt.Sprintf("%s (%s)", output.Filename, output.Arch)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,140 @@
+package agentfunctions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBuildSource creates a bof source folder wrapped in a top level folder, like most source archives
+func writeBuildSource(tb testing.TB, manifest string) string {
+	tb.Helper()
+	root := tb.TempDir()
+	sourceDir := filepath.Join(root, "mybof-main")
+	files := map[string]string{
+		BofBuildManifestFilename: manifest,
+		"src/main.c":             "#include \"util.h\"\nvoid go(char *args, int length) { helper(GREETING); }\n",
+		"src/util.c":             "#include \"util.h\"\nint helper(int value) { return value + 1; }\n",
+		"include/util.h":         "int helper(int value);\n",
+	}
+	for name, contents := range files {
+		filePath := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			tb.Fatalf("failed to create %s: %v", name, err)
+		}
+		if err := os.WriteFile(filePath, []byte(contents), 0644); err != nil {
+			tb.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return root
+}
+
+const testBuildManifest = `{"command_name": "mybof", "sources": ["src/main.c", "src/util.c"], "arch": ["amd64"],
+	"defines": ["GREETING=1"], "include_dirs": ["include"], "help": "says hello",
+	"arguments": [{"name": "target", "type": "string"}]}`
+
+func TestReadBofBuildManifest(t *testing.T) {
+	root := writeBuildSource(t, `{"command_name": "mybof", "sources": ["src/main.c"]}`)
+	manifest, sourceDir, err := readBofBuildManifest(root)
+	if err != nil {
+		t.Fatalf("expected the manifest to be found in the top level folder, got %v", err)
+	}
+	if filepath.Base(sourceDir) != "mybof-main" || manifest.Entrypoint != "go" || len(manifest.Arch) != 2 {
+		t.Fatalf("unexpected manifest defaults: %s %+v", sourceDir, manifest)
+	}
+	for _, invalid := range []string{
+		`{"sources": ["src/main.c"]}`,
+		`{"command_name": "mybof", "sources": ["../main.c"]}`,
+		`{"command_name": "mybof", "sources": ["src/missing.c"]}`,
+		`{"command_name": "mybof", "sources": ["src/main.c"], "arch": ["arm64"]}`,
+		`{"command_name": "mybof", "sources": ["src/main.c"], "defines": ["-fplugin=evil.so"]}`,
+		`{"command_name": "../mybof", "sources": ["src/main.c"]}`,
+	} {
+		root = writeBuildSource(t, invalid)
+		if _, _, err = readBofBuildManifest(root); !errors.Is(err, invalidBuildManifestError) {
+			t.Fatalf("expected %s to be rejected, got %v", invalid, err)
+		}
+	}
+}
+
+func TestBuildBofExtension(t *testing.T) {
+	root := writeBuildSource(t, testBuildManifest)
+	manifest, sourceDir, err := readBofBuildManifest(root)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	outputs := []bofBuildOutput{{Arch: "amd64", Filename: "mybof.x64.o"}}
+	extensionContents, err := buildBofExtension(sourceDir, manifest, outputs)
+	if err != nil {
+		t.Fatalf("expected an extension.json to be generated, got %v", err)
+	}
+	extension := bofCommandDefinition{}
+	json.Unmarshal(extensionContents, &extension)
+	if extension.CommandName != "mybof" || extension.Help != "says hello" || len(extension.Arguments) != 1 ||
+		len(extension.Files) != 1 || extension.Files[0].Path != "mybof.x64.o" {
+		t.Fatalf("unexpected generated extension.json: %s", extensionContents)
+	}
+	manifest.Extension = "extension.json"
+	os.WriteFile(filepath.Join(sourceDir, "extension.json"), []byte(`{"command_name": "mybof",
+		"files": [{"os": "windows", "arch": "386", "path": "mybof.x86.o"}]}`), 0644)
+	if _, err = buildBofExtension(sourceDir, manifest, outputs); !errors.Is(err, invalidBuildManifestError) {
+		t.Fatalf("expected an extension.json listing files that weren't built to be rejected, got %v", err)
+	}
+	os.WriteFile(filepath.Join(sourceDir, "extension.json"), []byte(`{"command_name": "mybof", "entrypoint": "go"}`), 0644)
+	extensionContents, err = buildBofExtension(sourceDir, manifest, outputs)
+	if err != nil || !strings.Contains(string(extensionContents), "mybof.x64.o") {
+		t.Fatalf("expected the built files to be filled in, got %s: %v", extensionContents, err)
+	}
+}
+
+func TestCompileBof(t *testing.T) {
+	// the host gcc stands in for MinGW, this only checks that sources are compiled and linked into one object
+	compiler, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc isn't installed")
+	}
+	t.Setenv(mingwX64Env, compiler)
+	root := writeBuildSource(t, testBuildManifest)
+	manifest, sourceDir, err := readBofBuildManifest(root)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	buildLog := strings.Builder{}
+	outputs, err := compileBof(context.Background(), sourceDir, manifest, &buildLog)
+	if err != nil {
+		t.Fatalf("expected the bof to compile, got %v\n%s", err, buildLog.String())
+	}
+	if len(outputs) != 1 || outputs[0].Filename != "mybof.x64.o" || len(outputs[0].Contents) == 0 {
+		t.Fatalf("unexpected build outputs: %+v", outputs)
+	}
+	if !strings.Contains(buildLog.String(), "-DGREETING=1") || !strings.Contains(buildLog.String(), "-r -nostdlib") {
+		t.Fatalf("expected the build log to have the compiler commands, got:\n%s", buildLog.String())
+	}
+	os.WriteFile(filepath.Join(sourceDir, "src", "util.c"), []byte("this isn't C\n"), 0644)
+	buildLog.Reset()
+	if _, err = compileBof(context.Background(), sourceDir, manifest, &buildLog); !errors.Is(err, bofBuildFailedError) {
+		t.Fatalf("expected a compiler error, got %v", err)
+	}
+	if !strings.Contains(buildLog.String(), "util.c") {
+		t.Fatalf("expected the compiler's errors in the build log, got:\n%s", buildLog.String())
+	}
+}
+
+func TestResolveBuildSourcePath(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.MkdirAll(filepath.Join(defaultBuildSourcesDirectory, "mybof"), os.ModePerm)
+	if _, err := resolveBuildSourcePath("mybof"); err != nil {
+		t.Fatalf("expected a folder in the build sources folder to resolve, got %v", err)
+	}
+	if _, err := resolveBuildSourcePath("../"); err == nil {
+		t.Fatalf("expected a path outside of the build sources folder to be rejected")
+	}
+	if _, err := resolveBuildSourcePath("/etc"); err == nil {
+		t.Fatalf("expected an absolute path outside of the build sources folder to be rejected")
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/MythicMeta/MythicContainer/utils/sharedStructs"
 )
 
-const version = "0.0.13"
+const version = "0.0.14"
 const CollectionSources = "collection_sources.json"
 const PayloadTypeSupportFilename = "payload_type_support.json"
 const BofPrefix = "forge_bof_"
@@ -22,6 +22,7 @@ const PayloadTypeName = "forge"
 type collectionSource struct {
 	Name             string `json:"name"`
 	Type             string `json:"type"`
+	Namespace        string `json:"namespace,omitempty"`
 	SourceFilename   string `json:"-"`
 	CommandsFilename string `json:"-"`
 }
@@ -47,17 +48,7 @@ func getCollectionSourceNameOptions(message agentstructs.PTRPCDynamicQueryFuncti
 			break
 		}
 	}
-	assemblyCommandsFile, err := getOrCreateFile(CollectionSources)
-	if err != nil {
-		logging.LogError(err, "Failed to read collection sources file")
-		return []string{}
-	}
-	sources := []collectionSource{}
-	err = json.Unmarshal(assemblyCommandsFile, &sources)
-	if err != nil {
-		logging.LogError(err, "failed to parse collection sources")
-		return []string{}
-	}
+	sources := forgeRegistry.getCollectionSources()
 	sourceNames := []string{}
 	for _, source := range sources {
 		switch source.Type {
@@ -104,54 +95,24 @@ func addCollectionSource(source collectionSource) error {
 		logging.LogError(err, "failed to parse collection sources")
 		return err
 	}
-	err = os.WriteFile(CollectionSources, collectionFile, 0644)
-	return err
+	return writeForgeFile(CollectionSources, collectionFile, 0644)
 }
 func getCollectionSource(name string) (collectionSource, error) {
+	if source, ok := forgeRegistry.getCollectionSource(name); ok {
+		return source, nil
+	}
 	collection := collectionSource{
 		Name:             name,
 		SourceFilename:   fmt.Sprintf("%s_sources.json", name),
 		CommandsFilename: fmt.Sprintf("%s_commands.json", name),
 	}
-	collectionFile, err := getOrCreateFile(CollectionSources)
-	if err != nil {
-		logging.LogError(err, "Failed to read collection sources file")
-		return collection, err
-	}
-	sources := []collectionSource{}
-	err = json.Unmarshal(collectionFile, &sources)
-	if err != nil {
-		logging.LogError(err, "failed to parse collection sources")
-		return collection, err
-	}
-	for i, _ := range sources {
-		sources[i].SourceFilename = fmt.Sprintf("%s_sources.json", sources[i].Name)
-		sources[i].CommandsFilename = fmt.Sprintf("%s_commands.json", sources[i].Name)
-	}
-	for _, source := range sources {
-		if source.Name == name {
-			return source, nil
-		}
-	}
 	return collection, collectionSourceNotFoundError
 }
 func getCollectionSources() []collectionSource {
-	sources := []collectionSource{}
-	collectionFile, err := getOrCreateFile(CollectionSources)
-	if err != nil {
-		logging.LogError(err, "Failed to read collection sources file")
-		return sources
-	}
-	err = json.Unmarshal(collectionFile, &sources)
-	if err != nil {
-		logging.LogError(err, "failed to parse collection sources")
-		return sources
-	}
-	for i, _ := range sources {
-		sources[i].SourceFilename = fmt.Sprintf("%s_sources.json", sources[i].Name)
-		sources[i].CommandsFilename = fmt.Sprintf("%s_commands.json", sources[i].Name)
-	}
-	return sources
+	return forgeRegistry.getCollectionSources()
+}
+func getCollectionSourceCommands(collectionSourceData collectionSource) []collectionSourceCommandData {
+	return forgeRegistry.getSourceCommands(collectionSourceData.Name)
 }
 func getOrCreateFile(filename string) ([]byte, error) {
 	commandsFileBytes, err := os.ReadFile(filename)
@@ -191,10 +152,15 @@ type collectionSourceCommandData struct {
 	customAssemblyFileID     string
 	customBofFileIDs         []string
 	customBofExtensionFileID string
-	Registered               bool   `json:"registered"`
-	Downloadable             bool   `json:"downloadable"`
-	Downloaded               bool   `json:"downloaded"`
-	CollectionName           string `json:"collection_name"`
+	Registered               bool                    `json:"registered"`
+	Downloadable             bool                    `json:"downloadable"`
+	Downloaded               bool                    `json:"downloaded"`
+	CollectionName           string                  `json:"collection_name"`
+	OperationIDs             []int                   `json:"operation_ids,omitempty"`
+	OPSEC                    *commandOPSEC           `json:"opsec,omitempty"`
+	YaraMatches              []yaraFileResult        `json:"yara_matches,omitempty"`
+	BofCompatibility         []bofAgentCompatibility `json:"bof_compatibility,omitempty"`
+	Renames                  map[string]string       `json:"renames,omitempty"`
 }
 type agentDefinition struct {
 	Agent                                string `json:"agent"`
@@ -209,16 +175,25 @@ type agentDefinition struct {
 	ExecuteAssemblyFileParameterName     string `json:"execute_assembly_file_parameter_name"`
 	ExecuteAssemblyArgumentParameterName string `json:"execute_assembly_argument_parameter_name"`
 	AssemblyDefaultExecutionMethod       string `json:"assembly_default_execution_method"`
+	DllCommand                           string `json:"dll_command,omitempty"`
+	DllFileParameterName                 string `json:"dll_file_parameter_name,omitempty"`
+	DllArgumentParameterName             string `json:"dll_argument_parameter_name,omitempty"`
+	DllEntryPointParameterName           string `json:"dll_entrypoint_parameter_name,omitempty"`
+	// BofBeaconAPI lists the Beacon API functions the agent's bof loader implements, empty means it isn't declared
+	BofBeaconAPI            []string `json:"bof_beacon_api,omitempty"`
+	BofUnsupportedAPIAction string   `json:"bof_unsupported_api_action,omitempty"`
 }
 type bofCommand struct {
 	CommandName           string `json:"command_name"`
 	CollectionType        string `json:"collection_type"`
 	CollectionCommandName string `json:"collection_command_name"`
+	OperationIDs          []int  `json:"operation_ids,omitempty"`
 }
 type assemblyCommand struct {
 	CommandName           string `json:"command_name"`
 	CollectionType        string `json:"collection_type"`
 	CollectionCommandName string `json:"collection_command_name"`
+	OperationIDs          []int  `json:"operation_ids,omitempty"`
 }
 
 var payloadDefinition = agentstructs.PayloadType{
@@ -240,77 +215,32 @@ var payloadDefinition = agentstructs.PayloadType{
 		response := sharedStructs.ContainerOnStartMessageResponse{}
 		collectionSources := getCollectionSources()
 		for _, source := range collectionSources {
-			commandsFile, err := getOrCreateFile(source.CommandsFilename)
-			if err != nil {
-				logging.LogError(err, "Failed to read commands file")
-				response.EventLogErrorMessage = "Failed to read commands file"
-				return response
-			}
+			registeredCommands := forgeRegistry.getRegisteredCommands(source.Name)
 			switch source.Type {
 			case "assembly":
-				registeredCommands := []assemblyCommand{}
-				err = json.Unmarshal(commandsFile, &registeredCommands)
-				if err != nil {
-					logging.LogError(err, "failed to parse assembly commands into struct")
-					response.EventLogErrorMessage = "failed to parse assembly commands into struct"
-					return response
-				}
-				sourceCommandFile, err := getOrCreateFile(source.SourceFilename)
-				if err != nil {
-					logging.LogError(err, "Failed to read commands file")
-					response.EventLogErrorMessage = "Failed to read commands file"
-					return response
-				}
-				sourceCommands := []collectionSourceCommandData{}
-				err = json.Unmarshal(sourceCommandFile, &sourceCommands)
-				if err != nil {
-					logging.LogError(err, "failed to parse assembly commands into struct")
-					response.EventLogErrorMessage = "failed to parse assembly commands into struct"
-					return response
-				}
 				for _, registeredCommand := range registeredCommands {
-					for _, sourceCommand := range sourceCommands {
-						if registeredCommand.CollectionCommandName == sourceCommand.Name {
-							newCommand := createAssemblyCommand(sourceCommand, source, false)
-							addOrReplaceForgeCommand(newCommand)
-						}
+					sourceCommand, ok := forgeRegistry.findSourceCommand(source.Name, registeredCommand.CollectionCommandName)
+					if !ok {
+						continue
 					}
+					newCommand := createAssemblyCommand(sourceCommand, source, false, globalOperationID)
+					addOrReplaceForgeCommand(newCommand)
 				}
 			case "bof":
-				registeredCommands := []bofCommand{}
-				err = json.Unmarshal(commandsFile, &registeredCommands)
-				if err != nil {
-					logging.LogError(err, "failed to parse assembly commands into struct")
-					response.EventLogErrorMessage = "failed to parse assembly commands into struct"
-					return response
-				}
-				sourceCommandFile, err := getOrCreateFile(source.SourceFilename)
-				if err != nil {
-					logging.LogError(err, "Failed to read commands file")
-					response.EventLogErrorMessage = "Failed to read commands file"
-					return response
-				}
-				sourceCommands := []collectionSourceCommandData{}
-				err = json.Unmarshal(sourceCommandFile, &sourceCommands)
-				if err != nil {
-					logging.LogError(err, "failed to parse bof commands into struct")
-					response.EventLogErrorMessage = "failed to parse bof commands into struct"
-					return response
-				}
 				loadedSources := make(map[string]bool)
 				for _, registeredCommand := range registeredCommands {
-					for _, sourceCommand := range sourceCommands {
-						if registeredCommand.CollectionCommandName == sourceCommand.Name {
-							if loadedSources[sourceCommand.Name] {
-								continue
-							}
-							loadedSources[sourceCommand.Name] = true
-							err = createBofCommand(sourceCommand, source, false)
-							if err != nil {
-								logging.LogError(err, "failed to create bof command")
-								continue
-							}
-						}
+					if loadedSources[registeredCommand.CollectionCommandName] {
+						continue
+					}
+					sourceCommand, ok := forgeRegistry.findSourceCommand(source.Name, registeredCommand.CollectionCommandName)
+					if !ok {
+						continue
+					}
+					loadedSources[sourceCommand.Name] = true
+					err := createBofCommand(sourceCommand, source, false, globalOperationID)
+					if err != nil {
+						logging.LogError(err, "failed to create bof command")
+						continue
 					}
 				}
 			default:
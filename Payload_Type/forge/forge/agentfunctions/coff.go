@@ -0,0 +1,209 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+var invalidBofObjectError = errors.New("bof object file doesn't match its extension.json")
+
+const coffSymbolClassExternal = 2
+
+// relocation types from the PE/COFF spec, debug/pe doesn't define them
+const (
+	coffRelAMD64Addr64   = 0x1
+	coffRelAMD64Addr32NB = 0x3
+	coffRelAMD64Rel32    = 0x4
+	coffRelAMD64Rel32_5  = 0x9
+	coffRelI386Dir32     = 0x6
+	coffRelI386Rel32     = 0x14
+)
+
+// supportedCoffRelocation reports if beacon's object loader knows how to apply a relocation, anything else fails when
+// the bof is loaded
+func supportedCoffRelocation(machine uint16, relocationType uint16) bool {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return relocationType == coffRelAMD64Addr64 || relocationType == coffRelAMD64Addr32NB ||
+			(relocationType >= coffRelAMD64Rel32 && relocationType <= coffRelAMD64Rel32_5)
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return relocationType == coffRelI386Dir32 || relocationType == coffRelI386Rel32
+	default:
+		return false
+	}
+}
+
+// bofArchMachines maps the arch values used in extension.json files to COFF machine types
+var bofArchMachines = map[string]uint16{
+	"amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+	"386":   pe.IMAGE_FILE_MACHINE_I386,
+}
+
+type coffObject struct {
+	Path        string
+	Arch        string
+	Machine     uint16
+	Entrypoint  string
+	Imports     []string
+	Unsupported []string
+	// Summary describes an alias's assembly or dll, which isn't a COFF object
+	Summary string
+}
+
+// coffSymbolName strips the decorations the compiler adds to a symbol so it reads like the source (ex: __imp__BeaconPrintf@8 -> BeaconPrintf)
+func coffSymbolName(name string, machine uint16) string {
+	name = strings.TrimPrefix(name, "__imp_")
+	if machine == pe.IMAGE_FILE_MACHINE_I386 {
+		name = strings.TrimPrefix(name, "_")
+		if at := strings.LastIndex(name, "@"); at > 0 {
+			name = name[:at]
+		}
+	}
+	return name
+}
+
+// inspectCOFF parses a bof object file, collecting the functions it defines, the functions it imports, and any
+// relocations the object loader can't handle
+func inspectCOFF(contents []byte) (coffObject, []string, error) {
+	object := coffObject{}
+	if bytes.HasPrefix(contents, []byte("MZ")) {
+		return object, nil, errors.New("file is a PE image, not a COFF object file")
+	}
+	objectFile, err := pe.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return object, nil, fmt.Errorf("file isn't a COFF object file: %w", err)
+	}
+	defer objectFile.Close()
+	object.Machine = objectFile.Machine
+	if object.Machine != pe.IMAGE_FILE_MACHINE_AMD64 && object.Machine != pe.IMAGE_FILE_MACHINE_I386 {
+		return object, nil, fmt.Errorf("unsupported machine type 0x%x", object.Machine)
+	}
+	definedSymbols := []string{}
+	for _, symbol := range objectFile.Symbols {
+		if symbol.StorageClass != coffSymbolClassExternal {
+			continue
+		}
+		if symbol.SectionNumber > 0 {
+			definedSymbols = append(definedSymbols, coffSymbolName(symbol.Name, object.Machine))
+		} else if symbol.SectionNumber == 0 && strings.HasPrefix(symbol.Name, "__imp_") {
+			object.Imports = append(object.Imports, coffSymbolName(symbol.Name, object.Machine))
+		}
+	}
+	slices.Sort(object.Imports)
+	object.Imports = slices.Compact(object.Imports)
+	for _, section := range objectFile.Sections {
+		for _, relocation := range section.Relocs {
+			if !supportedCoffRelocation(object.Machine, relocation.Type) {
+				object.Unsupported = append(object.Unsupported, fmt.Sprintf("%s: type 0x%x at 0x%x", section.Name,
+					relocation.Type, relocation.VirtualAddress))
+			}
+		}
+	}
+	return object, definedSymbols, nil
+}
+
+// validateBofObject checks a single object file against the extension.json entry that references it
+func validateBofObject(contents []byte, file bofCommandDefinitionFiles, entrypoint string) (coffObject, error) {
+	object, definedSymbols, err := inspectCOFF(contents)
+	object.Path = file.Path
+	object.Arch = file.Arch
+	object.Entrypoint = entrypoint
+	if err != nil {
+		return object, fmt.Errorf("%w: %s: %s", invalidBofObjectError, file.Path, err.Error())
+	}
+	if expectedMachine, ok := bofArchMachines[file.Arch]; ok && expectedMachine != object.Machine {
+		builtFor := fmt.Sprintf("machine type 0x%x", object.Machine)
+		for arch, machine := range bofArchMachines {
+			if machine == object.Machine {
+				builtFor = arch
+			}
+		}
+		return object, fmt.Errorf("%w: %s is listed as %s but it's built for %s", invalidBofObjectError,
+			file.Path, file.Arch, builtFor)
+	}
+	if !slices.Contains(definedSymbols, entrypoint) {
+		return object, fmt.Errorf("%w: %s doesn't define the entrypoint %q", invalidBofObjectError, file.Path, entrypoint)
+	}
+	if len(object.Unsupported) > 0 {
+		return object, fmt.Errorf("%w: %s has relocations the object loader doesn't support: %s", invalidBofObjectError,
+			file.Path, strings.Join(object.Unsupported, ", "))
+	}
+	return object, nil
+}
+
+// validateBofObjects parses every object file a bof's extension.json references before its commands are registered,
+// aliases get their assemblies or dlls checked instead
+func validateBofObjects(commandSource collectionSourceCommandData, collectionSourceData collectionSource) ([]coffObject, error) {
+	commandDefinitions, err := loadBofCommandDefinitions(commandSource, collectionSourceData)
+	if err != nil {
+		return nil, err
+	}
+	bofCommandFolder := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSource.CommandName)
+	objects := []coffObject{}
+	for _, commandDefinition := range commandDefinitions {
+		entrypoint := commandDefinition.Entrypoint
+		if entrypoint == "" {
+			entrypoint = "go"
+		}
+		for _, file := range commandDefinition.Files {
+			if file.Path == "" {
+				return objects, fmt.Errorf("%w: %s has a file entry without a path", invalidBofObjectError, commandDefinition.CommandName)
+			}
+			contents, err := readStoredFile(filepath.Join(bofCommandFolder, file.Path))
+			if err != nil {
+				return objects, fmt.Errorf("%w: %s", invalidBofObjectError, err.Error())
+			}
+			if commandDefinition.alias {
+				summary, err := validateAliasFile(contents, file, commandDefinition)
+				if err != nil {
+					return objects, err
+				}
+				objects = append(objects, coffObject{Path: file.Path, Arch: file.Arch, Summary: summary})
+				continue
+			}
+			object, err := validateBofObject(contents, file, entrypoint)
+			if err != nil {
+				return objects, err
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+func coffObjectReport(objects []coffObject) string {
+	report := strings.Builder{}
+	for _, object := range objects {
+		if object.Summary != "" {
+			report.WriteString(fmt.Sprintf("[*] %s (%s), %s\n", object.Path, object.Arch, object.Summary))
+			continue
+		}
+		report.WriteString(fmt.Sprintf("[*] %s (%s), entrypoint %s\n", object.Path, object.Arch, object.Entrypoint))
+		if len(object.Imports) == 0 {
+			report.WriteString("    imports: none\n")
+			continue
+		}
+		report.WriteString(fmt.Sprintf("    imports: %s\n", strings.Join(object.Imports, ", ")))
+	}
+	return report.String()
+}
+
+// checkBofObjects validates a bof's object files and sends what each one imports to the task
+func checkBofObjects(taskData *agentstructs.PTTaskMessageAllData, commandSource collectionSourceCommandData, collectionSourceData collectionSource) error {
+	objects, err := validateBofObjects(commandSource, collectionSourceData)
+	if report := coffObjectReport(objects); report != "" {
+		mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+			TaskID:   taskData.Task.ID,
+			Response: []byte(report),
+		})
+	}
+	return err
+}
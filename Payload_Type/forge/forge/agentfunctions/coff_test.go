@@ -0,0 +1,71 @@
+package agentfunctions
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testCoffObjects are tiny bofs with a go entrypoint that call KERNEL32$GetLastError and BeaconPrintf, built with
+// llc -mtriple=<arch>-pc-windows-msvc -filetype=obj
+var testCoffObjects = map[string]string{
+	"amd64": "ZIYGAAAAAAB5AQAAEgAAAAAAAAAudGV4dAAAAAAAAAAAAAAAIgAAAAQBAAAmAQAAAAAAAAMAAAAgAFBgLmRhdGEAAAAAAAAAAAAAAAAAAABEAQAAAAAAAAAAAAAAAAAAQAAwwC5ic3MAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAIAAMMAueGRhdGEAAAAAAAAAAAAACAAAAEQBAAAAAAAAAAAAAAAAAABAADBALnJkYXRhAAAAAAAAAAAAAAMAAABMAQAAAAAAAAAAAAAAAAAAQAAQQC5wZGF0YQAAAAAAAAAAAAAMAAAATwEAAFsBAAAAAAAAAwAAAEAAMEBIg+wo/xUAAAAASI0VAAAAADHJQYnA/xUAAAAAkEiDxCjDBgAAAA4AAAAEAA0AAAAIAAAABAAYAAAADwAAAAQAAQQBAARCAAAlZAAAAAAAIgAAAAAAAAAAAAAAAAAAAAMABAAAAAAAAAADAAgAAAAGAAAAAwAudGV4dAAAAAAAAAABAAAAAwEiAAAAAwAAANrWF/QBAAAAAAAuZGF0YQAAAAAAAAACAAAAAwEAAAAAAAAAAAAAAAACAAAAAAAuYnNzAAAAAAAAAAADAAAAAwEAAAAAAAAAAAAAAAADAAAAAAAueGRhdGEAAAAAAAAEAAAAAwEIAAAAAAAAANE5xQ8EAAAAAAAucmRhdGEAAAAAAAAFAAAAAwEDAAAAAAAAAKgqFz8FAAAAAAAucGRhdGEAAAAAAAAGAAAAAwEMAAAAAwAAACtlU7sGAAAAAABAZmVhdC4wMAAAAAD//wAAAwBnbwAAAAAAAAAAAAABACAAAgAAAAAABAAAAAAAAAAAAAAAAgAAAAAAIAAAAAAAAAAAAAAAAgAuZmlsZQAAAAAAAAD+/wAAZwFiLmxsAAAAAAAAAAAAAAAAAAAzAAAAX19pbXBfS0VSTkVMMzIkR2V0TGFzdEVycm9yAF9faW1wX0JlYWNvblByaW50ZgA=",
+	"386":   "TAEEAAAAAADtAAAADgAAAAAAAAAudGV4dAAAAAAAAAAAAAAAGAAAALQAAADMAAAAAAAAAAMAAAAgAFBgLmRhdGEAAAAAAAAAAAAAAAAAAADqAAAAAAAAAAAAAAAAAAAAQAAwwC5ic3MAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAIAAMMAucmRhdGEAAAAAAAAAAAAAAwAAAOoAAAAAAAAAAAAAAAAAAABAABBA/xUAAAAAUGgAAAAAagD/FQAAAACDxAzDAgAAAAoAAAAGAAgAAAAGAAAABgAQAAAACwAAAAYAJWQALnRleHQAAAAAAAAAAQAAAAMBGAAAAAMAAAC+06yQAQAAAAAALmRhdGEAAAAAAAAAAgAAAAMBAAAAAAAAAAAAAAAAAgAAAAAALmJzcwAAAAAAAAAAAwAAAAMBAAAAAAAAAAAAAAAAAwAAAAAALnJkYXRhAAAAAAAABAAAAAMBAwAAAAAAAACoKhc/BAAAAAAAQGZlYXQuMDABAAAA//8AAAMAX2dvAAAAAAAAAAAAAQAgAAIAAAAAAAQAAAAAAAAAAAAAAAIAAAAAACEAAAAAAAAAAAAAAAIALmZpbGUAAAAAAAAA/v8AAGcBYi5sbAAAAAAAAAAAAAAAAAAANQAAAF9faW1wX19LRVJORUwzMiRHZXRMYXN0RXJyb3IAX19pbXBfX0JlYWNvblByaW50ZgA=",
+}
+
+func testCoffObject(tb testing.TB, arch string) []byte {
+	contents, err := base64.StdEncoding.DecodeString(testCoffObjects[arch])
+	if err != nil {
+		tb.Fatalf("bad test object: %v", err)
+	}
+	return contents
+}
+
+func TestValidateBofObject(t *testing.T) {
+	for arch := range testCoffObjects {
+		object, err := validateBofObject(testCoffObject(t, arch), bofCommandDefinitionFiles{Arch: arch, Path: "test.o"}, "go")
+		if err != nil {
+			t.Fatalf("expected the %s object to be valid: %v", arch, err)
+		}
+		if !slices.Equal(object.Imports, []string{"BeaconPrintf", "KERNEL32$GetLastError"}) {
+			t.Fatalf("unexpected %s imports %v", arch, object.Imports)
+		}
+	}
+	_, err := validateBofObject(testCoffObject(t, "386"), bofCommandDefinitionFiles{Arch: "amd64", Path: "test.o"}, "go")
+	if !errors.Is(err, invalidBofObjectError) || !strings.Contains(err.Error(), "built for 386") {
+		t.Fatalf("expected an x86 object listed as amd64 to be rejected, got %v", err)
+	}
+	_, err = validateBofObject(testCoffObject(t, "amd64"), bofCommandDefinitionFiles{Arch: "amd64", Path: "test.o"}, "main")
+	if !errors.Is(err, invalidBofObjectError) || !strings.Contains(err.Error(), "entrypoint") {
+		t.Fatalf("expected a missing entrypoint to be rejected, got %v", err)
+	}
+	_, err = validateBofObject([]byte("MZ not an object"), bofCommandDefinitionFiles{Arch: "amd64", Path: "test.o"}, "go")
+	if !errors.Is(err, invalidBofObjectError) {
+		t.Fatalf("expected a PE image to be rejected, got %v", err)
+	}
+	if supportedCoffRelocation(0x8664, 0xB) {
+		t.Fatalf("expected SECREL relocations to be unsupported")
+	}
+}
+
+func TestValidateBofObjects(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	objectPath := filepath.Join(".", PayloadTypeName, "collections", "Bench", "bof-0", "bof-0.x64.o")
+	if _, err := validateBofObjects(commandSource, source); !errors.Is(err, invalidBofObjectError) {
+		t.Fatalf("expected a missing object file to be rejected, got %v", err)
+	}
+	os.WriteFile(objectPath, testCoffObject(t, "amd64"), 0644)
+	objects, err := validateBofObjects(commandSource, source)
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("expected the object file to be valid, got %v: %v", objects, err)
+	}
+	if report := coffObjectReport(objects); !strings.Contains(report, "imports: BeaconPrintf, KERNEL32$GetLastError") {
+		t.Fatalf("expected the report to list imports, got %q", report)
+	}
+}
@@ -0,0 +1,612 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+// assemblyVersionAuto lets forge_create pick the version folder from the uploaded assembly's metadata
+const assemblyVersionAuto = "auto"
+
+var notDotNetAssemblyError = errors.New("file isn't a .NET assembly")
+var missingEntryPointError = errors.New("assembly doesn't have a managed entry point")
+var unsupportedFrameworkError = errors.New("assembly doesn't target a supported .NET Framework version")
+
+// CLR header flags from the IMAGE_COR20_HEADER
+const corFlagILOnly = 0x1
+const corFlag32BitRequired = 0x2
+const corFlagNativeEntryPoint = 0x10
+const corFlag32BitPreferred = 0x20000
+
+const metadataSignature = 0x424A5342
+const methodDefTokenType = 0x06
+
+// assemblyMetadata is what forge reads out of an assembly's PE/CLR headers and .NET metadata tables
+type assemblyMetadata struct {
+	Name            string
+	RuntimeVersion  string
+	TargetFramework string
+	Architecture    string
+	EntryPoint      string
+	References      []string
+	Resources       []string
+}
+
+// metadata table numbers from ECMA-335 II.22 that are needed to find the assembly's name, entry point, and attributes
+const (
+	tableModule                 = 0x00
+	tableTypeRef                = 0x01
+	tableTypeDef                = 0x02
+	tableFieldPtr               = 0x03
+	tableField                  = 0x04
+	tableMethodPtr              = 0x05
+	tableMethodDef              = 0x06
+	tableParamPtr               = 0x07
+	tableParam                  = 0x08
+	tableInterfaceImpl          = 0x09
+	tableMemberRef              = 0x0A
+	tableConstant               = 0x0B
+	tableCustomAttribute        = 0x0C
+	tableFieldMarshal           = 0x0D
+	tableDeclSecurity           = 0x0E
+	tableClassLayout            = 0x0F
+	tableFieldLayout            = 0x10
+	tableStandAloneSig          = 0x11
+	tableEventMap               = 0x12
+	tableEventPtr               = 0x13
+	tableEvent                  = 0x14
+	tablePropertyMap            = 0x15
+	tablePropertyPtr            = 0x16
+	tableProperty               = 0x17
+	tableMethodSemantics        = 0x18
+	tableMethodImpl             = 0x19
+	tableModuleRef              = 0x1A
+	tableTypeSpec               = 0x1B
+	tableImplMap                = 0x1C
+	tableFieldRVA               = 0x1D
+	tableEncLog                 = 0x1E
+	tableEncMap                 = 0x1F
+	tableAssembly               = 0x20
+	tableAssemblyProcessor      = 0x21
+	tableAssemblyOS             = 0x22
+	tableAssemblyRef            = 0x23
+	tableAssemblyRefProcessor   = 0x24
+	tableAssemblyRefOS          = 0x25
+	tableFile                   = 0x26
+	tableExportedType           = 0x27
+	tableManifestResource       = 0x28
+	tableNestedClass            = 0x29
+	tableGenericParam           = 0x2A
+	tableMethodSpec             = 0x2B
+	tableGenericParamConstraint = 0x2C
+	metadataTableCount          = 0x2D
+)
+
+// codedIndex is a table index that can point into one of several tables, with the table picked by the low tag bits
+type codedIndex struct {
+	tagBits int
+	tables  []int
+}
+
+var (
+	typeDefOrRef        = codedIndex{2, []int{tableTypeDef, tableTypeRef, tableTypeSpec}}
+	hasConstant         = codedIndex{2, []int{tableField, tableParam, tableProperty}}
+	hasCustomAttribute  = codedIndex{5, []int{tableMethodDef, tableField, tableTypeRef, tableTypeDef, tableParam, tableInterfaceImpl, tableMemberRef, tableModule, tableDeclSecurity, tableProperty, tableEvent, tableStandAloneSig, tableModuleRef, tableTypeSpec, tableAssembly, tableAssemblyRef, tableFile, tableExportedType, tableManifestResource, tableGenericParam, tableGenericParamConstraint, tableMethodSpec}}
+	hasFieldMarshal     = codedIndex{1, []int{tableField, tableParam}}
+	hasDeclSecurity     = codedIndex{2, []int{tableTypeDef, tableMethodDef, tableAssembly}}
+	memberRefParent     = codedIndex{3, []int{tableTypeDef, tableTypeRef, tableModuleRef, tableMethodDef, tableTypeSpec}}
+	hasSemantics        = codedIndex{1, []int{tableEvent, tableProperty}}
+	methodDefOrRef      = codedIndex{1, []int{tableMethodDef, tableMemberRef}}
+	memberForwarded     = codedIndex{1, []int{tableField, tableMethodDef}}
+	implementation      = codedIndex{2, []int{tableFile, tableAssemblyRef, tableExportedType}}
+	customAttributeType = codedIndex{3, []int{tableMethodDef, tableMemberRef}}
+	resolutionScope     = codedIndex{2, []int{tableModule, tableModuleRef, tableAssemblyRef, tableTypeRef}}
+	typeOrMethodDef     = codedIndex{1, []int{tableTypeDef, tableMethodDef}}
+)
+
+// coded index tags used to follow custom attributes back to TargetFrameworkAttribute
+const hasCustomAttributeAssemblyTag = 14
+const customAttributeTypeMemberRefTag = 3
+const memberRefParentTypeRefTag = 1
+
+// metadataColumn is either a fixed size (1, 2, or 4 bytes), a heap index, a table index, or a coded index
+type metadataColumn struct {
+	size  int
+	heap  byte
+	table int
+	coded *codedIndex
+}
+
+func fixedColumn(size int) metadataColumn     { return metadataColumn{size: size, table: -1} }
+func heapColumn(heap byte) metadataColumn     { return metadataColumn{heap: heap, table: -1} }
+func tableColumn(table int) metadataColumn    { return metadataColumn{table: table} }
+func codedColumn(c codedIndex) metadataColumn { return metadataColumn{table: -1, coded: &c} }
+
+var (
+	u1        = fixedColumn(1)
+	u2        = fixedColumn(2)
+	u4        = fixedColumn(4)
+	stringIdx = heapColumn('s')
+	guidIdx   = heapColumn('g')
+	blobIdx   = heapColumn('b')
+)
+
+// metadataSchema lists every table's columns so row sizes can be calculated for the tables that come before the ones forge reads
+var metadataSchema = [metadataTableCount][]metadataColumn{
+	tableModule:                 {u2, stringIdx, guidIdx, guidIdx, guidIdx},
+	tableTypeRef:                {codedColumn(resolutionScope), stringIdx, stringIdx},
+	tableTypeDef:                {u4, stringIdx, stringIdx, codedColumn(typeDefOrRef), tableColumn(tableField), tableColumn(tableMethodDef)},
+	tableFieldPtr:               {tableColumn(tableField)},
+	tableField:                  {u2, stringIdx, blobIdx},
+	tableMethodPtr:              {tableColumn(tableMethodDef)},
+	tableMethodDef:              {u4, u2, u2, stringIdx, blobIdx, tableColumn(tableParam)},
+	tableParamPtr:               {tableColumn(tableParam)},
+	tableParam:                  {u2, u2, stringIdx},
+	tableInterfaceImpl:          {tableColumn(tableTypeDef), codedColumn(typeDefOrRef)},
+	tableMemberRef:              {codedColumn(memberRefParent), stringIdx, blobIdx},
+	tableConstant:               {u1, u1, codedColumn(hasConstant), blobIdx},
+	tableCustomAttribute:        {codedColumn(hasCustomAttribute), codedColumn(customAttributeType), blobIdx},
+	tableFieldMarshal:           {codedColumn(hasFieldMarshal), blobIdx},
+	tableDeclSecurity:           {u2, codedColumn(hasDeclSecurity), blobIdx},
+	tableClassLayout:            {u2, u4, tableColumn(tableTypeDef)},
+	tableFieldLayout:            {u4, tableColumn(tableField)},
+	tableStandAloneSig:          {blobIdx},
+	tableEventMap:               {tableColumn(tableTypeDef), tableColumn(tableEvent)},
+	tableEventPtr:               {tableColumn(tableEvent)},
+	tableEvent:                  {u2, stringIdx, codedColumn(typeDefOrRef)},
+	tablePropertyMap:            {tableColumn(tableTypeDef), tableColumn(tableProperty)},
+	tablePropertyPtr:            {tableColumn(tableProperty)},
+	tableProperty:               {u2, stringIdx, blobIdx},
+	tableMethodSemantics:        {u2, tableColumn(tableMethodDef), codedColumn(hasSemantics)},
+	tableMethodImpl:             {tableColumn(tableTypeDef), codedColumn(methodDefOrRef), codedColumn(methodDefOrRef)},
+	tableModuleRef:              {stringIdx},
+	tableTypeSpec:               {blobIdx},
+	tableImplMap:                {u2, codedColumn(memberForwarded), stringIdx, tableColumn(tableModuleRef)},
+	tableFieldRVA:               {u4, tableColumn(tableField)},
+	tableEncLog:                 {u4, u4},
+	tableEncMap:                 {u4},
+	tableAssembly:               {u4, u2, u2, u2, u2, u4, blobIdx, stringIdx, stringIdx},
+	tableAssemblyProcessor:      {u4},
+	tableAssemblyOS:             {u4, u4, u4},
+	tableAssemblyRef:            {u2, u2, u2, u2, u4, blobIdx, stringIdx, stringIdx, blobIdx},
+	tableAssemblyRefProcessor:   {u4, tableColumn(tableAssemblyRef)},
+	tableAssemblyRefOS:          {u4, u4, u4, tableColumn(tableAssemblyRef)},
+	tableFile:                   {u4, stringIdx, blobIdx},
+	tableExportedType:           {u4, u4, stringIdx, stringIdx, codedColumn(implementation)},
+	tableManifestResource:       {u4, u4, stringIdx, codedColumn(implementation)},
+	tableNestedClass:            {tableColumn(tableTypeDef), tableColumn(tableTypeDef)},
+	tableGenericParam:           {u2, u2, codedColumn(typeOrMethodDef), stringIdx},
+	tableMethodSpec:             {codedColumn(methodDefOrRef), blobIdx},
+	tableGenericParamConstraint: {tableColumn(tableGenericParam), codedColumn(typeDefOrRef)},
+}
+
+// metadataTables reads rows out of the #~ stream
+type metadataTables struct {
+	heapSizes byte
+	rows      [metadataTableCount]uint32
+	offsets   [metadataTableCount]int
+	rowSizes  [metadataTableCount]int
+	tables    []byte
+	strings   []byte
+	blobs     []byte
+}
+
+func (m *metadataTables) columnWidth(column metadataColumn) int {
+	switch {
+	case column.size > 0:
+		return column.size
+	case column.heap == 's' && m.heapSizes&0x01 != 0, column.heap == 'g' && m.heapSizes&0x02 != 0, column.heap == 'b' && m.heapSizes&0x04 != 0:
+		return 4
+	case column.heap != 0:
+		return 2
+	case column.coded != nil:
+		maxRows := uint32(0)
+		for _, table := range column.coded.tables {
+			maxRows = max(maxRows, m.rows[table])
+		}
+		if maxRows < 1<<(16-column.coded.tagBits) {
+			return 2
+		}
+		return 4
+	case m.rows[column.table] > 0xFFFF:
+		return 4
+	default:
+		return 2
+	}
+}
+
+// cellOffset is where one column of a row starts in the tables stream, with rows numbered from 1 like metadata tokens
+func (m *metadataTables) cellOffset(table int, row uint32, column int) int {
+	offset := m.offsets[table] + int(row-1)*m.rowSizes[table]
+	for _, previous := range metadataSchema[table][:column] {
+		offset += m.columnWidth(previous)
+	}
+	return offset
+}
+
+// cell returns one column of a row, with rows numbered from 1 like metadata tokens
+func (m *metadataTables) cell(table int, row uint32, column int) uint32 {
+	if row == 0 || row > m.rows[table] {
+		return 0
+	}
+	offset := m.cellOffset(table, row, column)
+	switch m.columnWidth(metadataSchema[table][column]) {
+	case 1:
+		return uint32(m.tables[offset])
+	case 2:
+		return uint32(binary.LittleEndian.Uint16(m.tables[offset:]))
+	default:
+		return binary.LittleEndian.Uint32(m.tables[offset:])
+	}
+}
+
+func (m *metadataTables) string(index uint32) string {
+	if int(index) >= len(m.strings) {
+		return ""
+	}
+	value := m.strings[index:]
+	if end := bytes.IndexByte(value, 0); end >= 0 {
+		value = value[:end]
+	}
+	return string(value)
+}
+
+// readCompressedUint decodes ECMA-335 II.23.2 compressed unsigned integers, returning the value and its length
+func readCompressedUint(data []byte) (uint32, int) {
+	switch {
+	case len(data) >= 1 && data[0]&0x80 == 0:
+		return uint32(data[0]), 1
+	case len(data) >= 2 && data[0]&0xC0 == 0x80:
+		return uint32(data[0]&0x3F)<<8 | uint32(data[1]), 2
+	case len(data) >= 4 && data[0]&0xE0 == 0xC0:
+		return uint32(data[0]&0x1F)<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3]), 4
+	default:
+		return 0, 0
+	}
+}
+
+func (m *metadataTables) blob(index uint32) []byte {
+	if int(index) >= len(m.blobs) {
+		return nil
+	}
+	length, read := readCompressedUint(m.blobs[index:])
+	start := int(index) + read
+	if read == 0 || start+int(length) > len(m.blobs) {
+		return nil
+	}
+	return m.blobs[start : start+int(length)]
+}
+
+func parseMetadataTables(stream []byte, stringsHeap []byte, blobHeap []byte) (*metadataTables, error) {
+	if len(stream) < 24 {
+		return nil, errors.New("metadata tables stream is truncated")
+	}
+	m := &metadataTables{heapSizes: stream[6], strings: stringsHeap, blobs: blobHeap}
+	valid := binary.LittleEndian.Uint64(stream[8:])
+	offset := 24
+	for table := 0; table < 64; table++ {
+		if valid&(1<<table) == 0 {
+			continue
+		}
+		if offset+4 > len(stream) {
+			return nil, errors.New("metadata tables stream is truncated")
+		}
+		if table < metadataTableCount {
+			m.rows[table] = binary.LittleEndian.Uint32(stream[offset:])
+		} else {
+			return nil, fmt.Errorf("unknown metadata table 0x%x", table)
+		}
+		offset += 4
+	}
+	if m.heapSizes&0x40 != 0 {
+		// some obfuscators add an extra uint32 after the row counts
+		offset += 4
+	}
+	for table := 0; table < metadataTableCount; table++ {
+		for _, column := range metadataSchema[table] {
+			m.rowSizes[table] += m.columnWidth(column)
+		}
+		m.offsets[table] = offset
+		offset += m.rowSizes[table] * int(m.rows[table])
+	}
+	if offset > len(stream) {
+		return nil, errors.New("metadata tables are larger than their stream")
+	}
+	m.tables = stream
+	return m, nil
+}
+
+// readRVA returns size bytes starting at a relative virtual address
+func readRVA(peFile *pe.File, rva uint32, size uint32) ([]byte, error) {
+	for _, section := range peFile.Sections {
+		if rva < section.VirtualAddress || rva >= section.VirtualAddress+max(section.VirtualSize, section.Size) {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, err
+		}
+		start := rva - section.VirtualAddress
+		if uint64(start)+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("data at 0x%x extends past its section", rva)
+		}
+		return data[start : start+size], nil
+	}
+	return nil, fmt.Errorf("no section contains 0x%x", rva)
+}
+
+// targetFramework finds the assembly's TargetFrameworkAttribute value, ex: .NETFramework,Version=v4.7.2
+func (m *metadataTables) targetFramework() string {
+	for row := uint32(1); row <= m.rows[tableCustomAttribute]; row++ {
+		parent := m.cell(tableCustomAttribute, row, 0)
+		attributeType := m.cell(tableCustomAttribute, row, 1)
+		if parent&0x1F != hasCustomAttributeAssemblyTag || attributeType&0x7 != customAttributeTypeMemberRefTag {
+			continue
+		}
+		class := m.cell(tableMemberRef, attributeType>>3, 0)
+		if class&0x7 != memberRefParentTypeRefTag {
+			continue
+		}
+		typeRef := class >> 3
+		if m.string(m.cell(tableTypeRef, typeRef, 1)) != "TargetFrameworkAttribute" ||
+			m.string(m.cell(tableTypeRef, typeRef, 2)) != "System.Runtime.Versioning" {
+			continue
+		}
+		// custom attribute blobs start with a 0x0001 prolog followed by the constructor's string argument
+		value := m.blob(m.cell(tableCustomAttribute, row, 2))
+		if len(value) < 3 || value[0] != 0x01 || value[1] != 0x00 || value[2] == 0xFF {
+			return ""
+		}
+		length, read := readCompressedUint(value[2:])
+		if read == 0 || 2+read+int(length) > len(value) {
+			return ""
+		}
+		return string(value[2+read : 2+read+int(length)])
+	}
+	return ""
+}
+
+// methodName returns Namespace.Type.Method for a MethodDef row
+func (m *metadataTables) methodName(methodRow uint32) string {
+	name := m.string(m.cell(tableMethodDef, methodRow, 3))
+	for typeRow := m.rows[tableTypeDef]; typeRow >= 1; typeRow-- {
+		if m.cell(tableTypeDef, typeRow, 5) > methodRow {
+			continue
+		}
+		typeName := m.string(m.cell(tableTypeDef, typeRow, 1))
+		if typeNamespace := m.string(m.cell(tableTypeDef, typeRow, 2)); typeNamespace != "" {
+			typeName = typeNamespace + "." + typeName
+		}
+		return typeName + "." + name
+	}
+	return name
+}
+
+// metadataStream is one of the heaps listed in the metadata root, with headerOffset pointing at its offset and size
+type metadataStream struct {
+	name         string
+	offset       uint32
+	size         uint32
+	headerOffset int
+}
+
+// readMetadataStreams returns the runtime version and stream headers from a metadata root
+func readMetadataStreams(metadataRoot []byte) (string, []metadataStream, error) {
+	if len(metadataRoot) < 16 || binary.LittleEndian.Uint32(metadataRoot) != metadataSignature {
+		return "", nil, errors.New("metadata is missing or corrupt")
+	}
+	versionLength := int(binary.LittleEndian.Uint32(metadataRoot[12:]))
+	if 16+versionLength+4 > len(metadataRoot) {
+		return "", nil, errors.New("metadata is truncated")
+	}
+	runtimeVersion := strings.TrimRight(string(metadataRoot[16:16+versionLength]), "\x00")
+	streams := []metadataStream{}
+	offset := 16 + versionLength + 2
+	streamCount := int(binary.LittleEndian.Uint16(metadataRoot[offset:]))
+	offset += 2
+	for i := 0; i < streamCount && offset+8 < len(metadataRoot); i++ {
+		stream := metadataStream{
+			offset:       binary.LittleEndian.Uint32(metadataRoot[offset:]),
+			size:         binary.LittleEndian.Uint32(metadataRoot[offset+4:]),
+			headerOffset: offset,
+		}
+		nameEnd := bytes.IndexByte(metadataRoot[offset+8:], 0)
+		if nameEnd < 0 {
+			break
+		}
+		stream.name = string(metadataRoot[offset+8 : offset+8+nameEnd])
+		if uint64(stream.offset)+uint64(stream.size) <= uint64(len(metadataRoot)) {
+			streams = append(streams, stream)
+		}
+		// stream names are null terminated and padded to 4 bytes
+		offset += 8 + (nameEnd+4)&^3
+	}
+	return runtimeVersion, streams, nil
+}
+
+// clrDirectory returns the data directory entry for the assembly's CLR header
+func clrDirectory(peFile *pe.File) pe.DataDirectory {
+	switch optionalHeader := peFile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if optionalHeader.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR {
+			return optionalHeader.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR]
+		}
+	case *pe.OptionalHeader64:
+		if optionalHeader.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR {
+			return optionalHeader.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR]
+		}
+	}
+	return pe.DataDirectory{}
+}
+
+// inspectAssembly parses an assembly's PE and CLR headers along with its metadata tables, failing for files that
+// aren't .NET assemblies or that don't have a managed entry point to run
+func inspectAssembly(contents []byte) (assemblyMetadata, error) {
+	metadata := assemblyMetadata{}
+	peFile, err := pe.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return metadata, fmt.Errorf("%w: %s", notDotNetAssemblyError, err.Error())
+	}
+	defer peFile.Close()
+	clrHeaderDirectory := clrDirectory(peFile)
+	if clrHeaderDirectory.VirtualAddress == 0 || clrHeaderDirectory.Size < 24 {
+		return metadata, fmt.Errorf("%w: there's no CLR header", notDotNetAssemblyError)
+	}
+	clrHeader, err := readRVA(peFile, clrHeaderDirectory.VirtualAddress, 24)
+	if err != nil {
+		return metadata, fmt.Errorf("%w: %s", notDotNetAssemblyError, err.Error())
+	}
+	corFlags := binary.LittleEndian.Uint32(clrHeader[16:])
+	entryPointToken := binary.LittleEndian.Uint32(clrHeader[20:])
+	switch peFile.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		metadata.Architecture = "x64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		metadata.Architecture = "Any"
+		if corFlags&corFlagILOnly == 0 || (corFlags&corFlag32BitRequired != 0 && corFlags&corFlag32BitPreferred == 0) {
+			metadata.Architecture = "x86"
+		}
+	default:
+		return metadata, fmt.Errorf("%w: unsupported machine type 0x%x", unsupportedFrameworkError, peFile.Machine)
+	}
+
+	metadataRoot, err := readRVA(peFile, binary.LittleEndian.Uint32(clrHeader[8:]), binary.LittleEndian.Uint32(clrHeader[12:]))
+	if err != nil {
+		return metadata, fmt.Errorf("%w: metadata is missing or corrupt", notDotNetAssemblyError)
+	}
+	runtimeVersion, streamHeaders, err := readMetadataStreams(metadataRoot)
+	if err != nil {
+		return metadata, fmt.Errorf("%w: %s", notDotNetAssemblyError, err.Error())
+	}
+	metadata.RuntimeVersion = runtimeVersion
+	streams := map[string][]byte{}
+	for _, stream := range streamHeaders {
+		streams[stream.name] = metadataRoot[stream.offset : stream.offset+stream.size]
+	}
+	tableStream, ok := streams["#~"]
+	if !ok {
+		tableStream = streams["#-"]
+	}
+	tables, err := parseMetadataTables(tableStream, streams["#Strings"], streams["#Blob"])
+	if err != nil {
+		return metadata, fmt.Errorf("%w: %s", notDotNetAssemblyError, err.Error())
+	}
+	if tables.rows[tableAssembly] == 0 {
+		return metadata, fmt.Errorf("%w: it's a module without an assembly manifest", notDotNetAssemblyError)
+	}
+	metadata.Name = tables.string(tables.cell(tableAssembly, 1, 7))
+	metadata.TargetFramework = tables.targetFramework()
+	for row := uint32(1); row <= tables.rows[tableAssemblyRef]; row++ {
+		metadata.References = append(metadata.References, tables.string(tables.cell(tableAssemblyRef, row, 6)))
+	}
+	for row := uint32(1); row <= tables.rows[tableManifestResource]; row++ {
+		metadata.Resources = append(metadata.Resources, tables.string(tables.cell(tableManifestResource, row, 2)))
+	}
+	if corFlags&corFlagNativeEntryPoint != 0 || entryPointToken>>24 != methodDefTokenType ||
+		entryPointToken&0xFFFFFF == 0 || entryPointToken&0xFFFFFF > tables.rows[tableMethodDef] {
+		return metadata, missingEntryPointError
+	}
+	metadata.EntryPoint = tables.methodName(entryPointToken & 0xFFFFFF)
+	return metadata, nil
+}
+
+// frameworkVersion maps the assembly's target framework onto the framework part of assemblyVersions. Assemblies
+// without a TargetFrameworkAttribute (ex: .NET 3.5 and older) are treated as 4.0 since they load in CLR 4.
+func (m assemblyMetadata) frameworkVersion() (string, error) {
+	if m.TargetFramework == "" {
+		if strings.HasPrefix(m.RuntimeVersion, "v4.") || strings.HasPrefix(m.RuntimeVersion, "v2.") {
+			return "4.0", nil
+		}
+		return "", fmt.Errorf("%w: runtime %s", unsupportedFrameworkError, m.RuntimeVersion)
+	}
+	framework, version, _ := strings.Cut(m.TargetFramework, ",Version=v")
+	if framework != ".NETFramework" {
+		return "", fmt.Errorf("%w: %s", unsupportedFrameworkError, m.TargetFramework)
+	}
+	majorText, minorText, _ := strings.Cut(version, ".")
+	minorText, _, _ = strings.Cut(minorText, ".")
+	major, err := strconv.Atoi(majorText)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", unsupportedFrameworkError, m.TargetFramework)
+	}
+	minor, _ := strconv.Atoi(minorText)
+	switch {
+	case major < 4:
+		return "4.0", nil
+	case major == 4 && minor < 5:
+		return "4.0", nil
+	case major == 4 && minor < 7:
+		return "4.5", nil
+	case major == 4:
+		return "4.7", nil
+	default:
+		return "", fmt.Errorf("%w: %s", unsupportedFrameworkError, m.TargetFramework)
+	}
+}
+
+// assemblyVersion returns which assemblyVersions folder the assembly belongs in, ex: 4.7_Any
+func (m assemblyMetadata) assemblyVersion() (string, error) {
+	framework, err := m.frameworkVersion()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_%s", framework, m.Architecture), nil
+}
+
+func (m assemblyMetadata) String() string {
+	target := m.TargetFramework
+	if target == "" {
+		target = "runtime " + m.RuntimeVersion
+	}
+	return fmt.Sprintf("%s (%s, %s, entry point %s)", m.Name, target, m.Architecture, m.EntryPoint)
+}
+
+// checkAssemblyVersion makes sure a chosen version folder matches what's in the assembly, or picks it for "auto"
+func checkAssemblyVersion(metadata assemblyMetadata, chosenVersion string) (string, error) {
+	detectedVersion, err := metadata.assemblyVersion()
+	if err != nil {
+		return "", err
+	}
+	if chosenVersion == "" || chosenVersion == assemblyVersionAuto {
+		return detectedVersion, nil
+	}
+	if chosenVersion != detectedVersion {
+		return "", fmt.Errorf("version %s doesn't match the assembly, which is %s: %s", chosenVersion, detectedVersion, metadata.String())
+	}
+	return chosenVersion, nil
+}
+
+// verifyStoredAssembly deletes a downloaded file that isn't a .NET assembly with an entry point so it's not registered
+func verifyStoredAssembly(filePath string) error {
+	contents, err := readStoredFile(filePath)
+	if err != nil {
+		return err
+	}
+	if _, err = inspectAssembly(contents); err != nil {
+		os.Remove(filePath)
+		return err
+	}
+	return nil
+}
+
+// inspectMythicAssembly fetches an uploaded file from Mythic and inspects it
+func inspectMythicAssembly(agentFileID string) (assemblyMetadata, error) {
+	fileContentsResp, err := mythicrpc.SendMythicRPCFileGetContent(mythicrpc.MythicRPCFileGetContentMessage{
+		AgentFileID: agentFileID,
+	})
+	if err != nil {
+		return assemblyMetadata{}, err
+	}
+	if !fileContentsResp.Success {
+		return assemblyMetadata{}, errors.New(fileContentsResp.Error)
+	}
+	return inspectAssembly(fileContentsResp.Content)
+}
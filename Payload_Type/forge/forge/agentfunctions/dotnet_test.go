@@ -0,0 +1,218 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// nativePE builds the smallest PE file debug/pe will parse, with no CLR header like a native executable
+func nativePE() []byte {
+	buf := &bytes.Buffer{}
+	dosHeader := make([]byte, 0x40)
+	copy(dosHeader, "MZ")
+	binary.LittleEndian.PutUint32(dosHeader[0x3c:], 0x40)
+	buf.Write(dosHeader)
+	buf.WriteString("PE\x00\x00")
+	optionalHeaderSize := 96 + 16*8
+	binary.Write(buf, binary.LittleEndian, []uint16{0x14c, 0})
+	binary.Write(buf, binary.LittleEndian, []uint32{0, 0, 0})
+	binary.Write(buf, binary.LittleEndian, []uint16{uint16(optionalHeaderSize), 0x102})
+	optionalHeader := make([]byte, optionalHeaderSize)
+	binary.LittleEndian.PutUint16(optionalHeader, 0x10b)
+	binary.LittleEndian.PutUint32(optionalHeader[92:], 16)
+	buf.Write(optionalHeader)
+	return buf.Bytes()
+}
+
+// testAssembly builds a minimal .NET Framework console assembly with a Namespace.Program.Main entry point, a debug
+// directory pointing at a PDB, and an AssemblyRef row for each reference. The namespace shares the assembly's name.
+func testAssembly(name string, references ...string) []byte {
+	// strings that are the suffix of one that's already in the heap point into it, like Roslyn does
+	stringsHeap := []byte{0}
+	addString := func(value string) uint16 {
+		if index := bytes.Index(stringsHeap, []byte(value+"\x00")); index > 0 {
+			return uint16(index)
+		}
+		index := uint16(len(stringsHeap))
+		stringsHeap = append(stringsHeap, value+"\x00"...)
+		return index
+	}
+	referenceIndexes := []uint16{}
+	for _, reference := range references {
+		referenceIndexes = append(referenceIndexes, addString(reference))
+	}
+	nameIndex := addString(name)
+	moduleIndex := addString(name + ".exe")
+	typeIndex := addString("Program")
+	methodIndex := addString("Main")
+	for len(stringsHeap)%4 != 0 {
+		stringsHeap = append(stringsHeap, 0)
+	}
+	guidHeap := []byte("0123456789abcdef")
+	blobHeap := []byte{0, 3, 0, 0, 1, 0}
+
+	tables := &bytes.Buffer{}
+	valid := uint64(1<<tableModule | 1<<tableTypeDef | 1<<tableMethodDef | 1<<tableAssembly)
+	if len(references) > 0 {
+		valid |= 1 << tableAssemblyRef
+	}
+	binary.Write(tables, binary.LittleEndian, []uint32{0, 2})
+	binary.Write(tables, binary.LittleEndian, []uint64{valid, 0})
+	binary.Write(tables, binary.LittleEndian, []uint32{1, 1, 1, 1})
+	if len(references) > 0 {
+		binary.Write(tables, binary.LittleEndian, uint32(len(references)))
+	}
+	binary.Write(tables, binary.LittleEndian, []uint16{0, moduleIndex, 1, 0, 0})
+	binary.Write(tables, binary.LittleEndian, uint32(0x100000))
+	binary.Write(tables, binary.LittleEndian, []uint16{typeIndex, nameIndex, 0, 1, 1})
+	binary.Write(tables, binary.LittleEndian, uint32(0))
+	binary.Write(tables, binary.LittleEndian, []uint16{0, 0x16, methodIndex, 1, 1})
+	binary.Write(tables, binary.LittleEndian, uint32(0x8004))
+	binary.Write(tables, binary.LittleEndian, []uint16{1, 0, 0, 0})
+	binary.Write(tables, binary.LittleEndian, uint32(0))
+	binary.Write(tables, binary.LittleEndian, []uint16{0, nameIndex, 0})
+	for _, referenceIndex := range referenceIndexes {
+		binary.Write(tables, binary.LittleEndian, []uint16{1, 0, 0, 0})
+		binary.Write(tables, binary.LittleEndian, uint32(0))
+		binary.Write(tables, binary.LittleEndian, []uint16{0, referenceIndex, 0, 0})
+	}
+	for tables.Len()%4 != 0 {
+		tables.WriteByte(0)
+	}
+
+	streams := []struct {
+		name string
+		data []byte
+	}{{"#~", tables.Bytes()}, {"#Strings", stringsHeap}, {"#GUID", guidHeap}, {"#Blob", blobHeap}}
+	headerSize := 16 + 12 + 4
+	for _, stream := range streams {
+		headerSize += 8 + (len(stream.name)+4)&^3
+	}
+	metadata := &bytes.Buffer{}
+	binary.Write(metadata, binary.LittleEndian, []uint32{metadataSignature, 0x00010001, 0, 12})
+	metadata.WriteString("v4.0.30319\x00\x00")
+	binary.Write(metadata, binary.LittleEndian, []uint16{0, uint16(len(streams))})
+	streamOffset := headerSize
+	for _, stream := range streams {
+		binary.Write(metadata, binary.LittleEndian, []uint32{uint32(streamOffset), uint32(len(stream.data))})
+		metadata.WriteString(stream.name)
+		metadata.Write(make([]byte, (len(stream.name)+4)&^3-len(stream.name)))
+		streamOffset += (len(stream.data) + 3) &^ 3
+	}
+	for _, stream := range streams {
+		metadata.Write(stream.data)
+		metadata.Write(make([]byte, (len(stream.data)+3)&^3-len(stream.data)))
+	}
+
+	// .text is the CLR header, metadata, debug directory, and CodeView data, .reloc is just padding
+	const textRVA, relocRVA, fileAlignment = 0x2000, 0x4000, 0x200
+	metadataRVA := textRVA + 72
+	debugRVA := metadataRVA + metadata.Len()
+	codeView := append([]byte("RSDS0123456789abcdef\x01\x00\x00\x00"), "C:\\build\\"+name+"\\obj\\Release\\"+name+".pdb\x00"...)
+	text := &bytes.Buffer{}
+	binary.Write(text, binary.LittleEndian, []uint32{72, 0x00050002, uint32(metadataRVA), uint32(metadata.Len()), corFlagILOnly, 0x06000001})
+	text.Write(make([]byte, 72-24))
+	text.Write(metadata.Bytes())
+	binary.Write(text, binary.LittleEndian, []uint32{0, 0, 0, 2, uint32(len(codeView)), uint32(debugRVA + 28), uint32(fileAlignment + debugRVA + 28 - textRVA)})
+	text.Write(codeView)
+	textSize := text.Len()
+	text.Write(make([]byte, (textSize+fileAlignment-1)/fileAlignment*fileAlignment-textSize))
+
+	image := &bytes.Buffer{}
+	dosHeader := make([]byte, 0x40)
+	copy(dosHeader, "MZ")
+	binary.LittleEndian.PutUint32(dosHeader[0x3c:], 0x40)
+	image.Write(dosHeader)
+	image.WriteString("PE\x00\x00")
+	optionalHeaderSize := 96 + 16*8
+	binary.Write(image, binary.LittleEndian, []uint16{0x14c, 2})
+	binary.Write(image, binary.LittleEndian, []uint32{0, 0, 0})
+	binary.Write(image, binary.LittleEndian, []uint16{uint16(optionalHeaderSize), 0x102})
+	optionalHeader := make([]byte, optionalHeaderSize)
+	binary.LittleEndian.PutUint16(optionalHeader, 0x10b)
+	binary.LittleEndian.PutUint32(optionalHeader[28:], 0x400000)
+	binary.LittleEndian.PutUint32(optionalHeader[32:], 0x2000)
+	binary.LittleEndian.PutUint32(optionalHeader[36:], fileAlignment)
+	binary.LittleEndian.PutUint32(optionalHeader[56:], 0x6000)
+	binary.LittleEndian.PutUint32(optionalHeader[60:], fileAlignment)
+	binary.LittleEndian.PutUint32(optionalHeader[92:], 16)
+	binary.LittleEndian.PutUint32(optionalHeader[96+6*8:], uint32(debugRVA))
+	binary.LittleEndian.PutUint32(optionalHeader[96+6*8+4:], 28)
+	binary.LittleEndian.PutUint32(optionalHeader[96+14*8:], textRVA)
+	binary.LittleEndian.PutUint32(optionalHeader[96+14*8+4:], 72)
+	image.Write(optionalHeader)
+	writeSection := func(name string, rva int, virtualSize int, rawSize int, rawOffset int, characteristics uint32) {
+		sectionName := make([]byte, 8)
+		copy(sectionName, name)
+		image.Write(sectionName)
+		binary.Write(image, binary.LittleEndian, []uint32{uint32(virtualSize), uint32(rva), uint32(rawSize), uint32(rawOffset), 0, 0, 0})
+		binary.Write(image, binary.LittleEndian, characteristics)
+	}
+	writeSection(".text", textRVA, textSize, text.Len(), fileAlignment, 0x60000020)
+	writeSection(".reloc", relocRVA, 12, fileAlignment, fileAlignment+text.Len(), 0x42000040)
+	image.Write(make([]byte, fileAlignment-image.Len()))
+	image.Write(text.Bytes())
+	image.Write(make([]byte, fileAlignment))
+	return image.Bytes()
+}
+
+func TestInspectAssembly(t *testing.T) {
+	metadata, err := inspectAssembly(testAssembly("Seatbelt"))
+	if err != nil {
+		t.Fatalf("expected the test assembly to parse, got %v", err)
+	}
+	if metadata.Name != "Seatbelt" || metadata.EntryPoint != "Seatbelt.Program.Main" || metadata.Architecture != "Any" {
+		t.Fatalf("unexpected metadata: %+v", metadata)
+	}
+}
+
+func TestAssemblyFrameworkVersions(t *testing.T) {
+	tests := []struct {
+		metadata assemblyMetadata
+		version  string
+	}{
+		{assemblyMetadata{RuntimeVersion: "v2.0.50727", Architecture: "Any"}, "4.0_Any"},
+		{assemblyMetadata{RuntimeVersion: "v4.0.30319", Architecture: "x86"}, "4.0_x86"},
+		{assemblyMetadata{TargetFramework: ".NETFramework,Version=v4.0", Architecture: "Any"}, "4.0_Any"},
+		{assemblyMetadata{TargetFramework: ".NETFramework,Version=v4.5.2", Architecture: "x64"}, "4.5_x64"},
+		{assemblyMetadata{TargetFramework: ".NETFramework,Version=v4.6.1", Architecture: "Any"}, "4.5_Any"},
+		{assemblyMetadata{TargetFramework: ".NETFramework,Version=v4.8", Architecture: "Any"}, "4.7_Any"},
+	}
+	for _, test := range tests {
+		version, err := checkAssemblyVersion(test.metadata, assemblyVersionAuto)
+		if err != nil || version != test.version {
+			t.Fatalf("expected %s for %+v, got %s: %v", test.version, test.metadata, version, err)
+		}
+	}
+	netCore := assemblyMetadata{RuntimeVersion: "v4.0.30319", TargetFramework: ".NETCoreApp,Version=v8.0", Architecture: "Any"}
+	if _, err := checkAssemblyVersion(netCore, assemblyVersionAuto); !errors.Is(err, unsupportedFrameworkError) {
+		t.Fatalf("expected .NET Core assemblies to be rejected, got %v", err)
+	}
+	framework47 := assemblyMetadata{TargetFramework: ".NETFramework,Version=v4.7.2", Architecture: "x64"}
+	if version, err := checkAssemblyVersion(framework47, "4.7_x64"); err != nil || version != "4.7_x64" {
+		t.Fatalf("expected a matching version to be accepted, got %s: %v", version, err)
+	}
+	if _, err := checkAssemblyVersion(framework47, "4.0_Any"); err == nil {
+		t.Fatalf("expected a version that doesn't match the assembly to be rejected")
+	}
+}
+
+func TestInspectAssemblyRejectsNativeFiles(t *testing.T) {
+	if _, err := inspectAssembly([]byte("not a pe file")); !errors.Is(err, notDotNetAssemblyError) {
+		t.Fatalf("expected random bytes to be rejected, got %v", err)
+	}
+	if _, err := inspectAssembly(nativePE()); !errors.Is(err, notDotNetAssemblyError) {
+		t.Fatalf("expected a native executable to be rejected, got %v", err)
+	}
+	t.Chdir(t.TempDir())
+	os.WriteFile("native.exe", nativePE(), 0644)
+	if err := verifyStoredAssembly("native.exe"); err == nil {
+		t.Fatalf("expected verifying a native executable to fail")
+	}
+	if _, err := os.Stat("native.exe"); !os.IsNotExist(err) {
+		t.Fatalf("expected the invalid download to be removed, got %v", err)
+	}
+}
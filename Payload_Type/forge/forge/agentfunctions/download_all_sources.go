@@ -1,75 +1,344 @@
 package agentfunctions
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/MythicMeta/MythicContainer/logging"
 )
 
-func DownloadEverything() {
-	collections := getCollectionSources()
+// PrefetchSummaryFilename is where the download summary is written in the forge folder unless -summary says otherwise
+const PrefetchSummaryFilename = "download_summary.json"
+
+const prefetchStatusDownloaded = "downloaded"
+const prefetchStatusSkipped = "skipped"
+const prefetchStatusFailed = "failed"
+
+type prefetchOptions struct {
+	Workers          int
+	Retries          int
+	RetryDelay       time.Duration
+	Collections      []string
+	Names            []string
+	Force            bool
+	FailureThreshold float64
+	SummaryPath      string
+}
+
+// prefetchJob is a single command to download; assemblies try every version for the command within one job
+type prefetchJob struct {
+	collection collectionSource
+	command    collectionSourceCommandData
+}
+
+type prefetchResult struct {
+	Collection string   `json:"collection"`
+	Command    string   `json:"command"`
+	Type       string   `json:"type"`
+	Status     string   `json:"status"`
+	Versions   []string `json:"versions,omitempty"`
+	Attempts   int      `json:"attempts"`
+	Error      string   `json:"error,omitempty"`
+	Seconds    float64  `json:"seconds"`
+}
+
+type prefetchSummary struct {
+	Total            int              `json:"total"`
+	Downloaded       int              `json:"downloaded"`
+	Skipped          int              `json:"skipped"`
+	Failed           int              `json:"failed"`
+	FailurePercent   float64          `json:"failure_percent"`
+	FailureThreshold float64          `json:"failure_threshold"`
+	Seconds          float64          `json:"seconds"`
+	Results          []prefetchResult `json:"results"`
+}
+
+// prefetchFunc downloads a job, returning the versions that are on disk and if everything was already there
+type prefetchFunc func(job prefetchJob, force bool) (versions []string, skipped bool, err error)
+
+func parsePrefetchOptions(args []string) (prefetchOptions, error) {
+	options := prefetchOptions{}
+	flags := flag.NewFlagSet("download", flag.ContinueOnError)
+	flags.IntVar(&options.Workers, "workers", 8, "number of commands to download at the same time")
+	flags.IntVar(&options.Retries, "retries", 2, "number of times to retry a failed command")
+	flags.DurationVar(&options.RetryDelay, "retry-delay", 5*time.Second, "time to wait before the first retry, doubled for each retry after")
+	collections := flags.String("collection", "", "comma separated collection names to download (default all)")
+	names := flags.String("name", "", "comma separated command names or glob patterns to download (default all)")
+	flags.BoolVar(&options.Force, "force", false, "download files even if they're already on disk")
+	flags.Float64Var(&options.FailureThreshold, "failure-threshold", 10, "exit non-zero when more than this percent of commands fail")
+	flags.StringVar(&options.SummaryPath, "summary", filepath.Join(".", PayloadTypeName, PrefetchSummaryFilename),
+		"where to write the JSON summary, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return options, err
+	}
+	if options.Workers < 1 {
+		return options, errors.New("-workers must be at least 1")
+	}
+	if options.Retries < 0 {
+		return options, errors.New("-retries can't be negative")
+	}
+	options.Collections = splitCommaList(*collections)
+	options.Names = splitCommaList(*names)
+	return options, nil
+}
+
+func splitCommaList(value string) []string {
+	values := []string{}
+	for _, piece := range strings.Split(value, ",") {
+		if piece = strings.TrimSpace(piece); piece != "" {
+			values = append(values, piece)
+		}
+	}
+	return values
+}
+
+func matchesPrefetchName(commandSource collectionSourceCommandData, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, name := range []string{commandSource.Name, commandSource.CommandName} {
+			if matched, err := path.Match(pattern, name); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func buildPrefetchJobs(options prefetchOptions) []prefetchJob {
+	jobs := []prefetchJob{}
+	for _, collectionSourceData := range getCollectionSources() {
+		if len(options.Collections) > 0 && !containsFold(options.Collections, collectionSourceData.Name) {
+			continue
+		}
+		for _, commandSource := range getCollectionSourceCommands(collectionSourceData) {
+			if !matchesPrefetchName(commandSource, options.Names) {
+				continue
+			}
+			jobs = append(jobs, prefetchJob{collection: collectionSourceData, command: commandSource})
+		}
+	}
+	return jobs
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// runPrefetch downloads jobs with a bounded pool of workers, retrying failures with exponential backoff
+func runPrefetch(options prefetchOptions, jobs []prefetchJob, fetch prefetchFunc) prefetchSummary {
+	start := time.Now()
+	results := make([]prefetchResult, len(jobs))
+	jobIndexes := make(chan int)
 	wg := sync.WaitGroup{}
-	for _, collectionSourceData := range collections {
-		commandSources := []collectionSourceCommandData{}
-		commandSourcesFileData, err := getOrCreateFile(collectionSourceData.SourceFilename)
-		err = json.Unmarshal(commandSourcesFileData, &commandSources)
+	for worker := 0; worker < min(options.Workers, max(len(jobs), 1)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobIndexes {
+				results[i] = runPrefetchJob(options, jobs[i], fetch)
+			}
+		}()
+	}
+	for i := range jobs {
+		jobIndexes <- i
+	}
+	close(jobIndexes)
+	wg.Wait()
+	summary := prefetchSummary{
+		Total:            len(results),
+		FailureThreshold: options.FailureThreshold,
+		Seconds:          time.Since(start).Seconds(),
+		Results:          results,
+	}
+	for _, result := range results {
+		switch result.Status {
+		case prefetchStatusDownloaded:
+			summary.Downloaded++
+		case prefetchStatusSkipped:
+			summary.Skipped++
+		default:
+			summary.Failed++
+		}
+	}
+	if summary.Total > 0 {
+		summary.FailurePercent = float64(summary.Failed) * 100 / float64(summary.Total)
+	}
+	return summary
+}
+
+func runPrefetchJob(options prefetchOptions, job prefetchJob, fetch prefetchFunc) prefetchResult {
+	start := time.Now()
+	result := prefetchResult{
+		Collection: job.collection.Name,
+		Command:    job.command.Name,
+		Type:       job.collection.Type,
+	}
+	delay := options.RetryDelay
+	for attempt := 0; attempt <= options.Retries; attempt++ {
+		if attempt > 0 {
+			logging.LogWarning("[*] Retrying download", "source", job.collection.Name, "command", job.command.Name,
+				"attempt", attempt+1, "sleep", delay)
+			time.Sleep(delay)
+			delay *= 2
+		}
+		result.Attempts++
+		versions, skipped, err := fetch(job, options.Force)
+		result.Versions = versions
+		if err == nil {
+			result.Status = prefetchStatusDownloaded
+			if skipped {
+				result.Status = prefetchStatusSkipped
+			}
+			result.Error = ""
+			logging.LogInfo("[*] Successfully downloaded", "source", job.collection.Name, "command", job.command.Name,
+				"status", result.Status)
+			break
+		}
+		result.Status = prefetchStatusFailed
+		result.Error = err.Error()
+		logging.LogError(err, "[!] failed to download", "source", job.collection.Name, "command", job.command.Name,
+			"attempt", attempt+1)
+		if errors.Is(err, resourceNotFoundError) {
+			// retrying won't make it show up
+			break
+		}
+	}
+	result.Seconds = time.Since(start).Seconds()
+	return result
+}
+
+// assemblyFileVerified checks that an assembly on disk is a complete PE file from a previous download
+func assemblyFileVerified(assemblyPath string) bool {
+	assemblyFile, err := readStoredFile(assemblyPath)
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(assemblyFile, []byte("MZ"))
+}
+
+// bofFilesVerified checks that a bof's extension.json parses and every object file it references is on disk
+func bofFilesVerified(commandSource collectionSourceCommandData, collectionSourceData collectionSource) bool {
+	definitions, err := readBofCommandDefinitions(commandSource, collectionSourceData)
+	if err != nil {
+		return false
+	}
+	bofCommandFolder := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSource.CommandName)
+	for _, definition := range definitions {
+		if len(definition.Files) == 0 {
+			return false
+		}
+		for _, file := range definition.Files {
+			fileInfo, err := os.Stat(filepath.Join(bofCommandFolder, file.Path))
+			if err != nil || fileInfo.Size() == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func prefetchCommand(job prefetchJob, force bool) ([]string, bool, error) {
+	switch job.collection.Type {
+	case "assembly":
+		return prefetchAssembly(job, force)
+	case "bof":
+		if !force && bofFilesVerified(job.command, job.collection) {
+			return nil, true, nil
+		}
+		return nil, false, downloadBofFile(job.command, job.collection, nil)
+	default:
+		return nil, false, fmt.Errorf("unknown collection type %q", job.collection.Type)
+	}
+}
+
+func prefetchAssembly(job prefetchJob, force bool) ([]string, bool, error) {
+	versions := assemblyVersions
+	if job.command.CustomDownloadURL != "" {
+		versions = []string{job.command.CustomVersion}
+	} else if job.command.RepoURL == "" {
+		return nil, false, errors.New("no custom url and no repo url")
+	}
+	presentVersions := []string{}
+	skipped := true
+	var lastErr error
+	for _, assemblyVersion := range versions {
+		assemblyPath := filepath.Join(".", PayloadTypeName, "collections", job.collection.Name, assemblyVersion, job.command.Name+".exe")
+		if !force && assemblyFileVerified(assemblyPath) {
+			presentVersions = append(presentVersions, assemblyVersion)
+			continue
+		}
+		logging.LogInfo("[*] Starting download", "source", job.collection.Name, "command", job.command.Name, "version", assemblyVersion)
+		err := downloadAssemblyFile(job.command, assemblyVersion, job.collection, nil)
 		if err != nil {
-			logging.LogError(err, "failed to unmarshal contents of collection source file")
+			if !errors.Is(err, resourceNotFoundError) || lastErr == nil {
+				lastErr = err
+			}
 			continue
 		}
-		for _, commandSource := range commandSources {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				switch collectionSourceData.Type {
-				case "assembly":
-					if commandSource.CustomDownloadURL != "" {
-						logging.LogInfo("[*] Starting download", "source", collectionSourceData.Name,
-							"command", commandSource.Name, "version", commandSource.CustomVersion)
-						err = downloadAssemblyFile(commandSource, commandSource.CustomVersion, collectionSourceData, nil)
-						if err != nil {
-							logging.LogError(err, "[!] failed to download assembly file", "source", collectionSourceData.Name,
-								"command", commandSource.Name, "version", commandSource.CustomVersion)
-						} else {
-							logging.LogInfo("[*] Successfully downloaded", "source", collectionSourceData.Name, "command", commandSource.Name, "version", commandSource.CustomVersion)
-						}
-					} else {
-						atLeastOneSuccess := false
-						if commandSource.RepoURL == "" {
-							logging.LogError(nil, "[!] No custom url and now repo url", "source", collectionSourceData.Name, "command", commandSource.Name)
-							return
-						}
-						for _, assemblyVersion := range assemblyVersions {
-							logging.LogInfo("[*] Starting download", "source", collectionSourceData.Name,
-								"command", commandSource.Name, "version", assemblyVersion)
-							err = downloadAssemblyFile(commandSource, assemblyVersion, collectionSourceData, nil)
-							if err == nil {
-								atLeastOneSuccess = true
-								logging.LogInfo("[*] Successfully downloaded", "source", collectionSourceData.Name, "command", commandSource.Name, "version", assemblyVersion)
-							} else {
-								logging.LogError(err, "[!] failed to download assembly file", "source", collectionSourceData.Name,
-									"command", commandSource.Name, "version", assemblyVersion)
-							}
-						}
-						if !atLeastOneSuccess {
-							logging.LogError(err, "[!] failed to download assembly file", "source", collectionSourceData.Name,
-								"command", commandSource.Name)
-						}
-					}
-				case "bof":
-					logging.LogInfo("[*] Starting download", "source", collectionSourceData.Name,
-						"command", commandSource.Name, "version", "bof")
-					err = downloadBofFile(commandSource, collectionSourceData, nil)
-					if err != nil {
-						logging.LogError(err, "[!] failed to download bof file", "source", collectionSourceData.Name,
-							"command", commandSource.Name)
-					} else {
-						logging.LogInfo("[*] Successfully downloaded", "source", collectionSourceData.Name, "command", commandSource.Name, "version", "bof")
-					}
-				}
-			}()
+		skipped = false
+		presentVersions = append(presentVersions, assemblyVersion)
+	}
+	// SharpCollection doesn't build every tool for every version, so only fail if none of them are available
+	if len(presentVersions) == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no versions downloaded")
 		}
+		return nil, false, lastErr
 	}
-	wg.Wait()
+	return presentVersions, skipped, nil
+}
+
+func writePrefetchSummary(summary prefetchSummary, summaryPath string) error {
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if summaryPath == "-" || summaryPath == "" {
+		_, err = fmt.Fprintln(os.Stdout, string(summaryJSON))
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(summaryPath), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(summaryPath, summaryJSON, 0644)
+}
+
+// DownloadEverything downloads every collection's commands for the docker build and returns the process exit code
+func DownloadEverything(args []string) int {
+	options, err := parsePrefetchOptions(args)
+	if err != nil {
+		logging.LogError(err, "invalid download arguments")
+		return 2
+	}
+	jobs := buildPrefetchJobs(options)
+	logging.LogInfo("[*] Starting downloads", "commands", len(jobs), "workers", options.Workers)
+	summary := runPrefetch(options, jobs, prefetchCommand)
+	if err = writePrefetchSummary(summary, options.SummaryPath); err != nil {
+		logging.LogError(err, "failed to write download summary")
+		return 1
+	}
+	logging.LogInfo("[*] Finished downloads", "downloaded", summary.Downloaded, "skipped", summary.Skipped,
+		"failed", summary.Failed)
+	if summary.FailurePercent > options.FailureThreshold {
+		logging.LogError(nil, "[!] too many downloads failed", "failure_percent", summary.FailurePercent,
+			"failure_threshold", options.FailureThreshold)
+		return 1
+	}
+	return 0
 }
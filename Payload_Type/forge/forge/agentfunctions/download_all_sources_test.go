@@ -0,0 +1,76 @@
+package agentfunctions
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunPrefetchBoundsWorkersAndRetries(t *testing.T) {
+	setupRegistryFixture(t, 20)
+	options, err := parsePrefetchOptions([]string{"-workers", "3", "-retries", "2", "-retry-delay", "0s", "-name", "bof-1*"})
+	if err != nil {
+		t.Fatalf("unexpected option error: %v", err)
+	}
+	jobs := buildPrefetchJobs(options)
+	// bof-1 and bof-10 through bof-19
+	if len(jobs) != 11 {
+		t.Fatalf("expected name filter to match 11 commands, got %d", len(jobs))
+	}
+	var running, maxRunning atomic.Int32
+	attempts := map[string]int{}
+	attemptsMutex := sync.Mutex{}
+	summary := runPrefetch(options, jobs, func(job prefetchJob, force bool) ([]string, bool, error) {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := maxRunning.Load()
+			if current <= previous || maxRunning.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		attemptsMutex.Lock()
+		attempts[job.command.Name]++
+		attempt := attempts[job.command.Name]
+		attemptsMutex.Unlock()
+		switch job.command.Name {
+		case "bof-10":
+			return nil, true, nil
+		case "bof-11":
+			if attempt < 2 {
+				return nil, false, errors.New("temporary failure")
+			}
+		case "bof-12":
+			return nil, false, resourceNotFoundError
+		case "bof-13":
+			return nil, false, errors.New("permanent failure")
+		}
+		return nil, false, nil
+	})
+	if maxRunning.Load() > 3 {
+		t.Fatalf("expected at most 3 concurrent downloads, saw %d", maxRunning.Load())
+	}
+	if summary.Total != 11 || summary.Skipped != 1 || summary.Failed != 2 || summary.Downloaded != 8 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if attempts["bof-11"] != 2 || attempts["bof-12"] != 1 || attempts["bof-13"] != 3 {
+		t.Fatalf("unexpected attempt counts: %v", attempts)
+	}
+	if summary.FailurePercent <= options.FailureThreshold {
+		t.Fatalf("expected %.2f%% failures to cross the %.2f%% threshold", summary.FailurePercent, options.FailureThreshold)
+	}
+}
+
+func TestBofFilesVerifiedRequiresObjectFiles(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	if bofFilesVerified(commandSource, source) {
+		t.Fatalf("expected missing object file to need a download")
+	}
+	writeJSONFile(t, "forge/collections/Bench/bof-0/bof-0.x64.o", "object")
+	if !bofFilesVerified(commandSource, source) {
+		t.Fatalf("expected extension.json and object file to be verified")
+	}
+}
@@ -0,0 +1,417 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+const downloadConnectTimeoutEnv = "FORGE_HTTP_CONNECT_TIMEOUT"
+const downloadReadTimeoutEnv = "FORGE_HTTP_READ_TIMEOUT"
+const downloadCABundleEnv = "FORGE_CA_BUNDLE"
+const defaultDownloadConnectTimeout = 30 * time.Second
+const defaultDownloadReadTimeout = 60 * time.Second
+
+var httpCacheDirectory = filepath.Join(".", PayloadTypeName, "cache", "http")
+
+const rateLimitCount = 8
+const rateLimitSleep = 5 * time.Second
+const rateLimitMaxSleep = 5 * time.Minute
+
+// maxFetchSize limits the size of API responses that are buffered in memory instead of streamed to disk
+const maxFetchSize = 32 * 1024 * 1024
+const progressReportThreshold = 1024 * 1024
+const progressReportInterval = 2 * time.Second
+
+var rateLimitExceededError = errors.New("rate limit exceeded")
+var resourceNotFoundError = errors.New("resource not found, 404")
+
+type downloadProgressFunc func(written int64, total int64)
+
+type downloader struct {
+	client      *http.Client
+	readTimeout time.Duration
+	cache       *httpCache
+}
+
+var sharedDownloader *downloader
+var sharedDownloaderOnce sync.Once
+
+// getDownloader returns the http downloader shared by every forge command and the bulk download CLI
+func getDownloader() *downloader {
+	sharedDownloaderOnce.Do(func() {
+		sharedDownloader = newDownloader()
+	})
+	return sharedDownloader
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		logging.LogWarning("invalid timeout value, using default", "env", name, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func newDownloader() *downloader {
+	connectTimeout := durationFromEnv(downloadConnectTimeoutEnv, defaultDownloadConnectTimeout)
+	readTimeout := durationFromEnv(downloadReadTimeoutEnv, defaultDownloadReadTimeout)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// honors HTTP_PROXY, HTTPS_PROXY, and NO_PROXY
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = readTimeout
+	if caBundlePath := os.Getenv(downloadCABundleEnv); caBundlePath != "" {
+		certPool, err := x509.SystemCertPool()
+		if err != nil || certPool == nil {
+			certPool = x509.NewCertPool()
+		}
+		caBundle, err := os.ReadFile(caBundlePath)
+		if err != nil {
+			logging.LogError(err, "failed to read custom CA bundle", "path", caBundlePath)
+		} else if !certPool.AppendCertsFromPEM(caBundle) {
+			logging.LogError(nil, "no certificates found in custom CA bundle", "path", caBundlePath)
+		} else {
+			transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+		}
+	}
+	return &downloader{
+		// no overall client timeout since large files stream; stalls are caught by the per-read timeout instead
+		client:      &http.Client{Transport: transport},
+		readTimeout: readTimeout,
+		cache:       newHTTPCache(httpCacheDirectory),
+	}
+}
+
+// addGitHubAuthorization adds the operator's GITHUB_TOKEN secret, or the container's GITHUB_TOKEN env var, to a request
+func addGitHubAuthorization(req *http.Request, taskData *agentstructs.PTTaskMessageAllData) {
+	if req.Header.Get("Authorization") != "" {
+		return
+	}
+	if taskData != nil {
+		if token, ok := taskData.Secrets["GITHUB_TOKEN"].(string); ok && token != "" {
+			req.Header.Add("Authorization", "Bearer "+token)
+			return
+		}
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); len(token) >= 10 {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+}
+
+// rateLimitDelay figures out how long to wait before retrying based on the rate limit headers GitHub returns,
+// falling back to exponential backoff when there aren't any
+func rateLimitDelay(header http.Header, attempt int, now time.Time) time.Duration {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return max(time.Duration(seconds)*time.Second, 0)
+		}
+		if retryTime, err := http.ParseTime(retryAfter); err == nil {
+			return max(retryTime.Sub(now), 0)
+		}
+	}
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			// add a second since the reset time is truncated to the second
+			return max(time.Unix(reset, 0).Sub(now)+time.Second, 0)
+		}
+	}
+	delay := rateLimitSleep << attempt
+	if delay <= 0 || delay > rateLimitMaxSleep {
+		delay = rateLimitMaxSleep
+	}
+	return delay
+}
+
+func isRateLimitResponse(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		return true
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return strings.Contains(strings.ToLower(string(body)), "rate limit")
+}
+
+func isRetryableNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
+}
+
+// idleTimeoutReader cancels the request when no data has been read from the body for the read timeout
+type idleTimeoutReader struct {
+	body     io.ReadCloser
+	timer    *time.Timer
+	timeout  time.Duration
+	cancel   context.CancelFunc
+	timedOut atomic.Bool
+}
+
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	reader := &idleTimeoutReader{body: body, timeout: timeout, cancel: cancel}
+	reader.timer = time.AfterFunc(timeout, func() {
+		reader.timedOut.Store(true)
+		cancel()
+	})
+	return reader
+}
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if err != nil && r.timedOut.Load() {
+		return n, fmt.Errorf("no data received for %s: %w", r.timeout, err)
+	}
+	r.timer.Reset(r.timeout)
+	return n, err
+}
+func (r *idleTimeoutReader) Close() error {
+	r.timer.Stop()
+	r.cancel()
+	return r.body.Close()
+}
+
+func isConditionalRequest(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+}
+
+// do sends a GET request, retrying on rate limits, server errors, and timeouts. The caller must close the returned body.
+func (d *downloader) do(req *http.Request) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt < rateLimitCount; attempt++ {
+		ctx, cancel := context.WithCancel(req.Context())
+		resp, err := d.client.Do(req.Clone(ctx))
+		if err != nil {
+			cancel()
+			if !isRetryableNetworkError(err) {
+				logging.LogError(err, "failed to make network get request", "url", req.URL.String())
+				return nil, err
+			}
+			lastErr = err
+			delay := rateLimitDelay(http.Header{}, attempt, time.Now())
+			logging.LogWarning("Request timed out, sleeping then trying again", "url", req.URL.String(), "sleep", delay)
+			time.Sleep(delay)
+			continue
+		}
+		switch {
+		case isRateLimitResponse(resp):
+			delay := rateLimitDelay(resp.Header, attempt, time.Now())
+			resp.Body.Close()
+			cancel()
+			if delay > rateLimitMaxSleep {
+				return nil, fmt.Errorf("%w for %s, resets in %s; set GITHUB_TOKEN to raise the limit",
+					rateLimitExceededError, req.URL.String(), delay.Round(time.Second))
+			}
+			logging.LogWarning("Hit rate limit, sleeping then trying again", "url", req.URL.String(), "sleep", delay)
+			lastErr = rateLimitExceededError
+			time.Sleep(delay)
+			continue
+		case resp.StatusCode >= 500:
+			delay := rateLimitDelay(resp.Header, attempt, time.Now())
+			resp.Body.Close()
+			cancel()
+			logging.LogWarning("Server error, sleeping then trying again", "url", req.URL.String(), "status code", resp.StatusCode, "sleep", delay)
+			lastErr = fmt.Errorf("failed to download %s due to error code: %d", req.URL.String(), resp.StatusCode)
+			time.Sleep(delay)
+			continue
+		case resp.StatusCode == http.StatusNotModified && isConditionalRequest(req):
+			// served from the http cache by the caller
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+			cancel()
+			return nil, resourceNotFoundError
+		case resp.StatusCode != http.StatusOK:
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			cancel()
+			logging.LogError(nil, "bad status code", "url", req.URL.String(), "status code", resp.StatusCode, "body", string(body))
+			return nil, fmt.Errorf("failed to download repository at %s due to error code: %d", req.URL.String(), resp.StatusCode)
+		}
+		resp.Body = newIdleTimeoutReader(resp.Body, d.readTimeout, cancel)
+		return resp, nil
+	}
+	if errors.Is(lastErr, rateLimitExceededError) {
+		return nil, errors.New("failed to download due to rate limiting")
+	}
+	return nil, fmt.Errorf("failed to download after %d attempts: %w", rateLimitCount, lastErr)
+}
+
+// conditionalRequest clones a request and adds validators from the http cache, returning the cached body's path
+func (d *downloader) conditionalRequest(req *http.Request) (*http.Request, string) {
+	conditionalReq := req.Clone(req.Context())
+	if !d.cache.addConditionalHeaders(conditionalReq) {
+		return req, ""
+	}
+	_, bodyPath, _ := d.cache.lookup(req)
+	return conditionalReq, bodyPath
+}
+
+// fetch buffers a small response, like GitHub API metadata, in memory
+func (d *downloader) fetch(req *http.Request) ([]byte, error) {
+	conditionalReq, cachedBodyPath := d.conditionalRequest(req)
+	resp, err := d.do(conditionalReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		logging.LogDebug("http cache hit", "url", req.URL.String())
+		return readStoredFile(cachedBodyPath)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchSize+1))
+	if err != nil {
+		logging.LogError(err, "failed to read response body")
+		return nil, err
+	}
+	if len(body) > maxFetchSize {
+		return nil, fmt.Errorf("response from %s is larger than %d bytes", req.URL.String(), maxFetchSize)
+	}
+	d.cache.store(req, resp.Header, bytes.NewReader(body))
+	return body, nil
+}
+
+// downloadToFile streams a response to disk, only replacing destination once the whole body was written
+func (d *downloader) downloadToFile(req *http.Request, destination string, progress downloadProgressFunc) (int64, error) {
+	conditionalReq, cachedBodyPath := d.conditionalRequest(req)
+	resp, err := d.do(conditionalReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var body io.Reader = resp.Body
+	total := resp.ContentLength
+	if resp.StatusCode == http.StatusNotModified {
+		logging.LogDebug("http cache hit", "url", req.URL.String())
+		// cached bodies are copies of stored files, so they might be encrypted
+		cachedBody, err := readStoredFile(cachedBodyPath)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(cachedBody)
+		total = int64(len(cachedBody))
+	}
+	err = os.MkdirAll(filepath.Dir(destination), os.ModePerm)
+	if err != nil {
+		return 0, err
+	}
+	partialPath := destination + ".part"
+	partialFile, err := os.Create(partialPath)
+	if err != nil {
+		return 0, err
+	}
+	if progress != nil {
+		body = &progressReader{reader: body, total: total, progress: progress}
+	}
+	written, err := copyToStoredFile(partialFile, body)
+	closeErr := partialFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && total > 0 && written != total {
+		err = fmt.Errorf("expected %d bytes but only received %d", total, written)
+	}
+	if err != nil {
+		logging.LogError(err, "failed to save download to disk", "url", req.URL.String())
+		os.Remove(partialPath)
+		return written, err
+	}
+	err = os.Rename(partialPath, destination)
+	if err != nil {
+		os.Remove(partialPath)
+		return written, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		d.cache.storeFile(req, resp.Header, destination)
+	}
+	return written, nil
+}
+
+func fetchURL(req *http.Request) ([]byte, error) {
+	return getDownloader().fetch(req)
+}
+func downloadURLToFile(req *http.Request, destination string, progress downloadProgressFunc) (int64, error) {
+	return getDownloader().downloadToFile(req, destination, progress)
+}
+
+type progressReader struct {
+	reader   io.Reader
+	written  int64
+	total    int64
+	progress downloadProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.written += int64(n)
+	r.progress(r.written, r.total)
+	return n, err
+}
+
+func formatByteCount(count int64) string {
+	const unit = 1024
+	if count < unit {
+		return fmt.Sprintf("%d B", count)
+	}
+	div, exp := int64(unit), 0
+	for n := count / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(count)/float64(div), "KMGTPE"[exp])
+}
+
+// taskDownloadProgress reports download progress for large files in the task's status
+func taskDownloadProgress(taskData *agentstructs.PTTaskMessageAllData, displayName string) downloadProgressFunc {
+	if taskData == nil {
+		return nil
+	}
+	lastReport := time.Time{}
+	return func(written int64, total int64) {
+		if written < progressReportThreshold && total < progressReportThreshold {
+			return
+		}
+		if time.Since(lastReport) < progressReportInterval && written != total {
+			return
+		}
+		lastReport = time.Now()
+		updatedStatus := fmt.Sprintf("Downloading %s: %s", displayName, formatByteCount(written))
+		if total > 0 {
+			updatedStatus += fmt.Sprintf(" / %s (%d%%)", formatByteCount(total), written*100/total)
+		}
+		mythicrpc.SendMythicRPCTaskUpdate(mythicrpc.MythicRPCTaskUpdateMessage{
+			TaskID:       taskData.Task.ID,
+			UpdateStatus: &updatedStatus,
+		})
+	}
+}
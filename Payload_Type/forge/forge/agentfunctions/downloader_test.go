@@ -0,0 +1,126 @@
+package agentfunctions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitDelayUsesHeaders(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+	if delay := rateLimitDelay(header, 0, now); delay != 7*time.Second {
+		t.Fatalf("expected Retry-After seconds to be used, got %s", delay)
+	}
+	header.Set("Retry-After", now.Add(90*time.Second).UTC().Format(http.TimeFormat))
+	if delay := rateLimitDelay(header, 0, now); delay != 90*time.Second {
+		t.Fatalf("expected Retry-After date to be used, got %s", delay)
+	}
+	header = http.Header{}
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(30*time.Second).Unix(), 10))
+	if delay := rateLimitDelay(header, 0, now); delay != 31*time.Second {
+		t.Fatalf("expected X-RateLimit-Reset to be used, got %s", delay)
+	}
+	if delay := rateLimitDelay(http.Header{}, 2, now); delay != 4*rateLimitSleep {
+		t.Fatalf("expected exponential backoff without headers, got %s", delay)
+	}
+	if delay := rateLimitDelay(http.Header{}, 20, now); delay != rateLimitMaxSleep {
+		t.Fatalf("expected backoff to be capped, got %s", delay)
+	}
+}
+
+func TestDownloadURLToFileRetriesAfterRateLimit(t *testing.T) {
+	t.Chdir(t.TempDir())
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("assembly bytes"))
+	}))
+	defer server.Close()
+	destination := filepath.Join(t.TempDir(), "collection", "Seatbelt.exe")
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	var reported int64
+	written, err := downloadURLToFile(req, destination, func(written int64, total int64) {
+		reported = written
+	})
+	if err != nil {
+		t.Fatalf("expected download to succeed after retry, got %v", err)
+	}
+	if attempts != 2 || written != int64(len("assembly bytes")) || reported != written {
+		t.Fatalf("unexpected download result: attempts=%d written=%d reported=%d", attempts, written, reported)
+	}
+	contents, err := os.ReadFile(destination)
+	if err != nil || string(contents) != "assembly bytes" {
+		t.Fatalf("unexpected file contents %q: %v", contents, err)
+	}
+	if _, err = os.Stat(destination + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("expected partial file to be cleaned up")
+	}
+}
+
+func TestDownloadURLToFileFailsFastOnLongRateLimit(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	destination := filepath.Join(t.TempDir(), "bof.tar.gz")
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := downloadURLToFile(req, destination, nil); err == nil {
+		t.Fatalf("expected rate limit error")
+	}
+	if _, err := os.Stat(destination); !os.IsNotExist(err) {
+		t.Fatalf("expected no file to be written")
+	}
+}
+
+func TestCachedResponsesAreRevalidated(t *testing.T) {
+	t.Chdir(t.TempDir())
+	fullResponses := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(r.Header.Get("Accept")))
+	}))
+	defer server.Close()
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Accept", "application/json")
+		body, err := fetchURL(req)
+		if err != nil || string(body) != "application/json" {
+			t.Fatalf("unexpected fetch result %q: %v", body, err)
+		}
+	}
+	destination := filepath.Join(t.TempDir(), "bof.tar.gz")
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Accept", "application/octet-stream")
+		if _, err := downloadURLToFile(req, destination, nil); err != nil {
+			t.Fatalf("unexpected download error: %v", err)
+		}
+		contents, _ := os.ReadFile(destination)
+		if string(contents) != "application/octet-stream" {
+			t.Fatalf("unexpected download contents %q", contents)
+		}
+	}
+	if fullResponses != 2 {
+		t.Fatalf("expected one full response per Accept header, got %d", fullResponses)
+	}
+}
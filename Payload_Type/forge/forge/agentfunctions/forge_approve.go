@@ -0,0 +1,205 @@
+package agentfunctions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+	"github.com/MythicMeta/MythicContainer/rabbitmq"
+)
+
+const approveActionList = "list"
+const approveActionApprove = "approve"
+const approveActionReject = "reject"
+
+// registerApprovedTool registers the commands for a tool that was just approved, the same way forge_download would have
+func registerApprovedTool(commandSource collectionSourceCommandData, collectionSourceData collectionSource, operationID int) error {
+	switch collectionSourceData.Type {
+	case "assembly":
+		addOrReplaceForgeCommand(createAssemblyCommand(commandSource, collectionSourceData, true, operationID))
+	case "bof":
+		if err := createBofCommand(commandSource, collectionSourceData, true, operationID); err != nil {
+			return err
+		}
+	}
+	rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
+	return nil
+}
+
+func init() {
+	agentstructs.AllPayloadData.Get(PayloadTypeName).AddCommand(agentstructs.Command{
+		Name:                fmt.Sprintf("%s_approve", PayloadTypeName),
+		Description:         "List, approve, or reject tools that are waiting for approval before they can be used.",
+		HelpString:          fmt.Sprintf("%s_approve -action approve -collectionName SharpCollection -commandName Rubeus", PayloadTypeName),
+		Version:             1,
+		Author:              "@its_a_feature_",
+		MitreAttackMappings: []string{},
+		SupportedUIFeatures: []string{},
+		ScriptOnlyCommand:   true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      []string{agentstructs.SUPPORTED_OS_WINDOWS},
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{
+			{
+				Name:             "action",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE,
+				Choices:          []string{approveActionList, approveActionApprove, approveActionReject},
+				Description:      "List pending tools, approve one so it can be used, or reject one to delete its files",
+				ModalDisplayName: "Action",
+				DefaultValue:     approveActionList,
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     0,
+					},
+				},
+			},
+			{
+				Name:             "collectionName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE_CUSTOM,
+				Description:      "The collection that has the pending tool",
+				ModalDisplayName: "Collection Name",
+				DynamicQueryFunction: func(message agentstructs.PTRPCDynamicQueryFunctionMessage) []string {
+					return getCollectionSourceNameOptions(message)
+				},
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     1,
+					},
+				},
+			},
+			{
+				Name:             "commandName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The name of the pending tool",
+				ModalDisplayName: "Command Name",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     2,
+					},
+				},
+			},
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				Success: true,
+				TaskID:  taskData.Task.ID,
+			}
+			action, err := taskData.Args.GetChooseOneArg("action")
+			if err != nil {
+				logging.LogError(err, "failed to get action")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			collection, _ := taskData.Args.GetChooseOneArg("collectionName")
+			commandName, _ := taskData.Args.GetStringArg("commandName")
+			displayParams := fmt.Sprintf("-action %s", action)
+			if collection != "" {
+				displayParams += fmt.Sprintf(" -collectionName %s", collection)
+			}
+			if commandName != "" {
+				displayParams += fmt.Sprintf(" -commandName %s", commandName)
+			}
+			response.DisplayParams = &displayParams
+			if action == approveActionList {
+				quarantineMutex.Lock()
+				entries, err := readQuarantineEntries()
+				quarantineMutex.Unlock()
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				reports := []string{}
+				for _, entry := range entries {
+					if entry.Status != quarantineStatusPending || (collection != "" && entry.Collection != collection) {
+						continue
+					}
+					reports = append(reports, quarantineReport(entry))
+				}
+				output := "No tools are pending approval\n"
+				if len(reports) > 0 {
+					output = strings.Join(reports, "\n")
+				}
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(output),
+				})
+				return response
+			}
+			if collection == "" || commandName == "" {
+				response.Success = false
+				response.Error = fmt.Sprintf("collectionName and commandName are required to %s a tool", action)
+				return response
+			}
+			if err = checkToolApprover(fmt.Sprintf("%s tools", action), taskData); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			collectionSourceData, err := getCollectionSource(collection)
+			if err != nil {
+				logging.LogError(err, "failed to get collection source by name")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			commandSource, ok := forgeRegistry.findSourceCommand(collectionSourceData.Name, commandName)
+			if !ok {
+				response.Success = false
+				response.Error = "Failed to find that command in " + collectionSourceData.SourceFilename
+				return response
+			}
+			var entry quarantineEntry
+			if action == approveActionApprove {
+				entry, err = approveQuarantinedTool(collectionSourceData.Name, commandSource.Name, taskData.Task.OperatorUsername)
+				if err == nil {
+					err = registerApprovedTool(commandSource, collectionSourceData, entry.OperationID)
+				}
+			} else {
+				entry, err = rejectQuarantinedTool(taskData.Task.ID, commandSource, collectionSourceData)
+			}
+			if err != nil {
+				if errors.Is(err, quarantineEntryNotFoundError) {
+					err = fmt.Errorf("%s/%s isn't pending approval", collectionSourceData.Name, commandSource.Name)
+				}
+				logging.LogError(err, "failed to update quarantined tool", "action", action)
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			change := "rejected"
+			output := fmt.Sprintf("%s/%s was rejected and its files were deleted\n", entry.Collection, entry.Name)
+			if action == approveActionReject && entry.Status == quarantineStatusApproved {
+				output = fmt.Sprintf("%s/%s was rejected and the previously approved version was restored\n", entry.Collection, entry.Name)
+			}
+			if action == approveActionApprove {
+				change = "approved"
+				output = quarantineReport(entry) + fmt.Sprintf("Command Registered for use %s!\n", operationScopeText(entry.OperationID))
+			}
+			recordForgeChange(taskData, fmt.Sprintf("%s %s/%s (%d files)", change, entry.Collection, entry.Name, len(entry.Files)))
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(output),
+			})
+			return response
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			if len(input) > 0 {
+				return args.LoadArgsFromJSONString(input)
+			}
+			return nil
+		},
+	})
+}
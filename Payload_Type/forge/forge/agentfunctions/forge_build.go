@@ -0,0 +1,333 @@
+package agentfunctions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+const buildArchiveGroup = "Build From Archive"
+const buildPathGroup = "Build From Path"
+
+// uploadBuildFile registers a compiled file with Mythic. Builds always make a new file instead of reusing one with the
+// same name, since the contents change every time the source does.
+func uploadBuildFile(taskData *agentstructs.PTTaskMessageAllData, filename string, comment string, contents []byte) (string, error) {
+	uploadResponse, err := mythicrpc.SendMythicRPCFileCreate(mythicrpc.MythicRPCFileCreateMessage{
+		TaskID:       taskData.Task.ID,
+		Filename:     filename,
+		Comment:      comment,
+		FileContents: contents,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !uploadResponse.Success {
+		return "", errors.New(uploadResponse.Error)
+	}
+	return uploadResponse.AgentFileID, nil
+}
+
+func init() {
+	agentstructs.AllPayloadData.Get(PayloadTypeName).AddCommand(agentstructs.Command{
+		Name:                fmt.Sprintf("%s_build", PayloadTypeName),
+		Description:         "Compile a BOF from C source with MinGW and register it like forge_create.",
+		HelpString:          fmt.Sprintf("%s_build", PayloadTypeName),
+		Version:             1,
+		Author:              "@its_a_feature_",
+		MitreAttackMappings: []string{},
+		SupportedUIFeatures: []string{},
+		ScriptOnlyCommand:   true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      []string{agentstructs.SUPPORTED_OS_WINDOWS},
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{
+			{
+				Name:             "collectionName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE_CUSTOM,
+				Description:      "Choose which bof collection to add the compiled command to",
+				ModalDisplayName: "Collection Name",
+				DynamicQueryFunction: func(message agentstructs.PTRPCDynamicQueryFunctionMessage) []string {
+					return getCollectionSourceNameOptions(message)
+				},
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						GroupName:           buildArchiveGroup,
+						UIModalPosition:     1,
+					},
+					{
+						ParameterIsRequired: true,
+						GroupName:           buildPathGroup,
+						UIModalPosition:     1,
+					},
+				},
+			},
+			{
+				Name:             "sourceArchive",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_FILE,
+				Description:      fmt.Sprintf("A .zip, .tar.gz, or .tar.xz of the bof's source with a %s at its root", BofBuildManifestFilename),
+				ModalDisplayName: "Source archive",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						GroupName:           buildArchiveGroup,
+						UIModalPosition:     2,
+					},
+				},
+			},
+			{
+				Name:             "sourcePath",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      fmt.Sprintf("A folder in the container's build sources folder with a %s at its root", BofBuildManifestFilename),
+				ModalDisplayName: "Source folder",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						GroupName:           buildPathGroup,
+						UIModalPosition:     2,
+					},
+				},
+			},
+			{
+				Name:             "description",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "Description of the new command",
+				ModalDisplayName: "Command Description",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						GroupName:           buildArchiveGroup,
+						UIModalPosition:     3,
+					},
+					{
+						ParameterIsRequired: false,
+						GroupName:           buildPathGroup,
+						UIModalPosition:     3,
+					},
+				},
+			},
+			{
+				Name:             "global",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_BOOLEAN,
+				Description:      "Make the new command available to every operation instead of just this one",
+				ModalDisplayName: "Available to all operations",
+				DefaultValue:     false,
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						GroupName:           buildArchiveGroup,
+						UIModalPosition:     4,
+					},
+					{
+						ParameterIsRequired: false,
+						GroupName:           buildPathGroup,
+						UIModalPosition:     4,
+					},
+				},
+			},
+			{
+				Name:             "mitreMappings",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_ARRAY,
+				Description:      "MITRE ATT&CK technique IDs for this command (ex: T1003.001)",
+				ModalDisplayName: "MITRE ATT&CK Techniques",
+				DefaultValue:     []string{},
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						GroupName:           buildArchiveGroup,
+						UIModalPosition:     5,
+					},
+					{
+						ParameterIsRequired: false,
+						GroupName:           buildPathGroup,
+						UIModalPosition:     5,
+					},
+				},
+			},
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				Success: true,
+				TaskID:  taskData.Task.ID,
+			}
+			if err := checkOperatorAccess("create commands", taskData); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			collection, _ := taskData.Args.GetStringArg("collectionName")
+			description, _ := taskData.Args.GetStringArg("description")
+			global, _ := taskData.Args.GetBooleanArg("global")
+			mitreMappings, _ := taskData.Args.GetArrayArg("mitreMappings")
+			parameterGroup, err := taskData.Args.GetParameterGroupName()
+			if err != nil {
+				logging.LogError(err, "failed to get parameterGroup")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			collectionSourceData, err := getCollectionSource(collection)
+			if err == nil && collectionSourceData.Type != "bof" {
+				response.Success = false
+				response.Error = fmt.Sprintf("This collection is of type %s, compiled commands can only be added to bof collections", collectionSourceData.Type)
+				return response
+			}
+			sourceDir := ""
+			sourceName := ""
+			if parameterGroup == buildArchiveGroup {
+				archiveFileID, err := taskData.Args.GetFileArg("sourceArchive")
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				searchResp, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
+					TaskID:      taskData.Task.ID,
+					AgentFileID: archiveFileID,
+				})
+				if err == nil && (!searchResp.Success || len(searchResp.Files) == 0) {
+					err = fmt.Errorf("failed to find the source archive: %s", searchResp.Error)
+				}
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				sourceName = searchResp.Files[0].Filename
+				contentResp, err := mythicrpc.SendMythicRPCFileGetContent(mythicrpc.MythicRPCFileGetContentMessage{
+					AgentFileID: archiveFileID,
+				})
+				if err == nil && !contentResp.Success {
+					err = errors.New(contentResp.Error)
+				}
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				sourceDir, err = os.MkdirTemp("", "forge-build-source-*")
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				defer os.RemoveAll(sourceDir)
+				if err = extractBuildSources(sourceName, contentResp.Content, sourceDir); err != nil {
+					logging.LogError(err, "failed to extract build sources")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+			} else {
+				sourceName, _ = taskData.Args.GetStringArg("sourcePath")
+				sourceDir, err = resolveBuildSourcePath(sourceName)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+			}
+			manifest, sourceDir, err := readBofBuildManifest(sourceDir)
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			displayParams := fmt.Sprintf("-collectionName %s -source %s", collection, sourceName)
+			response.DisplayParams = &displayParams
+			updatedStatus := fmt.Sprintf("compiling %s...", manifest.CommandName)
+			mythicrpc.SendMythicRPCTaskUpdate(mythicrpc.MythicRPCTaskUpdateMessage{
+				TaskID:       taskData.Task.ID,
+				UpdateStatus: &updatedStatus,
+			})
+			buildLog := strings.Builder{}
+			outputs, err := compileBof(context.Background(), sourceDir, manifest, &buildLog)
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(buildLog.String()),
+			})
+			if err != nil {
+				logging.LogError(err, "failed to compile bof", "command", manifest.CommandName)
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			extensionContents, err := buildBofExtension(sourceDir, manifest, outputs)
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			comment := fmt.Sprintf("Compiled by %s from %s", taskData.Task.OperatorUsername, sourceName)
+			objectFileIDs := []string{}
+			for _, output := range outputs {
+				fileID, err := uploadBuildFile(taskData, output.Filename, comment, output.Contents)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				objectFileIDs = append(objectFileIDs, fileID)
+			}
+			extensionFileID, err := uploadBuildFile(taskData, "extension.json", comment, extensionContents)
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			createParams, err := json.Marshal(map[string]interface{}{
+				"collectionName":  collection,
+				"description":     description,
+				"commandFilesBof": objectFileIDs,
+				"extensionFile":   extensionFileID,
+				"global":          global,
+				"mitreMappings":   mitreMappings,
+			})
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(fmt.Sprintf("[*] Built %s, registering it with %s_create\n", bofBuildOutputNames(outputs), PayloadTypeName)),
+			})
+			createGroup := bofGroup
+			subtaskResponse, err := mythicrpc.SendMythicRPCTaskCreateSubtask(mythicrpc.MythicRPCTaskCreateSubtaskMessage{
+				TaskID:             taskData.Task.ID,
+				CommandName:        fmt.Sprintf("%s_create", PayloadTypeName),
+				Params:             string(createParams),
+				ParameterGroupName: &createGroup,
+			})
+			if err == nil && !subtaskResponse.Success {
+				err = errors.New(subtaskResponse.Error)
+			}
+			if err != nil {
+				logging.LogError(err, "failed to create forge_create subtask")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			return response
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			if len(input) > 0 {
+				return args.LoadArgsFromJSONString(input)
+			}
+			return nil
+		},
+	})
+}
@@ -2,9 +2,11 @@ package agentfunctions
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
 	"github.com/MythicMeta/MythicContainer/logging"
@@ -67,26 +69,12 @@ func init() {
 				response.Error = err.Error()
 				return response
 			}
-			fileContents, err := getOrCreateFile(collectionSourceData.SourceFilename)
-			if err != nil {
-				logging.LogError(err, "failed to get collection source file contents")
-				response.Success = false
-				response.Error = err.Error()
-				return response
-			}
-			commandSources := []collectionSourceCommandData{}
-			err = json.Unmarshal(fileContents, &commandSources)
-			if err != nil {
-				logging.LogError(err, "failed to unmarshal collection source file contents")
-				response.Success = false
-				response.Error = err.Error()
-				return response
-			}
+			commandSources := getCollectionSourceCommandsForOperation(collectionSourceData, taskData.Callback.OperationID)
 			commandNames := []string{}
 			for i, _ := range commandSources {
 				switch collectionSourceData.Type {
 				case "assembly":
-					commandNames = append(commandNames, fmt.Sprintf("%s%s", AssemblyPrefix, commandSources[i].CommandName))
+					commandNames = append(commandNames, assemblyCommandName(commandSources[i], collectionSourceData))
 				case "bof":
 					commandNames = append(commandNames, getBofCommandNamesForSource(commandSources[i], collectionSourceData)...)
 				}
@@ -108,14 +96,20 @@ func init() {
 				response.Error = commandSearchResp.Error
 				return response
 			}
+			yaraMatches := getYaraMatchedFiles(collectionSourceData.Name)
+			registeredAgents, err := readRegisteredAgents()
+			if err != nil {
+				logging.LogError(err, "failed to read supported payload types, skipping bof compatibility")
+			}
 			for i, _ := range commandSources {
 				commandSources[i].CollectionName = collection
+				commandSources[i].YaraMatches = yaraMatches[commandSources[i].Name]
 				if commandSources[i].RepoURL != "" || commandSources[i].CustomDownloadURL != "" {
 					commandSources[i].Downloadable = true
 				}
 				switch collectionSourceData.Type {
 				case "assembly":
-					commandSources[i].CommandName = fmt.Sprintf("%s%s", AssemblyPrefix, commandSources[i].CommandName)
+					commandSources[i].CommandName = assemblyCommandName(commandSources[i], collectionSourceData)
 					oneExists := false
 					if commandSources[i].CustomVersion != "" {
 						commandFilePath := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSources[i].CustomVersion, commandSources[i].Name+".exe")
@@ -138,12 +132,21 @@ func init() {
 					}
 
 				case "bof":
-					_, err = os.Stat(filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSources[i].CommandName, "extension.json"))
+					bofCommandFolder := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSources[i].CommandName)
+					_, err = os.Stat(filepath.Join(bofCommandFolder, "extension.json"))
+					if errors.Is(err, os.ErrNotExist) {
+						_, err = os.Stat(filepath.Join(bofCommandFolder, aliasManifestFilename))
+					}
 					bofCommandNames := getBofCommandNamesForSource(commandSources[i], collectionSourceData)
-					commandSources[i].CommandName = fmt.Sprintf("%s%s", BofPrefix, commandSources[i].CommandName)
 					if err == nil {
 						commandSources[i].Downloaded = true
+						commandSources[i].BofCompatibility = getBofCompatibility(commandSources[i], collectionSourceData, registeredAgents)
+					}
+					commandPrefix := BofPrefix
+					if len(bofCommandNames) > 0 && strings.HasPrefix(bofCommandNames[0], AliasPrefix) {
+						commandPrefix = AliasPrefix
 					}
+					commandSources[i].CommandName = forgeCommandName(commandPrefix, commandSources[i], collectionSourceData, commandSources[i].CommandName)
 					for _, registeredCommand := range commandSearchResp.Commands {
 						for _, bofCommandName := range bofCommandNames {
 							if bofCommandName == registeredCommand.Name {
@@ -15,11 +15,12 @@ import (
 
 const assemblyGroup = "Create New .NET Assembly Command"
 const bofGroup = "Create New BOF Command"
+const cnaGroup = "Import Aggressor Script BOFs"
 
 func init() {
 	agentstructs.AllPayloadData.Get(PayloadTypeName).AddCommand(agentstructs.Command{
 		Name:                fmt.Sprintf("%s_create", PayloadTypeName),
-		Description:         "Create brand new .NET or BOF commands to be available across all supported agent types.",
+		Description:         "Create brand new .NET or BOF commands to be available across all supported agent types in this operation.",
 		HelpString:          fmt.Sprintf("%s_create", PayloadTypeName),
 		Version:             1,
 		Author:              "@its_a_feature_",
@@ -31,7 +32,7 @@ func init() {
 			SupportedOS:      []string{agentstructs.SUPPORTED_OS_WINDOWS},
 			CommandIsBuiltin: true,
 		},
-		CommandParameters: []agentstructs.CommandParameter{
+		CommandParameters: append([]agentstructs.CommandParameter{
 			{
 				Name:             "collectionName",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE_CUSTOM,
@@ -51,6 +52,11 @@ func init() {
 						GroupName:           bofGroup,
 						UIModalPosition:     1,
 					},
+					{
+						ParameterIsRequired: true,
+						GroupName:           cnaGroup,
+						UIModalPosition:     1,
+					},
 				},
 			},
 			{
@@ -65,6 +71,11 @@ func init() {
 						GroupName:           assemblyGroup,
 						UIModalPosition:     2,
 					},
+					{
+						ParameterIsRequired: true,
+						GroupName:           cnaGroup,
+						UIModalPosition:     2,
+					},
 				},
 			},
 			{
@@ -84,6 +95,11 @@ func init() {
 						GroupName:           bofGroup,
 						UIModalPosition:     3,
 					},
+					{
+						ParameterIsRequired: false,
+						GroupName:           cnaGroup,
+						UIModalPosition:     3,
+					},
 				},
 			},
 			{
@@ -102,11 +118,11 @@ func init() {
 			{
 				Name:             "commandVersion",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE_CUSTOM,
-				Description:      "What version is this assembly",
+				Description:      "What version is this assembly, or auto to detect it from the assembly's metadata",
 				ModalDisplayName: "Version",
-				DefaultValue:     "4.7_Any",
+				DefaultValue:     assemblyVersionAuto,
 				DynamicQueryFunction: func(message agentstructs.PTRPCDynamicQueryFunctionMessage) []string {
-					return assemblyVersions
+					return append([]string{assemblyVersionAuto}, assemblyVersions...)
 				},
 				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
 					{
@@ -119,7 +135,7 @@ func init() {
 			{
 				Name:             "commandFilesBof",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_FILE_MULTIPLE,
-				Description:      "Upload the .o files to execute for this command",
+				Description:      "Upload the .o files to execute for this command, or the .exe/.dll files for a Sliver alias",
 				ModalDisplayName: "The bof .o files to execute",
 				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
 					{
@@ -127,13 +143,18 @@ func init() {
 						GroupName:           bofGroup,
 						UIModalPosition:     4,
 					},
+					{
+						ParameterIsRequired: true,
+						GroupName:           cnaGroup,
+						UIModalPosition:     4,
+					},
 				},
 			},
 			{
 				Name:             "extensionFile",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_FILE,
-				Description:      "The extension.json file that describes this bof command",
-				ModalDisplayName: "Sliver Armory style extension.json file",
+				Description:      "The extension.json file that describes this bof command, or the alias.json of a Sliver alias",
+				ModalDisplayName: "Sliver Armory style extension.json or alias.json file",
 				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
 					{
 						ParameterIsRequired: true,
@@ -142,13 +163,79 @@ func init() {
 					},
 				},
 			},
-		},
+			{
+				Name:             "cnaFiles",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_FILE_MULTIPLE,
+				Description:      "Cobalt Strike aggressor scripts (.cna) that register the bofs and describe their bof_pack arguments",
+				ModalDisplayName: "Aggressor scripts",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: true,
+						GroupName:           cnaGroup,
+						UIModalPosition:     5,
+					},
+				},
+			},
+			{
+				Name:             "global",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_BOOLEAN,
+				Description:      "Make the new command available to every operation instead of just this one",
+				ModalDisplayName: "Available to all operations",
+				DefaultValue:     false,
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						GroupName:           assemblyGroup,
+						UIModalPosition:     6,
+					},
+					{
+						ParameterIsRequired: false,
+						GroupName:           bofGroup,
+						UIModalPosition:     6,
+					},
+					{
+						ParameterIsRequired: false,
+						GroupName:           cnaGroup,
+						UIModalPosition:     6,
+					},
+				},
+			},
+			{
+				Name:             "mitreMappings",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_ARRAY,
+				Description:      "MITRE ATT&CK technique IDs for this command (ex: T1003.001)",
+				ModalDisplayName: "MITRE ATT&CK Techniques",
+				DefaultValue:     []string{},
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						GroupName:           assemblyGroup,
+						UIModalPosition:     7,
+					},
+					{
+						ParameterIsRequired: false,
+						GroupName:           bofGroup,
+						UIModalPosition:     7,
+					},
+					{
+						ParameterIsRequired: false,
+						GroupName:           cnaGroup,
+						UIModalPosition:     7,
+					},
+				},
+			},
+		}, collisionParameters([]string{assemblyGroup, bofGroup, cnaGroup}, 8)...),
 		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
 			response := agentstructs.PTTaskCreateTaskingMessageResponse{
 				Success: true,
 				TaskID:  taskData.Task.ID,
 			}
 			var commandName string
+			if err := checkOperatorAccess("create commands", taskData); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
 			description, err := taskData.Args.GetStringArg("description")
 			if err != nil {
 				logging.LogError(err, "failed to get commandName")
@@ -156,6 +243,19 @@ func init() {
 				response.Error = err.Error()
 				return response
 			}
+			mitreMappings, err := taskData.Args.GetArrayArg("mitreMappings")
+			if err != nil {
+				logging.LogError(err, "failed to get mitreMappings")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			mitreTechniques, err := parseMitreMappings(mitreMappings)
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
 			parameterGroup, err := taskData.Args.GetParameterGroupName()
 			if err != nil {
 				logging.LogError(err, "failed to get parameterGroup")
@@ -163,7 +263,7 @@ func init() {
 				response.Error = err.Error()
 				return response
 			}
-			if parameterGroup == assemblyGroup {
+			if parameterGroup == assemblyGroup || parameterGroup == cnaGroup {
 				commandName, err = taskData.Args.GetStringArg("commandName")
 				if err != nil {
 					logging.LogError(err, "failed to get commandName")
@@ -210,10 +310,18 @@ func init() {
 				commandName = getBofCommandSourceName(bofCommandExtension)
 				if commandName == "" {
 					response.Success = false
-					response.Error = "extension.json must define command_name, package_name, or exactly one bundled command with command_name"
+					response.Error = "extension.json or alias.json must define command_name, package_name, or exactly one bundled command with command_name"
 					return response
 				}
 			}
+			global, err := taskData.Args.GetBooleanArg("global")
+			if err != nil {
+				logging.LogError(err, "failed to get global")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			operationID := taskOperationID(taskData, global)
 			collection, err := taskData.Args.GetStringArg("collectionName")
 			if err != nil {
 				logging.LogError(err, "failed to get collection name")
@@ -241,24 +349,10 @@ func init() {
 				response.Error = err.Error()
 				return response
 			}
-			fileContents, err := getOrCreateFile(collectionSourceData.SourceFilename)
-			if err != nil {
-				logging.LogError(err, "failed to get contents of collection sources file")
-				response.Success = false
-				response.Error = err.Error()
-				return response
-			}
-			commandSources := []collectionSourceCommandData{}
-			err = json.Unmarshal(fileContents, &commandSources)
-			if err != nil {
-				logging.LogError(err, "failed to unmarshal contents of collection source file")
-				response.Success = false
-				response.Error = err.Error()
-				return response
-			}
+			commandSources := getCollectionSourceCommands(collectionSourceData)
 			displayParams := fmt.Sprintf("-collectionName %s -commandName %s", collection, commandName)
 			response.DisplayParams = &displayParams
-			if (collectionSourceData.Type == "assembly" && parameterGroup == bofGroup) ||
+			if (collectionSourceData.Type == "assembly" && parameterGroup != assemblyGroup) ||
 				(collectionSourceData.Type == "bof" && parameterGroup == assemblyGroup) {
 				response.Success = false
 				response.Error = fmt.Sprintf("This collection is of type %s, but you're trying to create a command of the wrong type.\nCreate a new collection or create a new command of the right type", collectionSourceData.Type)
@@ -266,9 +360,10 @@ func init() {
 			}
 			commandIndex := -1
 			newCommandSource := collectionSourceCommandData{
-				Name:        commandName,
-				CommandName: commandName,
-				Description: description,
+				Name:         commandName,
+				CommandName:  commandName,
+				Description:  description,
+				OperationIDs: newOperationScope(operationID),
 			}
 			for i, commandSource := range commandSources {
 				if commandSource.CommandName == commandName {
@@ -278,14 +373,31 @@ func init() {
 						response.Error = "Can't create new commandX when one already exists that references a remote URL"
 						return response
 					}
+					if !operationAllowed(commandSource.OperationIDs, taskData.Callback.OperationID) {
+						response.Success = false
+						response.Error = "Can't create new commandX when another operation already created one with that name"
+						return response
+					}
 					// we already have this command name, but there's no remote url, so it was created like this
 					// this is ok to update
 					commandIndex = i
 					newCommandSource = commandSource
 					newCommandSource.Description = description
+					if global {
+						newCommandSource.OperationIDs = nil
+					}
+				}
+			}
+			// mappings are only saved once the command has passed every check, right before it's registered or quarantined
+			saveMitreMappings := func() (func(), error) {
+				if len(mitreTechniques) == 0 && !taskData.Args.IsArgUserSupplied("mitreMappings") {
+					return func() {}, nil
 				}
+				return replaceMitreMappings(collectionSourceData.Name, commandName, mitreTechniques)
 			}
 			var prefixedCommandName string
+			quarantined := false
+			collisions := collisionResolution{}
 			if parameterGroup == assemblyGroup {
 				commandFileID, err := taskData.Args.GetFileArg("commandFileAssembly")
 				if err != nil {
@@ -301,7 +413,35 @@ func init() {
 					response.Error = err.Error()
 					return response
 				}
-				prefixedCommandName = fmt.Sprintf("%s%s", AssemblyPrefix, commandName)
+				assemblyMetadata, err := inspectMythicAssembly(commandFileID)
+				if err == nil {
+					commandVersion, err = checkAssemblyVersion(assemblyMetadata, commandVersion)
+				}
+				if err != nil {
+					logging.LogError(err, "uploaded file isn't a usable assembly")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(fmt.Sprintf("[*] Detected %s, using version %s\n", assemblyMetadata.String(), commandVersion)),
+				})
+				if references := assemblyMetadata.thirdPartyReferences(); len(references) > 0 {
+					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+						TaskID: taskData.Task.ID,
+						Response: []byte(fmt.Sprintf("[!] %s depends on DLLs that aren't part of the .NET Framework, it can't be tasked until they're merged into it\n%s\n",
+							assemblyMetadata.Name, describeAssemblyDependencies(references))),
+					})
+				}
+				collisions, err = applyCollisionChoice(taskData, newCommandSource, collectionSourceData)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				newCommandSource = collisions.commandSource
+				prefixedCommandName = assemblyCommandName(newCommandSource, collectionSourceData)
 				newCommandSource.customAssemblyFileID = commandFileID
 				newCommandSource.CustomVersion = commandVersion
 				err = downloadAssemblyFile(newCommandSource, commandVersion, collectionSourceData, taskData)
@@ -311,23 +451,31 @@ func init() {
 					response.Error = err.Error()
 					return response
 				}
-				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-					TaskID:   taskData.Task.ID,
-					Response: []byte(fmt.Sprintf("Registering new command %s\n", prefixedCommandName)),
-				})
-				newCommand := createAssemblyCommand(newCommandSource, collectionSourceData, true)
-				addOrReplaceForgeCommand(newCommand)
-			} else {
-				commandFileIDs, err := taskData.Args.GetArrayArg("commandFilesBof")
+				scanDownloadedTool(taskData, newCommandSource, collectionSourceData)
+				quarantined, err = quarantineIfRequired(taskData, newCommandSource, collectionSourceData, operationID, []string{commandFileID})
 				if err != nil {
-					logging.LogError(err, "failed to get commandFile")
 					response.Success = false
 					response.Error = err.Error()
 					return response
 				}
-				extensionFileID, err := taskData.Args.GetFileArg("extensionFile")
+				if _, err = saveMitreMappings(); err != nil {
+					logging.LogError(err, "failed to save mitre mappings")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if !quarantined {
+					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+						TaskID:   taskData.Task.ID,
+						Response: []byte(fmt.Sprintf("Registering new command %s\n", prefixedCommandName)),
+					})
+					newCommand := createAssemblyCommand(newCommandSource, collectionSourceData, true, operationID)
+					addOrReplaceForgeCommand(newCommand)
+				}
+			} else {
+				commandFileIDs, err := taskData.Args.GetArrayArg("commandFilesBof")
 				if err != nil {
-					logging.LogError(err, "failed to get version")
+					logging.LogError(err, "failed to get commandFile")
 					response.Success = false
 					response.Error = err.Error()
 					return response
@@ -337,6 +485,38 @@ func init() {
 					response.Success = false
 					return response
 				}
+				uploadedFileIDs := commandFileIDs
+				extensionFileID := ""
+				if parameterGroup == cnaGroup {
+					cnaFileIDs, err := taskData.Args.GetArrayArg("cnaFiles")
+					if err != nil {
+						logging.LogError(err, "failed to get cnaFiles")
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
+					if len(cnaFileIDs) == 0 {
+						response.Error = "No aggressor scripts specified"
+						response.Success = false
+						return response
+					}
+					extensionFileID, err = importAggressorScripts(taskData, commandName, commandFileIDs, cnaFileIDs)
+					if err != nil {
+						logging.LogError(err, "failed to translate aggressor scripts")
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
+					uploadedFileIDs = append(uploadedFileIDs, cnaFileIDs...)
+				} else {
+					extensionFileID, err = taskData.Args.GetFileArg("extensionFile")
+					if err != nil {
+						logging.LogError(err, "failed to get version")
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
+				}
 				if extensionFileID == "" {
 					response.Error = "No extension file specified"
 					response.Success = false
@@ -355,19 +535,58 @@ func init() {
 					response.Error = err.Error()
 					return response
 				}
-				prefixedCommandNames := strings.Join(getBofCommandNamesForSource(newCommandSource, collectionSourceData), ", ")
-				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-					TaskID:   taskData.Task.ID,
-					Response: []byte(fmt.Sprintf("Registering new command(s) %s\n", prefixedCommandNames)),
-				})
-				err = createBofCommand(newCommandSource, collectionSourceData, true)
+				if err = checkBofObjects(taskData, newCommandSource, collectionSourceData); err != nil {
+					logging.LogError(err, "bof object files failed validation")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				collisions, err = applyCollisionChoice(taskData, newCommandSource, collectionSourceData)
 				if err != nil {
 					response.Success = false
 					response.Error = err.Error()
 					return response
 				}
+				newCommandSource = collisions.commandSource
+				scanDownloadedTool(taskData, newCommandSource, collectionSourceData)
+				quarantined, err = quarantineIfRequired(taskData, newCommandSource, collectionSourceData, operationID,
+					append(uploadedFileIDs, extensionFileID))
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				restoreMitreMappings, err := saveMitreMappings()
+				if err != nil {
+					logging.LogError(err, "failed to save mitre mappings")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if !quarantined {
+					prefixedCommandNames := strings.Join(getBofCommandNamesForSource(newCommandSource, collectionSourceData), ", ")
+					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+						TaskID:   taskData.Task.ID,
+						Response: []byte(fmt.Sprintf("Registering new command(s) %s\n", prefixedCommandNames)),
+					})
+					err = createBofCommand(newCommandSource, collectionSourceData, true, operationID)
+					if err != nil {
+						restoreMitreMappings()
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
+				}
+			}
+			if err = collisions.apply(taskData); err != nil {
+				logging.LogError(err, "failed to apply collision choice")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			if !quarantined {
+				rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
 			}
-			rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
 			response.Success = true
 			// add / update command in sources file
 			if commandIndex == -1 {
@@ -382,16 +601,20 @@ func init() {
 				response.Error = err.Error()
 				return response
 			}
-			err = os.WriteFile(collectionSourceData.SourceFilename, commandBytes, os.ModePerm)
+			err = writeForgeFile(collectionSourceData.SourceFilename, commandBytes, os.ModePerm)
 			if err != nil {
 				logging.LogError(err, "failed to marshal command sources")
 				response.Success = false
 				response.Error = err.Error()
 				return response
 			}
+			recordForgeChange(taskData, fmt.Sprintf("created %s in collection %s %s", commandName, collection, operationScopeText(operationID)))
+			if quarantined {
+				return response
+			}
 			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
 				TaskID:   taskData.Task.ID,
-				Response: []byte(fmt.Sprintf("Command Registered for use!\n")),
+				Response: []byte(fmt.Sprintf("Command Registered for use %s!\n", operationScopeText(operationID))),
 			})
 			return response
 		},
@@ -1,19 +1,16 @@
 package agentfunctions
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
-	"time"
 
 	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
 	"github.com/MythicMeta/MythicContainer/logging"
@@ -27,111 +24,6 @@ var assemblyVersions = []string{
 	"4.7_Any", "4.7_x64", "4.7_x86",
 }
 
-const rateLimitCount = 5
-const rateLimitSleep = 5 * time.Second
-
-func rateLimitLoopFetchURL(req *http.Request) ([]byte, error) {
-	client := http.Client{}
-	env := os.Environ()
-	for _, envVar := range env {
-		if strings.HasPrefix(envVar, "GITHUB_TOKEN") {
-			envPieces := strings.Split(envVar, "=")
-			if len(envPieces) != 2 {
-				break
-			}
-			if len(envPieces[1]) < 10 {
-				break
-			}
-			if req.Header.Get("Authorization") == "" {
-				req.Header.Add("Authorization", "Bearer "+strings.Split(envVar, "=")[1])
-			}
-		}
-	}
-	for i := 0; i < rateLimitCount; i++ {
-		resp, err := client.Do(req)
-		if err != nil {
-			logging.LogError(err, "failed to make network get request")
-			return nil, err
-		}
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			logging.LogError(err, "failed to read response body")
-			return nil, err
-		}
-		if resp.StatusCode == 429 || ((resp.StatusCode == 403 || resp.StatusCode == 401) && strings.Contains(string(body), "rate limit")) {
-			logging.LogWarning("Hit rate limit, sleeping then trying again", "url", req.URL.String())
-			time.Sleep(rateLimitSleep)
-			continue
-		}
-		if resp.StatusCode == 404 {
-			return nil, errors.New("resource not found, 404")
-		}
-		if resp.StatusCode != 200 {
-			logging.LogError(nil, "bad status code", "url", req.URL.String(), "status code", resp.StatusCode, "body", body)
-			return nil, fmt.Errorf("failed to download repository at %s due to error code: %d", req.URL.String(), resp.StatusCode)
-		}
-		if resp.StatusCode == 200 {
-			return body, nil
-		}
-	}
-	return nil, errors.New("failed to download due to rate limiting")
-}
-func ExtractTarGz(gzipStream io.Reader, extractPath string) error {
-	uncompressedStream, err := gzip.NewReader(gzipStream)
-	if err != nil {
-		logging.LogError(err, "ExtractTarGz: NewReader failed")
-		return err
-	}
-	defer uncompressedStream.Close()
-	tarReader := tar.NewReader(uncompressedStream)
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			logging.LogError(err, "ExtractTarGz: Next() failed")
-			return err
-		}
-		switch header.Typeflag {
-		case tar.TypeDir:
-			logging.LogInfo("extracting", "header folder", header.Name, "extract path", extractPath)
-			newName := strings.Replace(header.Name, "./", extractPath, 1)
-			if !strings.HasPrefix(newName, extractPath) {
-				newName = extractPath + newName
-			}
-			err = os.MkdirAll(newName, os.ModePerm)
-			if err != nil {
-				logging.LogError(err, "ExtractTarGz: Mkdir() failed")
-				return err
-			}
-		case tar.TypeReg:
-			logging.LogInfo("extracting", "header files", header.Name, "extract path", extractPath)
-			newName := strings.Replace(header.Name, "./", extractPath, 1)
-			if !strings.HasPrefix(newName, extractPath) {
-				newName = extractPath + newName
-			}
-			outFile, err := os.Create(newName)
-			if err != nil {
-				logging.LogError(err, "ExtractTarGz: Create() failed")
-				return err
-			}
-			_, err = io.Copy(outFile, tarReader)
-			outFile.Close()
-			if err != nil {
-				logging.LogError(err, "ExtractTarGz: Copy() failed")
-				return err
-			}
-		default:
-			logging.LogError(nil,
-				"ExtractTarGz", "unknown type", header.Typeflag,
-				"filename", header.Name)
-			return errors.New("unknown tar file type")
-		}
-	}
-	return nil
-}
 func downloadAssemblyFile(commandSource collectionSourceCommandData, assemblyVersion string, collectionSourceData collectionSource, taskData *agentstructs.PTTaskMessageAllData) error {
 	url := fmt.Sprintf("%s/raw/refs/heads/master/NetFramework_%s/%s.exe",
 		commandSource.RepoURL, assemblyVersion, commandSource.Name)
@@ -144,13 +36,8 @@ func downloadAssemblyFile(commandSource collectionSourceCommandData, assemblyVer
 	if err != nil {
 		return err
 	}
-	downloadFile, err := os.Create(downloadPath)
-	if err != nil {
-		return err
-	}
 	if commandSource.customAssemblyFileID == "" {
 		if !strings.HasPrefix(url, "http") {
-			os.Remove(downloadPath)
 			logging.LogError(nil, "no valid http scheme for downloading the file", "url", url)
 			return errors.New("no remote url address specified for this command and file missing from disk")
 		}
@@ -165,13 +52,8 @@ func downloadAssemblyFile(commandSource collectionSourceCommandData, assemblyVer
 			logging.LogError(err, "failed to make get request for bof")
 			return err
 		}
-
-		if taskData != nil {
-			if _, ok := taskData.Secrets["GITHUB_TOKEN"]; ok {
-				req.Header.Add("Authorization", "Bearer "+taskData.Secrets["GITHUB_TOKEN"].(string))
-			}
-		}
-		body, err := rateLimitLoopFetchURL(req)
+		addGitHubAuthorization(req, taskData)
+		_, err = downloadURLToFile(req, downloadPath, taskDownloadProgress(taskData, commandSource.Name+".exe"))
 		if err != nil {
 			if taskData != nil {
 				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
@@ -179,15 +61,11 @@ func downloadAssemblyFile(commandSource collectionSourceCommandData, assemblyVer
 					Response: []byte(fmt.Sprintf("[!] Failed to download file %s - v%s\n", commandSource.Name+".exe", assemblyVersion)),
 				})
 			}
-			downloadFile.Close()
-			os.Remove(downloadPath)
 			return err
 		}
-		_, err = downloadFile.Write(body)
-		if err != nil {
-			downloadFile.Close()
-			os.Remove(downloadPath)
-			return err
+		if err = verifyStoredAssembly(downloadPath); err != nil {
+			logging.LogError(err, "downloaded file isn't a runnable assembly", "url", url)
+			return fmt.Errorf("%s - v%s: %w", commandSource.Name+".exe", assemblyVersion, err)
 		}
 		if taskData != nil {
 			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
@@ -215,12 +93,15 @@ func downloadAssemblyFile(commandSource collectionSourceCommandData, assemblyVer
 			logging.LogError(errors.New(fileContentsResp.Error), "failed to get file from mythic")
 			return errors.New(fileContentsResp.Error)
 		}
-		_, err = downloadFile.Write(fileContentsResp.Content)
+		if _, err = inspectAssembly(fileContentsResp.Content); err != nil {
+			logging.LogError(err, "file from Mythic isn't a runnable assembly")
+			return err
+		}
+		err = writeStoredFile(downloadPath, fileContentsResp.Content, 0644)
 		if err != nil {
 			logging.LogError(err, "failed to write contents to disk")
 			return err
 		}
-		downloadFile.Close()
 		if taskData != nil {
 			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
 				TaskID:   taskData.Task.ID,
@@ -230,7 +111,7 @@ func downloadAssemblyFile(commandSource collectionSourceCommandData, assemblyVer
 	}
 	return nil
 }
-func createAssemblyCommand(commandSource collectionSourceCommandData, collectionSourceData collectionSource, addCommandToFile bool) agentstructs.Command {
+func createAssemblyCommand(commandSource collectionSourceCommandData, collectionSourceData collectionSource, addCommandToFile bool, operationID int) agentstructs.Command {
 	originatingSource := commandSource.RepoURL
 	if commandSource.CustomDownloadURL != "" {
 		originatingSource = commandSource.CustomDownloadURL
@@ -244,18 +125,18 @@ func createAssemblyCommand(commandSource collectionSourceCommandData, collection
 		defaultChoices = []string{commandSource.CustomVersion}
 	}
 	newCommand := agentstructs.Command{
-		Name:                fmt.Sprintf("%s%s", AssemblyPrefix, commandSource.CommandName),
-		Description:         fmt.Sprintf("%s\nFrom: %s", commandSource.Description, originatingSource),
-		HelpString:          fmt.Sprintf("%s%s", AssemblyPrefix, commandSource.CommandName),
+		Name:                assemblyCommandName(commandSource, collectionSourceData),
+		Description:         fmt.Sprintf("%s\nFrom: %s%s", commandSource.Description, originatingSource, commandSource.OPSEC.description()),
+		HelpString:          assemblyCommandName(commandSource, collectionSourceData),
 		Version:             1,
 		Author:              "@its_a_feature_",
-		MitreAttackMappings: []string{},
+		MitreAttackMappings: getMitreMappings(collectionSourceData.Name, commandSource.CommandName, commandSource.Name),
 		SupportedUIFeatures: []string{},
 		CommandAttributes: agentstructs.CommandAttribute{
 			SupportedOS:        []string{agentstructs.SUPPORTED_OS_WINDOWS},
 			CommandIsSuggested: true,
 		},
-		CommandParameters: []agentstructs.CommandParameter{
+		CommandParameters: withPreset([]agentstructs.CommandParameter{
 			{
 				Name:             "args",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
@@ -297,12 +178,47 @@ func createAssemblyCommand(commandSource collectionSourceCommandData, collection
 					},
 				},
 			},
+			{
+				Name:             "randomize",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_BOOLEAN,
+				Description:      "Upload a copy of the assembly with a random assembly name, module name, and MVID and without its PDB path for just this task",
+				DefaultValue:     false,
+				ModalDisplayName: "Randomize Assembly Metadata",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     3,
+					},
+				},
+			},
+		}),
+		TaskFunctionOPSECPre: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTTaskOPSECPreTaskMessageResponse {
+			registeredAgents, err := readRegisteredAgents()
+			if err != nil {
+				return agentstructs.PTTTaskOPSECPreTaskMessageResponse{TaskID: taskData.Task.ID, Success: false, Error: err.Error()}
+			}
+			executionMethod, err := getAssemblyExecutionMethod(taskData, registeredAgents)
+			if err != nil {
+				return agentstructs.PTTTaskOPSECPreTaskMessageResponse{TaskID: taskData.Task.ID, Success: false, Error: err.Error()}
+			}
+			return forgeOPSECPre(taskData, newEngagementTask(taskData, collectionSourceData.Name, executionMethod,
+				commandSource.Name, commandSource.CommandName, assemblyCommandName(commandSource, collectionSourceData)), commandSource.OPSEC)
 		},
 		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
 			response := agentstructs.PTTaskCreateTaskingMessageResponse{
 				Success: true,
 				TaskID:  taskData.Task.ID,
 			}
+			if err := checkOperationScope(assemblyCommandName(commandSource, collectionSourceData), taskData); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			if err := checkToolApproval(collectionSourceData.Name, commandSource.Name); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
 			binaryFileID := ""
 			arguments, err := taskData.Args.GetStringArg("args")
 			if err != nil {
@@ -316,56 +232,53 @@ func createAssemblyCommand(commandSource collectionSourceCommandData, collection
 				response.Error = err.Error()
 				return response
 			}
-			executionMethod, err := taskData.Args.GetChooseOneArg("execution")
+			// get the command we're suppose to issue based on this callback's payload type
+			registeredAgents, err := readRegisteredAgents()
 			if err != nil {
 				response.Success = false
 				response.Error = err.Error()
 				return response
 			}
-			// get the command we're suppose to issue based on this callback's payload type
-			registeredAgents := []agentDefinition{}
-			agentFileData, err := os.ReadFile(PayloadTypeSupportFilename)
+			executionMethod, err := getAssemblyExecutionMethod(taskData, registeredAgents)
 			if err != nil {
 				response.Success = false
 				response.Error = err.Error()
 				return response
 			}
-			err = json.Unmarshal(agentFileData, &registeredAgents)
+			randomize, _ := taskData.Args.GetBooleanArg("randomize")
+			arguments, presetName, err := presetArgumentString(taskData, assemblyCommandName(commandSource, collectionSourceData), arguments)
 			if err != nil {
 				response.Success = false
 				response.Error = err.Error()
 				return response
 			}
-			if !taskData.Args.IsArgUserSupplied("execution") {
-				for _, agent := range registeredAgents {
-					if agent.Agent == taskData.PayloadType {
-						if agent.AssemblyDefaultExecutionMethod != "" {
-							executionMethod = agent.AssemblyDefaultExecutionMethod
-							break
-						}
-					}
-				}
+			arguments, err = expandContextVariables(taskData, arguments)
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
 			}
 			displayParams := fmt.Sprintf("-args \"%s\" -version %s -execution %s", arguments, assemblyVersion, executionMethod)
+			if presetName != "" {
+				displayParams = fmt.Sprintf("-preset %s %s", presetName, displayParams)
+			}
+			if randomize {
+				displayParams += " -randomize"
+			}
 			response.DisplayParams = &displayParams
+			err = checkEngagementPolicy(taskData, newEngagementTask(taskData, collectionSourceData.Name, executionMethod,
+				commandSource.Name, commandSource.CommandName, assemblyCommandName(commandSource, collectionSourceData)))
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
 			downloadPath := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, assemblyVersion, commandSource.Name+".exe")
-			downloadFile, err := os.ReadFile(downloadPath)
+			downloadFile, err := readStoredFile(downloadPath)
 			if err != nil {
 				if errors.Is(err, os.ErrNotExist) {
 					// file doesn't exist on disk, try to fetch it first
-					fileContents, err := getOrCreateFile(collectionSourceData.SourceFilename)
-					if err != nil {
-						response.Success = false
-						response.Error = err.Error()
-						return response
-					}
-					commandSources := []collectionSourceCommandData{}
-					err = json.Unmarshal(fileContents, &commandSources)
-					if err != nil {
-						response.Success = false
-						response.Error = err.Error()
-						return response
-					}
+					commandSources := getCollectionSourceCommands(collectionSourceData)
 					foundCommand := false
 					for i, _ := range commandSources {
 						if commandSources[i].CommandName == commandSource.CommandName {
@@ -381,6 +294,12 @@ func createAssemblyCommand(commandSource collectionSourceCommandData, collection
 								response.Error = err.Error()
 								return response
 							}
+							err = quarantineTaskDownload(taskData, commandSources[i], collectionSourceData)
+							if err != nil {
+								response.Success = false
+								response.Error = err.Error()
+								return response
+							}
 						}
 					}
 					if !foundCommand {
@@ -388,53 +307,75 @@ func createAssemblyCommand(commandSource collectionSourceCommandData, collection
 						response.Error = fmt.Sprintf("Could not find the command's binary on disk or in the %s file", collectionSourceData.SourceFilename)
 						return response
 					}
+					downloadFile, err = readStoredFile(downloadPath)
+					if err != nil {
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
 				} else {
 					response.Success = false
 					response.Error = err.Error()
 					return response
 				}
 			}
-			fileSearch, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
-				TaskID:     taskData.Task.ID,
-				Filename:   fmt.Sprintf("%s.exe", commandSource.Name),
-				MaxResults: 1,
-				Comment:    fmt.Sprintf("Community Collection's %s.exe version %s", commandSource.Name, assemblyVersion),
-			})
-			if err != nil {
+			if err = checkAssemblyDependencies(downloadFile, commandSource.Name+".exe"); err != nil {
 				response.Success = false
 				response.Error = err.Error()
 				return response
 			}
-			if !fileSearch.Success {
-				response.Success = false
-				response.Error = fileSearch.Error
-				return response
+			if randomize {
+				binaryFileID, err = uploadRandomizedAssembly(taskData, downloadFile, commandSource.Name, assemblyVersion)
+				if err != nil {
+					logging.LogError(err, "failed to randomize assembly", "command", commandSource.CommandName)
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
 			}
-			if len(fileSearch.Files) == 0 {
-				// we need to register it first
-				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-					TaskID:   taskData.Task.ID,
-					Response: []byte(fmt.Sprintf("[*] Registering %s.exe with Mythic...\n", commandSource.Name)),
-				})
-				uploadResponse, err := mythicrpc.SendMythicRPCFileCreate(mythicrpc.MythicRPCFileCreateMessage{
-					TaskID:       taskData.Task.ID,
-					Filename:     fmt.Sprintf("%s.exe", commandSource.Name),
-					Comment:      fmt.Sprintf("Community Collection's %s.exe version %s", commandSource.Name, assemblyVersion),
-					FileContents: downloadFile,
+			if binaryFileID == "" {
+				fileSearch, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
+					TaskID:     taskData.Task.ID,
+					Filename:   fmt.Sprintf("%s.exe", commandSource.Name),
+					MaxResults: 1,
+					Comment:    fmt.Sprintf("Community Collection's %s.exe version %s", commandSource.Name, assemblyVersion),
 				})
 				if err != nil {
 					response.Success = false
 					response.Error = err.Error()
 					return response
 				}
-				if !uploadResponse.Success {
+				if !fileSearch.Success {
 					response.Success = false
-					response.Error = uploadResponse.Error
+					response.Error = fileSearch.Error
 					return response
 				}
-				binaryFileID = uploadResponse.AgentFileID
-			} else {
-				binaryFileID = fileSearch.Files[0].AgentFileID
+				if len(fileSearch.Files) == 0 {
+					// we need to register it first
+					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+						TaskID:   taskData.Task.ID,
+						Response: []byte(fmt.Sprintf("[*] Registering %s.exe with Mythic...\n", commandSource.Name)),
+					})
+					uploadResponse, err := mythicrpc.SendMythicRPCFileCreate(mythicrpc.MythicRPCFileCreateMessage{
+						TaskID:       taskData.Task.ID,
+						Filename:     fmt.Sprintf("%s.exe", commandSource.Name),
+						Comment:      fmt.Sprintf("Community Collection's %s.exe version %s", commandSource.Name, assemblyVersion),
+						FileContents: downloadFile,
+					})
+					if err != nil {
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
+					if !uploadResponse.Success {
+						response.Success = false
+						response.Error = uploadResponse.Error
+						return response
+					}
+					binaryFileID = uploadResponse.AgentFileID
+				} else {
+					binaryFileID = fileSearch.Files[0].AgentFileID
+				}
 			}
 
 			for _, agent := range registeredAgents {
@@ -457,6 +398,7 @@ func createAssemblyCommand(commandSource collectionSourceCommandData, collection
 					taskData.Args.RemoveArg("args")
 					taskData.Args.RemoveArg("version")
 					taskData.Args.RemoveArg("execution")
+					taskData.Args.RemoveArg("randomize")
 					taskData.Args.AddArg(agentstructs.CommandParameter{
 						Name:          commandFileArg,
 						ParameterType: agentstructs.COMMAND_PARAMETER_TYPE_FILE,
@@ -509,28 +451,64 @@ func createAssemblyCommand(commandSource collectionSourceCommandData, collection
 		logging.LogError(err, "failed to parse assembly commands into struct")
 		return newCommand
 	}
+	found := false
 	for i, _ := range assemblyCommands {
-		if assemblyCommands[i].CommandName == fmt.Sprintf("%s%s", AssemblyPrefix, commandSource.CommandName) {
-			// we already have this command Registered, move along
-			return newCommand
+		if assemblyCommands[i].CommandName == assemblyCommandName(commandSource, collectionSourceData) {
+			operationIDs, changed := scopeWithOperation(assemblyCommands[i].OperationIDs, operationID)
+			if !changed {
+				// we already have this command Registered for this operation, move along
+				return newCommand
+			}
+			assemblyCommands[i].OperationIDs = operationIDs
+			found = true
+			break
 		}
 	}
-	assemblyCommands = append(assemblyCommands, assemblyCommand{
-		CommandName:           fmt.Sprintf("%s%s", AssemblyPrefix, commandSource.CommandName),
-		CollectionType:        collectionSourceData.Name,
-		CollectionCommandName: commandSource.Name,
-	})
+	if !found {
+		assemblyCommands = append(assemblyCommands, assemblyCommand{
+			CommandName:           assemblyCommandName(commandSource, collectionSourceData),
+			CollectionType:        collectionSourceData.Name,
+			CollectionCommandName: commandSource.Name,
+			OperationIDs:          newOperationScope(operationID),
+		})
+	}
 	newAssemblyCommandsBytes, err := json.MarshalIndent(assemblyCommands, "", "\t")
 	if err != nil {
 		logging.LogError(err, "failed to marshal assembly commands into JSON")
 		return newCommand
 	}
-	err = os.WriteFile(collectionSourceData.CommandsFilename, newAssemblyCommandsBytes, os.ModePerm)
+	err = writeForgeFile(collectionSourceData.CommandsFilename, newAssemblyCommandsBytes, os.ModePerm)
 	if err != nil {
 		logging.LogError(err, "failed to write out new commands to file")
 	}
 	return newCommand
 }
+func readRegisteredAgents() ([]agentDefinition, error) {
+	registeredAgents := []agentDefinition{}
+	agentFileData, err := os.ReadFile(PayloadTypeSupportFilename)
+	if err != nil {
+		return registeredAgents, err
+	}
+	err = json.Unmarshal(agentFileData, &registeredAgents)
+	return registeredAgents, err
+}
+
+// getAssemblyExecutionMethod uses the callback payload type's default execution method unless the operator picked one
+func getAssemblyExecutionMethod(taskData *agentstructs.PTTaskMessageAllData, registeredAgents []agentDefinition) (string, error) {
+	executionMethod, err := taskData.Args.GetChooseOneArg("execution")
+	if err != nil {
+		return "", err
+	}
+	if taskData.Args.IsArgUserSupplied("execution") {
+		return executionMethod, nil
+	}
+	for _, agent := range registeredAgents {
+		if agent.Agent == taskData.PayloadType && agent.AssemblyDefaultExecutionMethod != "" {
+			return agent.AssemblyDefaultExecutionMethod, nil
+		}
+	}
+	return executionMethod, nil
+}
 func deleteOlderVersions(filename string, taskID int, dontDeleteAgentFileID string) {
 	logging.LogInfo("deleting older versions of files", "filename", filename)
 	oldFilesSearch, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
@@ -584,7 +562,7 @@ func downloadBofFile(commandSource collectionSourceCommandData, collectionSource
 				return errors.New(contentResp.Error)
 			}
 			filePath := filepath.Join(extractPath, searchResp.Files[0].Filename)
-			err = os.WriteFile(filePath, contentResp.Content, os.ModePerm)
+			err = writeStoredFile(filePath, contentResp.Content, os.ModePerm)
 			if err != nil {
 				logging.LogError(err, "failed to write file to disk")
 				return err
@@ -601,8 +579,14 @@ func downloadBofFile(commandSource collectionSourceCommandData, collectionSource
 		if !contentResp.Success {
 			return errors.New(contentResp.Error)
 		}
-		filePath := filepath.Join(extractPath, "extension.json")
-		err = os.WriteFile(filePath, contentResp.Content, os.ModePerm)
+		manifestFilename, staleManifestFilename := "extension.json", aliasManifestFilename
+		if isAliasManifest(contentResp.Content) {
+			manifestFilename, staleManifestFilename = aliasManifestFilename, "extension.json"
+		}
+		os.Remove(filepath.Join(extractPath, staleManifestFilename))
+		filePath := filepath.Join(extractPath, manifestFilename)
+		err = writeStoredFile(filePath, contentResp.Content, os.ModePerm)
+		forgeRegistry.invalidateBofDefinitions(collectionSourceData.Name, commandSource.CommandName)
 		if err != nil {
 			logging.LogError(err, "failed to write file to disk")
 			return err
@@ -613,29 +597,21 @@ func downloadBofFile(commandSource collectionSourceCommandData, collectionSource
 		logging.LogInfo("command is not downloadable, skipping download", "commandSource", commandSource)
 		return nil
 	}
-	downloadPath := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSource.CommandName+".tar.gz")
-	extractPath := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSource.CommandName) + string(os.PathSeparator)
+	collectionPath := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name)
+	extractPath := filepath.Join(collectionPath, commandSource.CommandName) + string(os.PathSeparator)
 
 	err := os.MkdirAll(extractPath, os.ModePerm)
 	if err != nil {
 		return err
 	}
-	downloadFile, err := os.Create(downloadPath)
-	if err != nil {
-		return err
-	}
-	defer downloadFile.Close()
-	if taskData != nil {
-		mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-			TaskID:   taskData.Task.ID,
-			Response: []byte(fmt.Sprintf("[*] Downloading %s...\n", commandSource.Name+".tar.gz")),
-		})
-	}
 
-	tarGzURL := ""
+	assets := []bofReleaseAsset{}
 	if commandSource.CustomDownloadURL != "" {
 		logging.LogInfo("Custom download URL was supplied")
-		tarGzURL = commandSource.CustomDownloadURL
+		assets = append(assets, bofReleaseAsset{
+			Name: path.Base(strings.SplitN(commandSource.CustomDownloadURL, "?", 2)[0]),
+			URL:  commandSource.CustomDownloadURL,
+		})
 	} else {
 		logging.LogInfo("Using default download procedure, assuming GitHub")
 		// calculate GitHub asset download URL
@@ -653,73 +629,116 @@ func downloadBofFile(commandSource collectionSourceCommandData, collectionSource
 		// Add required headers
 		req.Header.Add("Accept", "application/vnd.github.v3.text-match+json")
 		req.Header.Add("Accept", "application/vnd.github.moondragon+json")
-		if taskData != nil {
-			if _, ok := taskData.Secrets["GITHUB_TOKEN"]; ok {
-				req.Header.Add("Authorization", "Bearer "+taskData.Secrets["GITHUB_TOKEN"].(string))
-			}
-		}
-		body, err := rateLimitLoopFetchURL(req)
+		addGitHubAuthorization(req, taskData)
+		body, err := fetchURL(req)
 		if err != nil {
 			return err
 		}
-		result := make(map[string]interface{})
-		err = json.Unmarshal(body, &result)
+		release := githubRelease{}
+		err = json.Unmarshal(body, &release)
 		if err != nil {
 			logging.LogError(err, "failed to unmarshal response body")
 			return err
 		}
-		if len(result["assets"].([]interface{})) == 0 {
+		if len(release.Assets) == 0 {
 			return errors.New("no assets found in GitHub release")
 		}
-		found := false
-		for _, asset := range result["assets"].([]interface{}) {
-			if asset.(map[string]interface{})["name"].(string) == commandSource.CommandName+".tar.gz" {
-				tarGzURL = asset.(map[string]interface{})["url"].(string)
-				found = true
-			}
-		}
-		if !found {
+		assets = selectBofReleaseAssets(release.Assets, commandSource.CommandName)
+		if len(assets) == 0 {
 			return errors.New("unable to find command name in assets")
 		}
 	}
 
-	if tarGzURL == "" {
-		return errors.New("no download URL present")
-	}
-
-	downloadReq, err := http.NewRequest("GET", tarGzURL, nil)
-	if err != nil {
-		logging.LogError(err, "failed to make new request for bof in released assets")
-		return err
-	}
-	downloadReq.Header.Add("Accept", "application/octet-stream")
-	if taskData != nil {
-		if _, ok := taskData.Secrets["GITHUB_TOKEN"]; ok {
-			downloadReq.Header.Add("Authorization", "Bearer "+taskData.Secrets["GITHUB_TOKEN"].(string))
+	objectFiles := []string{}
+	for _, asset := range assets {
+		if asset.URL == "" {
+			return errors.New("no download URL present")
+		}
+		format := archiveFormatForName(asset.Name)
+		if format == "" {
+			// custom download urls historically had to be tar.gz files
+			format = archiveFormatTarGz
+		}
+		downloadPath := filepath.Join(collectionPath, commandSource.CommandName+"."+format)
+		if format == archiveFormatObject {
+			// bare object files don't need extracting, so they go straight into the command's folder
+			downloadPath = filepath.Join(extractPath, filepath.Base(asset.Name))
+			objectFiles = append(objectFiles, downloadPath)
+		}
+		if taskData != nil {
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(fmt.Sprintf("[*] Downloading %s...\n", asset.Name)),
+			})
+		}
+		downloadReq, err := http.NewRequest("GET", asset.URL, nil)
+		if err != nil {
+			logging.LogError(err, "failed to make new request for bof in released assets")
+			return err
+		}
+		downloadReq.Header.Add("Accept", "application/octet-stream")
+		addGitHubAuthorization(downloadReq, taskData)
+		_, err = downloadURLToFile(downloadReq, downloadPath, taskDownloadProgress(taskData, asset.Name))
+		if err != nil {
+			return err
+		}
+		if taskData != nil {
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(fmt.Sprintf("[+] Finished Downloading %s\n", asset.Name)),
+			})
+		}
+		if format == archiveFormatObject {
+			continue
+		}
+		err = extractBofAsset(downloadPath, format, extractPath)
+		forgeRegistry.invalidateBofDefinitions(collectionSourceData.Name, commandSource.CommandName)
+		if err != nil {
+			return err
 		}
 	}
-	downloadFileBody, err := rateLimitLoopFetchURL(downloadReq)
-	if err != nil {
-		os.Remove(downloadPath)
-		return err
-	}
-	_, err = downloadFile.Write(downloadFileBody)
-	if err != nil {
-		os.Remove(downloadPath)
-		return err
+	if len(objectFiles) > 0 {
+		err = writeBareObjectExtension(commandSource, extractPath, objectFiles)
+		forgeRegistry.invalidateBofDefinitions(collectionSourceData.Name, commandSource.CommandName)
+		if err != nil {
+			logging.LogError(err, "failed to write extension.json for bare object files")
+			return err
+		}
 	}
-	if taskData != nil {
-		mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-			TaskID:   taskData.Task.ID,
-			Response: []byte(fmt.Sprintf("[+] Finished Downloading %s\n", commandSource.Name+".tar.gz")),
-		})
+	return nil
+}
+
+type githubReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+type githubRelease struct {
+	Assets []githubReleaseAsset `json:"assets"`
+}
+type bofReleaseAsset struct {
+	Name string
+	URL  string
+}
+
+// selectBofReleaseAssets picks the first archive named after the command, falling back to any bare object files for it
+func selectBofReleaseAssets(releaseAssets []githubReleaseAsset, commandName string) []bofReleaseAsset {
+	for _, format := range bofAssetFormats {
+		for _, asset := range releaseAssets {
+			if asset.Name == commandName+"."+format {
+				return []bofReleaseAsset{{Name: asset.Name, URL: asset.URL}}
+			}
+		}
 	}
-	downloadFile.Seek(0, 0)
-	err = ExtractTarGz(downloadFile, extractPath)
-	if err != nil {
-		return err
+	objectAssets := []bofReleaseAsset{}
+	for _, asset := range releaseAssets {
+		if archiveFormatForName(asset.Name) != archiveFormatObject {
+			continue
+		}
+		if asset.Name == commandName+".o" || strings.HasPrefix(asset.Name, commandName+".") {
+			objectAssets = append(objectAssets, bofReleaseAsset{Name: asset.Name, URL: asset.URL})
+		}
 	}
-	return nil
+	return objectAssets
 }
 
 type bofCommandDefinitionFiles struct {
@@ -750,12 +769,28 @@ type bofCommandDefinition struct {
 	Files           []bofCommandDefinitionFiles     `json:"files"`
 	Arguments       []bofCommandDefinitionArguments `json:"arguments"`
 	Commands        []*bofCommandDefinition         `json:"commands,omitempty"`
+	// fields only used by Sliver armory alias.json manifests
+	IsAssembly   bool   `json:"is_assembly,omitempty"`
+	IsReflective bool   `json:"is_reflective,omitempty"`
+	AllowArgs    bool   `json:"allow_args,omitempty"`
+	DefaultArgs  string `json:"default_args,omitempty"`
+	alias        bool
 }
 
 func loadBofCommandDefinitions(commandSource collectionSourceCommandData, collectionSourceData collectionSource) ([]bofCommandDefinition, error) {
+	return forgeRegistry.getBofCommandDefinitions(commandSource, collectionSourceData)
+}
+
+func readBofCommandDefinitions(commandSource collectionSourceCommandData, collectionSourceData collectionSource) ([]bofCommandDefinition, error) {
 	bofCommandFolder := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSource.CommandName)
 	bofCommandExtensionFilePath := filepath.Join(bofCommandFolder, "extension.json")
-	bofCommandExtensionFile, err := os.ReadFile(bofCommandExtensionFilePath)
+	bofCommandExtensionFile, err := readStoredFile(bofCommandExtensionFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		// armory packages for .NET assemblies and dlls come with an alias.json instead
+		if aliasFile, aliasErr := readStoredFile(filepath.Join(bofCommandFolder, aliasManifestFilename)); aliasErr == nil {
+			return readAliasDefinitions(aliasFile)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -843,15 +878,15 @@ func getBofCommandSourceName(commandDefinition bofCommandDefinition) string {
 	return ""
 }
 
-func bofCommandNamesFromDefinitions(commandDefinitions []bofCommandDefinition, fallbackCommandName string) []string {
+func bofCommandNamesFromDefinitions(commandDefinitions []bofCommandDefinition, commandSource collectionSourceCommandData, collectionSourceData collectionSource) []string {
 	commandNames := make([]string, 0, len(commandDefinitions))
 	seen := make(map[string]bool)
 	for _, commandDefinition := range commandDefinitions {
 		commandName := commandDefinition.CommandName
 		if commandName == "" {
-			commandName = fallbackCommandName
+			commandName = commandSource.CommandName
 		}
-		prefixedCommandName := fmt.Sprintf("%s%s", BofPrefix, commandName)
+		prefixedCommandName := forgeCommandName(commandDefinition.commandPrefix(), commandSource, collectionSourceData, commandName)
 		if !seen[prefixedCommandName] {
 			commandNames = append(commandNames, prefixedCommandName)
 			seen[prefixedCommandName] = true
@@ -861,16 +896,16 @@ func bofCommandNamesFromDefinitions(commandDefinitions []bofCommandDefinition, f
 }
 
 func getBofCommandNamesForSource(commandSource collectionSourceCommandData, collectionSourceData collectionSource) []string {
-	fallbackCommandName := fmt.Sprintf("%s%s", BofPrefix, commandSource.CommandName)
+	fallbackCommandName := forgeCommandName(BofPrefix, commandSource, collectionSourceData, commandSource.CommandName)
 	commandDefinitions, err := loadBofCommandDefinitions(commandSource, collectionSourceData)
 	if err != nil {
 		return []string{fallbackCommandName}
 	}
-	return bofCommandNamesFromDefinitions(commandDefinitions, commandSource.CommandName)
+	return bofCommandNamesFromDefinitions(commandDefinitions, commandSource, collectionSourceData)
 }
 
 func getBofCommandNamesForRemoval(commandSource collectionSourceCommandData, collectionSourceData collectionSource) []string {
-	fallbackCommandName := fmt.Sprintf("%s%s", BofPrefix, commandSource.CommandName)
+	fallbackCommandName := forgeCommandName(BofPrefix, commandSource, collectionSourceData, commandSource.CommandName)
 	commandNames := getBofCommandNamesForSource(commandSource, collectionSourceData)
 	if !slices.Contains(commandNames, fallbackCommandName) {
 		commandNames = append(commandNames, fallbackCommandName)
@@ -879,6 +914,10 @@ func getBofCommandNamesForRemoval(commandSource collectionSourceCommandData, col
 }
 
 func buildBofCommand(commandSource collectionSourceCommandData, collectionSourceData collectionSource, bofCommandExtension bofCommandDefinition) agentstructs.Command {
+	if bofCommandExtension.alias {
+		return buildAliasCommand(commandSource, collectionSourceData, bofCommandExtension)
+	}
+	prefixedCommandName := forgeCommandName(BofPrefix, commandSource, collectionSourceData, bofCommandExtension.CommandName)
 	newCommandParameters := []agentstructs.CommandParameter{}
 	for i, arg := range bofCommandExtension.Arguments {
 		newType := agentstructs.COMMAND_PARAMETER_TYPE_STRING
@@ -920,33 +959,68 @@ func buildBofCommand(commandSource collectionSourceCommandData, collectionSource
 		}
 		newCommandParameters = append(newCommandParameters, newArg)
 	}
+	if hasBofPreset(bofCommandExtension.Arguments) {
+		newCommandParameters = withPreset(newCommandParameters)
+	}
 	helpString := bofCommandExtension.LongHelp
 	if helpString == "" {
 		helpString = bofCommandExtension.Help
 	}
 	return agentstructs.Command{
-		Name: fmt.Sprintf("%s%s", BofPrefix, bofCommandExtension.CommandName),
-		Description: fmt.Sprintf("%s\nFrom: %s\nVersion: %s",
-			bofCommandExtension.Help, bofCommandExtension.RepoURL, bofCommandExtension.Version),
+		Name: prefixedCommandName,
+		Description: fmt.Sprintf("%s\nFrom: %s\nVersion: %s%s",
+			bofCommandExtension.Help, bofCommandExtension.RepoURL, bofCommandExtension.Version, commandSource.OPSEC.description()),
 		HelpString: helpString,
 		Version:    1,
 		Author: fmt.Sprintf("Original: %s, Extension: %s",
 			bofCommandExtension.OriginalAuthor, bofCommandExtension.ExtensionAuthor),
-		MitreAttackMappings: []string{},
+		MitreAttackMappings: getMitreMappings(collectionSourceData.Name, bofCommandExtension.CommandName, commandSource.CommandName, commandSource.Name),
 		SupportedUIFeatures: []string{},
 		CommandAttributes: agentstructs.CommandAttribute{
 			SupportedOS:        []string{agentstructs.SUPPORTED_OS_WINDOWS},
 			CommandIsSuggested: true,
 		},
 		CommandParameters: newCommandParameters,
+		TaskFunctionOPSECPre: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTTaskOPSECPreTaskMessageResponse {
+			return forgeOPSECPre(taskData, newEngagementTask(taskData, collectionSourceData.Name, bofExecutionMethod,
+				commandSource.Name, bofCommandExtension.CommandName, prefixedCommandName), commandSource.OPSEC)
+		},
 		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
 			response := agentstructs.PTTaskCreateTaskingMessageResponse{
 				Success: true,
 				TaskID:  taskData.Task.ID,
 			}
+			if err := checkOperationScope(prefixedCommandName, taskData); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			if err := checkToolApproval(collectionSourceData.Name, commandSource.Name); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			err := checkEngagementPolicy(taskData, newEngagementTask(taskData, collectionSourceData.Name, bofExecutionMethod,
+				commandSource.Name, bofCommandExtension.CommandName, prefixedCommandName))
+			if err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
 			binaryFileID := ""
 			typedArgs := make([][]interface{}, len(bofCommandExtension.Arguments))
 			displayParams := ""
+			if hasBofPreset(bofCommandExtension.Arguments) {
+				presetName, err := applyBofPreset(taskData, prefixedCommandName, bofCommandExtension.Arguments)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if presetName != "" {
+					displayParams = fmt.Sprintf("-preset %s ", presetName)
+				}
+			}
 			for i, arg := range bofCommandExtension.Arguments {
 				switch arg.Type {
 				case "file":
@@ -981,27 +1055,27 @@ func buildBofCommand(commandSource collectionSourceCommandData, collectionSource
 				case "integer":
 					fallthrough
 				case "i":
-					numArg, err := taskData.Args.GetNumberArg(arg.Name)
+					numArg, err := bofNumberArgument(taskData, arg)
 					if err != nil {
 						logging.LogError(err, "failed to get i type arg")
 						response.Success = false
 						response.Error = err.Error()
 						return response
 					}
-					typedArgs[i] = []interface{}{"i", int(numArg)}
-					displayParams += fmt.Sprintf("-%s %d ", arg.Name, int(numArg))
+					typedArgs[i] = []interface{}{"i", numArg}
+					displayParams += fmt.Sprintf("-%s %d ", arg.Name, numArg)
 				case "short":
 					fallthrough
 				case "s":
-					numArg, err := taskData.Args.GetNumberArg(arg.Name)
+					numArg, err := bofNumberArgument(taskData, arg)
 					if err != nil {
 						logging.LogError(err, "failed to get s type arg")
 						response.Success = false
 						response.Error = err.Error()
 						return response
 					}
-					typedArgs[i] = []interface{}{"s", int(numArg)}
-					displayParams += fmt.Sprintf("-%s %d ", arg.Name, int(numArg))
+					typedArgs[i] = []interface{}{"s", numArg}
+					displayParams += fmt.Sprintf("-%s %d ", arg.Name, numArg)
 				case "string":
 					fallthrough
 				case "z":
@@ -1012,6 +1086,12 @@ func buildBofCommand(commandSource collectionSourceCommandData, collectionSource
 						response.Error = err.Error()
 						return response
 					}
+					stringArg, err = expandContextVariables(taskData, stringArg)
+					if err != nil {
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
 					typedArgs[i] = []interface{}{"z", stringArg}
 					displayParams += fmt.Sprintf("-%s %s ", arg.Name, stringArg)
 				case "wstring":
@@ -1024,26 +1104,19 @@ func buildBofCommand(commandSource collectionSourceCommandData, collectionSource
 						response.Error = err.Error()
 						return response
 					}
+					stringArg, err = expandContextVariables(taskData, stringArg)
+					if err != nil {
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
 					typedArgs[i] = []interface{}{"Z", stringArg}
 					displayParams += fmt.Sprintf("-%s %s ", arg.Name, stringArg)
 				}
 				taskData.Args.RemoveArg(arg.Name)
 			}
 			response.DisplayParams = &displayParams
-			targetFilename := ""
-			validArchitectures := make([]string, len(bofCommandExtension.Files))
-			for i, f := range bofCommandExtension.Files {
-				validArchitectures[i] = f.Arch
-				if f.OS != "windows" {
-					continue
-				}
-				if f.Arch == "amd64" && slices.Contains([]string{"x64", "amd64", "x86_64"}, strings.ToLower(taskData.Callback.Architecture)) {
-					targetFilename = f.Path
-				}
-				if f.Arch == "386" && slices.Contains([]string{"x86", "i386"}, strings.ToLower(taskData.Callback.Architecture)) {
-					targetFilename = f.Path
-				}
-			}
+			targetFilename, validArchitectures := selectCallbackFile(bofCommandExtension.Files, taskData.Callback.Architecture)
 			if targetFilename == "" {
 				response.Success = false
 				response.Error = fmt.Sprintf("Callback architecture, %s, doesn't match any bof supported architectures: %s",
@@ -1051,24 +1124,12 @@ func buildBofCommand(commandSource collectionSourceCommandData, collectionSource
 				return response
 			}
 			downloadPath := filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name, commandSource.CommandName, targetFilename)
-			downloadFile, err := os.ReadFile(downloadPath)
+			downloadFile, err := readStoredFile(downloadPath)
 			if err != nil {
 				logging.LogError(err, "Failed to find path on disk", "path", downloadPath)
 				if errors.Is(err, os.ErrNotExist) {
 					// file doesn't exist on disk, try to fetch it first
-					fileContents, err := getOrCreateFile(collectionSourceData.SourceFilename)
-					if err != nil {
-						response.Success = false
-						response.Error = err.Error()
-						return response
-					}
-					commandSources := []collectionSourceCommandData{}
-					err = json.Unmarshal(fileContents, &commandSources)
-					if err != nil {
-						response.Success = false
-						response.Error = err.Error()
-						return response
-					}
+					commandSources := getCollectionSourceCommands(collectionSourceData)
 					foundCommand := false
 					for i, _ := range commandSources {
 						if commandSources[i].CommandName == commandSource.CommandName {
@@ -1080,6 +1141,12 @@ func buildBofCommand(commandSource collectionSourceCommandData, collectionSource
 								response.Error = err.Error()
 								return response
 							}
+							err = quarantineTaskDownload(taskData, commandSources[i], collectionSourceData)
+							if err != nil {
+								response.Success = false
+								response.Error = err.Error()
+								return response
+							}
 						}
 					}
 					if !foundCommand {
@@ -1087,69 +1154,41 @@ func buildBofCommand(commandSource collectionSourceCommandData, collectionSource
 						response.Error = fmt.Sprintf("Could not find the command's binary on disk or in the %s file", collectionSourceData.SourceFilename)
 						return response
 					}
+					downloadFile, err = readStoredFile(downloadPath)
+					if err != nil {
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
 				} else {
 					response.Success = false
 					response.Error = err.Error()
 					return response
 				}
 			}
-			fileSearch, err := mythicrpc.SendMythicRPCFileSearch(mythicrpc.MythicRPCFileSearchMessage{
-				TaskID:     taskData.Task.ID,
-				Filename:   targetFilename,
-				MaxResults: 1,
-				Comment:    fmt.Sprintf("Community Collection's %s version %s", bofCommandExtension.CommandName, targetFilename),
-			})
+			// get the command we're suppose to issue based on this callback's payload type
+			registeredAgents, err := readRegisteredAgents()
 			if err != nil {
 				response.Success = false
 				response.Error = err.Error()
 				return response
 			}
-			if !fileSearch.Success {
-				response.Success = false
-				response.Error = fileSearch.Error
-				return response
-			}
-			if len(fileSearch.Files) == 0 {
-				// we need to register it first
-				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-					TaskID:   taskData.Task.ID,
-					Response: []byte(fmt.Sprintf("[*] Registering %s with Mythic...\n", targetFilename)),
-				})
-				uploadResponse, err := mythicrpc.SendMythicRPCFileCreate(mythicrpc.MythicRPCFileCreateMessage{
-					TaskID:       taskData.Task.ID,
-					Filename:     targetFilename,
-					Comment:      fmt.Sprintf("Community Collection's %s version %s", bofCommandExtension.CommandName, targetFilename),
-					FileContents: downloadFile,
-				})
-				if err != nil {
-					response.Success = false
-					response.Error = err.Error()
-					return response
-				}
-				if !uploadResponse.Success {
-					response.Success = false
-					response.Error = uploadResponse.Error
-					return response
+			for _, agent := range registeredAgents {
+				if agent.Agent == taskData.PayloadType {
+					if err = checkBeaconAPICompatibility(taskData, agent, downloadFile); err != nil {
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
 				}
-				binaryFileID = uploadResponse.AgentFileID
-			} else {
-				binaryFileID = fileSearch.Files[0].AgentFileID
-			}
-			// get the command we're suppose to issue based on this callback's payload type
-			registeredAgents := []agentDefinition{}
-			agentFileData, err := os.ReadFile(PayloadTypeSupportFilename)
-			if err != nil {
-				response.Success = false
-				response.Error = err.Error()
-				return response
 			}
-			err = json.Unmarshal(agentFileData, &registeredAgents)
+			binaryFileID, err = registerToolFile(taskData, targetFilename,
+				fmt.Sprintf("Community Collection's %s version %s", bofCommandExtension.CommandName, targetFilename), downloadFile)
 			if err != nil {
 				response.Success = false
 				response.Error = err.Error()
 				return response
 			}
-
 			for _, agent := range registeredAgents {
 				if agent.Agent == taskData.PayloadType {
 					commandName := agent.BofCommand
@@ -1197,15 +1236,24 @@ func buildBofCommand(commandSource collectionSourceCommandData, collectionSource
 			return args.LoadArgsFromDictionary(input)
 		},
 		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
-			if len(input) > 0 {
+			input = strings.TrimSpace(input)
+			if len(input) == 0 {
+				return nil
+			}
+			if strings.HasPrefix(input, "{") {
 				return args.LoadArgsFromJSONString(input)
 			}
-			return nil
+			values, err := parseBofArgStringWithPreset(prefixedCommandName,
+				bofCommandExtension.Arguments, input)
+			if err != nil {
+				return err
+			}
+			return args.LoadArgsFromDictionary(values)
 		},
 	}
 }
 
-func addBofCommandsToFile(commandSource collectionSourceCommandData, collectionSourceData collectionSource, commandNames []string) error {
+func addBofCommandsToFile(commandSource collectionSourceCommandData, collectionSourceData collectionSource, commandNames []string, operationID int) error {
 	bofCommandsFile, err := getOrCreateFile(collectionSourceData.CommandsFilename)
 	if err != nil {
 		logging.LogError(err, "Failed to read assembly commands file")
@@ -1217,9 +1265,9 @@ func addBofCommandsToFile(commandSource collectionSourceCommandData, collectionS
 		logging.LogError(err, "failed to parse assembly commands into struct")
 		return err
 	}
-	existingCommandNames := make(map[string]bool)
-	for _, command := range bofCommands {
-		existingCommandNames[command.CommandName] = true
+	existingCommandNames := make(map[string]int)
+	for i, command := range bofCommands {
+		existingCommandNames[command.CommandName] = i
 	}
 	collectionCommandName := commandSource.Name
 	if collectionCommandName == "" {
@@ -1227,15 +1275,21 @@ func addBofCommandsToFile(commandSource collectionSourceCommandData, collectionS
 	}
 	updated := false
 	for _, commandName := range commandNames {
-		if existingCommandNames[commandName] {
+		if i, ok := existingCommandNames[commandName]; ok {
+			operationIDs, changed := scopeWithOperation(bofCommands[i].OperationIDs, operationID)
+			if changed {
+				bofCommands[i].OperationIDs = operationIDs
+				updated = true
+			}
 			continue
 		}
 		bofCommands = append(bofCommands, bofCommand{
 			CommandName:           commandName,
 			CollectionType:        collectionSourceData.Name,
 			CollectionCommandName: collectionCommandName,
+			OperationIDs:          newOperationScope(operationID),
 		})
-		existingCommandNames[commandName] = true
+		existingCommandNames[commandName] = len(bofCommands) - 1
 		updated = true
 	}
 	if !updated {
@@ -1246,7 +1300,7 @@ func addBofCommandsToFile(commandSource collectionSourceCommandData, collectionS
 		logging.LogError(err, "failed to marshal assembly commands into JSON")
 		return err
 	}
-	err = os.WriteFile(collectionSourceData.CommandsFilename, newAssemblyCommandsBytes, os.ModePerm)
+	err = writeForgeFile(collectionSourceData.CommandsFilename, newAssemblyCommandsBytes, os.ModePerm)
 	if err != nil {
 		logging.LogError(err, "failed to write out new commands to file")
 		return err
@@ -1254,7 +1308,7 @@ func addBofCommandsToFile(commandSource collectionSourceCommandData, collectionS
 	return nil
 }
 
-func createBofCommand(commandSource collectionSourceCommandData, collectionSourceData collectionSource, addCommandToFile bool) error {
+func createBofCommand(commandSource collectionSourceCommandData, collectionSourceData collectionSource, addCommandToFile bool, operationID int) error {
 	commandDefinitions, err := loadBofCommandDefinitions(commandSource, collectionSourceData)
 	if err != nil {
 		return err
@@ -1264,8 +1318,8 @@ func createBofCommand(commandSource collectionSourceCommandData, collectionSourc
 		newCommands = append(newCommands, buildBofCommand(commandSource, collectionSourceData, commandDefinition))
 	}
 	if addCommandToFile {
-		commandNames := bofCommandNamesFromDefinitions(commandDefinitions, commandSource.CommandName)
-		if err := addBofCommandsToFile(commandSource, collectionSourceData, commandNames); err != nil {
+		commandNames := bofCommandNamesFromDefinitions(commandDefinitions, commandSource, collectionSourceData)
+		if err := addBofCommandsToFile(commandSource, collectionSourceData, commandNames, operationID); err != nil {
 			return err
 		}
 	}
@@ -1347,85 +1401,96 @@ func init() {
 				return response
 			}
 
-			fileContents, err := getOrCreateFile(collectionSourceData.SourceFilename)
-			if err != nil {
-				logging.LogError(err, "failed to get contents of collection sources file")
-				response.Success = false
-				response.Error = err.Error()
-				return response
-			}
-			commandSources := []collectionSourceCommandData{}
-			err = json.Unmarshal(fileContents, &commandSources)
-			if err != nil {
-				logging.LogError(err, "failed to unmarshal contents of collection source file")
+			operationID := taskOperationID(taskData, false)
+			commandSource, ok := findSourceCommandForOperation(collectionSourceData.Name, commandName, operationID)
+			if !ok {
 				response.Success = false
-				response.Error = err.Error()
+				response.Error = "Failed to find that command in " + collectionSourceData.SourceFilename
 				return response
 			}
-			for _, commandSource := range commandSources {
-				if commandSource.Name == commandName {
-					switch collectionSourceData.Type {
-					case "assembly":
-						if commandSource.CustomDownloadURL != "" {
-							err = downloadAssemblyFile(commandSource, commandSource.CustomVersion, collectionSourceData, taskData)
-							if err != nil {
-								response.Success = false
-								response.Error = err.Error()
-								return response
-							}
-						} else {
-							atLeastOneSuccess := false
-							for _, assemblyVersion := range assemblyVersions {
-								err = downloadAssemblyFile(commandSource, assemblyVersion, collectionSourceData, taskData)
-								if err == nil {
-									atLeastOneSuccess = true
-								}
-							}
-							if !atLeastOneSuccess {
-								response.Success = false
-								response.Error = "Failed to download any version of the tool"
-								return response
-							}
-						}
-						mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-							TaskID:   taskData.Task.ID,
-							Response: []byte(fmt.Sprintf("Registering new command %s%s\n", AssemblyPrefix, commandSource.CommandName)),
-						})
-						newCommand := createAssemblyCommand(commandSource, collectionSourceData, true)
-						addOrReplaceForgeCommand(newCommand)
-					case "bof":
-						err = downloadBofFile(commandSource, collectionSourceData, taskData)
-						if err != nil {
-							response.Success = false
-							response.Error = err.Error()
-							return response
-						}
-						prefixedCommandNames := strings.Join(getBofCommandNamesForSource(commandSource, collectionSourceData), ", ")
-						mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-							TaskID:   taskData.Task.ID,
-							Response: []byte(fmt.Sprintf("Registering new command(s) %s\n", prefixedCommandNames)),
-						})
-						err = createBofCommand(commandSource, collectionSourceData, true)
-						if err != nil {
-							response.Success = false
-							response.Error = err.Error()
-							return response
+			switch collectionSourceData.Type {
+			case "assembly":
+				if commandSource.CustomDownloadURL != "" {
+					err = downloadAssemblyFile(commandSource, commandSource.CustomVersion, collectionSourceData, taskData)
+					if err != nil {
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
+				} else {
+					atLeastOneSuccess := false
+					for _, assemblyVersion := range assemblyVersions {
+						err = downloadAssemblyFile(commandSource, assemblyVersion, collectionSourceData, taskData)
+						if err == nil {
+							atLeastOneSuccess = true
 						}
-
-					default:
 					}
-
-					rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
-					response.Success = true
-					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-						TaskID:   taskData.Task.ID,
-						Response: []byte(fmt.Sprintf("Command Registered for use!\n")),
-					})
+					if !atLeastOneSuccess {
+						response.Success = false
+						response.Error = "Failed to download any version of the tool"
+						return response
+					}
+				}
+				scanDownloadedTool(taskData, commandSource, collectionSourceData)
+				quarantined, err := quarantineIfRequired(taskData, commandSource, collectionSourceData, operationID, nil)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if quarantined {
+					return response
+				}
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(fmt.Sprintf("Registering new command %s\n", assemblyCommandName(commandSource, collectionSourceData))),
+				})
+				newCommand := createAssemblyCommand(commandSource, collectionSourceData, true, operationID)
+				addOrReplaceForgeCommand(newCommand)
+			case "bof":
+				err = downloadBofFile(commandSource, collectionSourceData, taskData)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if err = checkBofObjects(taskData, commandSource, collectionSourceData); err != nil {
+					logging.LogError(err, "bof object files failed validation")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				scanDownloadedTool(taskData, commandSource, collectionSourceData)
+				quarantined, err := quarantineIfRequired(taskData, commandSource, collectionSourceData, operationID, nil)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if quarantined {
+					return response
+				}
+				prefixedCommandNames := strings.Join(getBofCommandNamesForSource(commandSource, collectionSourceData), ", ")
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(fmt.Sprintf("Registering new command(s) %s\n", prefixedCommandNames)),
+				})
+				err = createBofCommand(commandSource, collectionSourceData, true, operationID)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
 					return response
 				}
+
+			default:
 			}
-			response.Success = false
-			response.Error = "Failed to find that command in " + collectionSourceData.SourceFilename
+
+			rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
+			response.Success = true
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(fmt.Sprintf("Command Registered for use!\n")),
+			})
 			return response
 		},
 		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
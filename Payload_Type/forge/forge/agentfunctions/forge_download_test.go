@@ -55,7 +55,7 @@ func TestBofCommandNamesFromDefinitionsUsesExpandedCommandNames(t *testing.T) {
 		{CommandName: "sa-netuse-add"},
 		{CommandName: "sa-netuse-list"},
 		{CommandName: "sa-netuse-delete"},
-	}, "sa-netuse")
+	}, collectionSourceCommandData{CommandName: "sa-netuse"}, collectionSource{})
 
 	expectedCommandNames := []string{
 		"forge_bof_sa-netuse-add",
@@ -13,82 +13,100 @@ import (
 	"github.com/MythicMeta/MythicContainer/rabbitmq"
 )
 
-func removeCommandFromFile(commandSource collectionSourceCommandData, collectionSourceData collectionSource) error {
+// removeCommandFromFile unregisters a command for operationID, returning true if no operations are left using it
+func removeCommandFromFile(commandSource collectionSourceCommandData, collectionSourceData collectionSource, operationID int) (bool, error) {
 	assemblyCommandsFile, err := getOrCreateFile(collectionSourceData.CommandsFilename)
 	if err != nil {
 		logging.LogError(err, "Failed to read assembly commands file")
-		return err
+		return false, err
 	}
 	if collectionSourceData.Type == "assembly" {
 		commands := []assemblyCommand{}
 		err = json.Unmarshal(assemblyCommandsFile, &commands)
 		if err != nil {
 			logging.LogError(err, "failed to parse assembly commands into struct")
-			return err
+			return false, err
 		}
 		for i, _ := range commands {
-			if commands[i].CommandName == fmt.Sprintf("%s%s", AssemblyPrefix, commandSource.CommandName) {
+			if commands[i].CommandName == assemblyCommandName(commandSource, collectionSourceData) {
 				// we found the one to remove
-				commands = append(commands[:i], commands[i+1:]...)
+				operationIDs, removeEntry, err := scopeWithoutOperation(commands[i].OperationIDs, operationID)
+				if err != nil {
+					return false, err
+				}
+				if removeEntry {
+					commands = append(commands[:i], commands[i+1:]...)
+				} else {
+					commands[i].OperationIDs = operationIDs
+				}
 				newAssemblyCommandsBytes, err := json.MarshalIndent(commands, "", "\t")
 				if err != nil {
 					logging.LogError(err, "failed to marshal commands into JSON")
-					return err
+					return false, err
 				}
-				err = os.WriteFile(collectionSourceData.CommandsFilename, newAssemblyCommandsBytes, os.ModePerm)
+				err = writeForgeFile(collectionSourceData.CommandsFilename, newAssemblyCommandsBytes, os.ModePerm)
 				if err != nil {
 					logging.LogError(err, "failed to write out new commands to file")
-					return err
+					return false, err
 				}
-				return nil
+				return removeEntry, nil
 			}
 		}
 		// never found the command, so it's essentially removed
-		return nil
+		return true, nil
 	} else if collectionSourceData.Type == "bof" {
 		commands := []bofCommand{}
 		err = json.Unmarshal(assemblyCommandsFile, &commands)
 		if err != nil {
 			logging.LogError(err, "failed to parse assembly commands into struct")
-			return err
+			return false, err
 		}
 		commandNamesToRemove := make(map[string]bool)
 		for _, commandName := range getBofCommandNamesForRemoval(commandSource, collectionSourceData) {
 			commandNamesToRemove[commandName] = true
 		}
 		filteredCommands := make([]bofCommand, 0, len(commands))
-		removedCommand := false
+		foundCommand := false
+		removedEverywhere := true
 		for _, command := range commands {
 			if commandNamesToRemove[command.CommandName] || command.CollectionCommandName == commandSource.Name {
-				removedCommand = true
-				continue
+				foundCommand = true
+				operationIDs, removeEntry, err := scopeWithoutOperation(command.OperationIDs, operationID)
+				if err != nil {
+					return false, err
+				}
+				if removeEntry {
+					continue
+				}
+				removedEverywhere = false
+				command.OperationIDs = operationIDs
 			}
 			filteredCommands = append(filteredCommands, command)
 		}
-		if !removedCommand {
+		if !foundCommand {
 			// never found the command, so it's essentially removed
-			return nil
+			return true, nil
 		}
 		newAssemblyCommandsBytes, err := json.MarshalIndent(filteredCommands, "", "\t")
 		if err != nil {
 			logging.LogError(err, "failed to marshal commands into JSON")
-			return err
+			return false, err
 		}
-		err = os.WriteFile(collectionSourceData.CommandsFilename, newAssemblyCommandsBytes, os.ModePerm)
+		err = writeForgeFile(collectionSourceData.CommandsFilename, newAssemblyCommandsBytes, os.ModePerm)
 		if err != nil {
 			logging.LogError(err, "failed to write out new commands to file")
-			return err
+			return false, err
 		}
-		return nil
+		return removedEverywhere, nil
 
 	}
-	return errors.New("unknown source type")
+	return false, errors.New("unknown source type")
 }
 
 func init() {
 	agentstructs.AllPayloadData.Get(PayloadTypeName).AddCommand(agentstructs.Command{
 		Name:                fmt.Sprintf("%s_register", PayloadTypeName),
-		Description:         "Register existing possible commands to be available across all supported agent types.",
+		Description:         "Register existing possible commands to be available across all supported agent types in this operation.",
 		HelpString:          fmt.Sprintf("%s_register -collectionName SharpCollection -commandName Rubeus", PayloadTypeName),
 		Version:             1,
 		Author:              "@its_a_feature_",
@@ -100,7 +118,7 @@ func init() {
 			SupportedOS:      []string{agentstructs.SUPPORTED_OS_WINDOWS},
 			CommandIsBuiltin: true,
 		},
-		CommandParameters: []agentstructs.CommandParameter{
+		CommandParameters: append([]agentstructs.CommandParameter{
 			{
 				Name:             "collectionName",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE_CUSTOM,
@@ -130,7 +148,7 @@ func init() {
 			{
 				Name:             "remove",
 				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_BOOLEAN,
-				Description:      "Unregister the command across all callbacks",
+				Description:      "Unregister the command across all callbacks in this operation",
 				ModalDisplayName: "Unregister the command across all callbacks",
 				DefaultValue:     false,
 				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
@@ -139,7 +157,19 @@ func init() {
 					},
 				},
 			},
-		},
+			{
+				Name:             "global",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_BOOLEAN,
+				Description:      "Register the command for every operation, or with remove, unregister it from every operation",
+				ModalDisplayName: "Apply to all operations",
+				DefaultValue:     false,
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+					},
+				},
+			},
+		}, collisionParameters([]string{"Default"}, 5)...),
 		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
 			response := agentstructs.PTTaskCreateTaskingMessageResponse{
 				Success: true,
@@ -166,11 +196,28 @@ func init() {
 				response.Error = err.Error()
 				return response
 			}
+			global, err := taskData.Args.GetBooleanArg("global")
+			if err != nil {
+				logging.LogError(err, "failed to get global")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
 			displayParams := fmt.Sprintf("-collectionName %s -commandName %s", collection, commandName)
 			if remove {
 				displayParams += " -remove"
 			}
+			if global {
+				displayParams += " -global"
+			}
 			response.DisplayParams = &displayParams
+			if remove || global {
+				if err = checkOperatorAccess(fmt.Sprintf("run %s", displayParams), taskData); err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+			}
 			collectionSourceData, err := getCollectionSource(collection)
 			if err != nil {
 				logging.LogError(err, "failed to get collection source by name")
@@ -179,160 +226,187 @@ func init() {
 				return response
 			}
 
-			fileContents, err := getOrCreateFile(collectionSourceData.SourceFilename)
-			if err != nil {
-				logging.LogError(err, "failed to get contents of collection sources file")
+			commandSource, ok := findSourceCommandForOperation(collectionSourceData.Name, commandName, taskData.Callback.OperationID)
+			if !ok {
 				response.Success = false
-				response.Error = err.Error()
+				response.Error = "Failed to find that command in " + collectionSourceData.SourceFilename
 				return response
 			}
-			commandSources := []collectionSourceCommandData{}
-			err = json.Unmarshal(fileContents, &commandSources)
-			if err != nil {
-				logging.LogError(err, "failed to unmarshal contents of collection source file")
-				response.Success = false
-				response.Error = err.Error()
-				return response
+			collisions := collisionResolution{}
+			if !remove {
+				collisions, err = applyCollisionChoice(taskData, commandSource, collectionSourceData)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				commandSource = collisions.commandSource
+			}
+			operationID := taskOperationID(taskData, global)
+			if global && !remove {
+				err = promoteSourceCommand(commandSource, collectionSourceData)
+				if err != nil {
+					logging.LogError(err, "failed to make command source global")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
 			}
+			removedEverywhere := false
 			prefixedCommandNames := []string{}
-			for _, commandSource := range commandSources {
-				if commandSource.Name == commandName {
-					switch collectionSourceData.Type {
-					case "assembly":
-						prefixedCommandName := fmt.Sprintf("%s%s", AssemblyPrefix, commandSource.CommandName)
-						prefixedCommandNames = []string{prefixedCommandName}
-						if remove {
-							mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-								TaskID:   taskData.Task.ID,
-								Response: []byte(fmt.Sprintf("Removing command %s\n", prefixedCommandName)),
-							})
-							err = removeCommandFromFile(commandSource, collectionSourceData)
-							if err != nil {
-								logging.LogError(err, "failed to remove command")
-								response.Success = false
-								response.Error = err.Error()
-							}
-							agentstructs.AllPayloadData.Get(PayloadTypeName).RemoveCommand(agentstructs.Command{Name: prefixedCommandName})
-						} else {
-							mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-								TaskID:   taskData.Task.ID,
-								Response: []byte(fmt.Sprintf("Registering new command %s\n", prefixedCommandName)),
-							})
-							newCommand := createAssemblyCommand(commandSource, collectionSourceData, true)
-							addOrReplaceForgeCommand(newCommand)
-						}
-
-					case "bof":
-						prefixedCommandNames = getBofCommandNamesForSource(commandSource, collectionSourceData)
-						prefixedCommandNamesText := strings.Join(prefixedCommandNames, ", ")
-						if remove {
-							prefixedCommandNames = getBofCommandNamesForRemoval(commandSource, collectionSourceData)
-							prefixedCommandNamesText = strings.Join(prefixedCommandNames, ", ")
-							mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-								TaskID:   taskData.Task.ID,
-								Response: []byte(fmt.Sprintf("Removing command(s) %s\n", prefixedCommandNamesText)),
-							})
-							err = removeCommandFromFile(commandSource, collectionSourceData)
-							if err != nil {
-								logging.LogError(err, "failed to remove command")
-								response.Success = false
-								response.Error = err.Error()
-							}
-							for _, prefixedCommandName := range prefixedCommandNames {
-								agentstructs.AllPayloadData.Get(PayloadTypeName).RemoveCommand(agentstructs.Command{Name: prefixedCommandName})
-							}
-						} else {
-							mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-								TaskID:   taskData.Task.ID,
-								Response: []byte(fmt.Sprintf("Registering new command(s) %s\n", prefixedCommandNamesText)),
-							})
-							err = createBofCommand(commandSource, collectionSourceData, true)
-							if err != nil {
-								response.Success = false
-								response.Error = err.Error()
-								return response
-							}
-						}
-
-					default:
+			switch collectionSourceData.Type {
+			case "assembly":
+				prefixedCommandName := assemblyCommandName(commandSource, collectionSourceData)
+				prefixedCommandNames = []string{prefixedCommandName}
+				if remove {
+					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+						TaskID:   taskData.Task.ID,
+						Response: []byte(fmt.Sprintf("Removing command %s\n", prefixedCommandName)),
+					})
+					removedEverywhere, err = removeCommandFromFile(commandSource, collectionSourceData, operationID)
+					if err != nil {
+						logging.LogError(err, "failed to remove command")
+						response.Success = false
+						response.Error = unregisterErrorMessage(err)
+						return response
+					}
+					if removedEverywhere {
+						agentstructs.AllPayloadData.Get(PayloadTypeName).RemoveCommand(agentstructs.Command{Name: prefixedCommandName})
 					}
-					rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
-					response.Success = true
-					if remove {
+				} else {
+					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+						TaskID:   taskData.Task.ID,
+						Response: []byte(fmt.Sprintf("Registering new command %s\n", prefixedCommandName)),
+					})
+					newCommand := createAssemblyCommand(commandSource, collectionSourceData, true, operationID)
+					addOrReplaceForgeCommand(newCommand)
+				}
 
-						// now to remove this command from all associated callbacks
-						payloadtypesFileContents, err := getOrCreateFile(PayloadTypeSupportFilename)
-						if err != nil {
-							logging.LogError(err, "failed to read payloadtype support file")
-							response.Success = false
-							response.Error = err.Error()
-							return response
-						}
-						payloadTypes := []agentDefinition{}
-						err = json.Unmarshal(payloadtypesFileContents, &payloadTypes)
-						if err != nil {
-							logging.LogError(err, "failed to read unmarshal payloadtypes file")
-							response.Success = false
-							response.Error = err.Error()
-							return response
-						}
-						payloadTypeNames := make([]string, len(payloadTypes))
-						for i, payloadType := range payloadTypes {
-							payloadTypeNames[i] = payloadType.Agent
-						}
-						callbacksSearchResp, err := mythicrpc.SendMythicRPCCallbackSearch(mythicrpc.MythicRPCCallbackSearchMessage{
-							AgentCallbackID:            taskData.Callback.AgentCallbackID,
-							SearchCallbackPayloadTypes: &payloadTypeNames,
-						})
-						if err != nil {
-							logging.LogError(err, "failed to send mythicrpc message to mythic to search for callbacks")
-							response.Success = false
-							response.Error = err.Error()
-							return response
-						}
-						if !callbacksSearchResp.Success {
-							logging.LogError(nil, "mythicrpc returned error", "error", callbacksSearchResp.Error)
-							response.Success = false
-							response.Error = callbacksSearchResp.Error
-							return response
-						}
-						callbackIDs := make([]int, len(callbacksSearchResp.Results))
-						for i, callback := range callbacksSearchResp.Results {
-							callbackIDs[i] = callback.ID
-						}
-						callbacksRemoveCommandResp, err := mythicrpc.SendMythicRPCCallbackRemoveCommand(mythicrpc.MythicRPCCallbackRemoveCommandMessage{
-							TaskID:      taskData.Task.ID,
-							PayloadType: PayloadTypeName,
-							CallbackIDs: callbackIDs,
-							Commands:    prefixedCommandNames,
-						})
-						if err != nil {
-							logging.LogError(err, "failed to send mythicrpc message to mythic to remove commands")
-							response.Success = false
-							response.Error = err.Error()
-							return response
-						}
-						if !callbacksRemoveCommandResp.Success {
-							logging.LogError(nil, "mythicrpc returned error", "error", callbacksSearchResp.Error)
-							response.Success = false
-							response.Error = callbacksSearchResp.Error
-							return response
+			case "bof":
+				prefixedCommandNames = getBofCommandNamesForSource(commandSource, collectionSourceData)
+				prefixedCommandNamesText := strings.Join(prefixedCommandNames, ", ")
+				if remove {
+					prefixedCommandNames = getBofCommandNamesForRemoval(commandSource, collectionSourceData)
+					prefixedCommandNamesText = strings.Join(prefixedCommandNames, ", ")
+					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+						TaskID:   taskData.Task.ID,
+						Response: []byte(fmt.Sprintf("Removing command(s) %s\n", prefixedCommandNamesText)),
+					})
+					removedEverywhere, err = removeCommandFromFile(commandSource, collectionSourceData, operationID)
+					if err != nil {
+						logging.LogError(err, "failed to remove command")
+						response.Success = false
+						response.Error = unregisterErrorMessage(err)
+						return response
+					}
+					if removedEverywhere {
+						for _, prefixedCommandName := range prefixedCommandNames {
+							agentstructs.AllPayloadData.Get(PayloadTypeName).RemoveCommand(agentstructs.Command{Name: prefixedCommandName})
 						}
-						mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-							TaskID:   taskData.Task.ID,
-							Response: []byte(fmt.Sprintf("Command Removed from use!\n")),
-						})
-					} else {
-						mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
-							TaskID:   taskData.Task.ID,
-							Response: []byte(fmt.Sprintf("Command Registered for use!\n")),
-						})
 					}
+				} else {
+					if err = checkBofObjects(taskData, commandSource, collectionSourceData); err != nil {
+						logging.LogError(err, "bof object files failed validation")
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
+					mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+						TaskID:   taskData.Task.ID,
+						Response: []byte(fmt.Sprintf("Registering new command(s) %s\n", prefixedCommandNamesText)),
+					})
+					err = createBofCommand(commandSource, collectionSourceData, true, operationID)
+					if err != nil {
+						response.Success = false
+						response.Error = err.Error()
+						return response
+					}
+				}
+
+			default:
+			}
+			if err = collisions.apply(taskData); err != nil {
+				logging.LogError(err, "failed to apply collision choice")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			if !remove || removedEverywhere {
+				rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
+			}
+			response.Success = true
+			if remove {
+
+				// now to remove this command from all associated callbacks
+				payloadtypesFileContents, err := getOrCreateFile(PayloadTypeSupportFilename)
+				if err != nil {
+					logging.LogError(err, "failed to read payloadtype support file")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				payloadTypes := []agentDefinition{}
+				err = json.Unmarshal(payloadtypesFileContents, &payloadTypes)
+				if err != nil {
+					logging.LogError(err, "failed to read unmarshal payloadtypes file")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				payloadTypeNames := make([]string, len(payloadTypes))
+				for i, payloadType := range payloadTypes {
+					payloadTypeNames[i] = payloadType.Agent
+				}
+				callbacksSearchResp, err := mythicrpc.SendMythicRPCCallbackSearch(mythicrpc.MythicRPCCallbackSearchMessage{
+					AgentCallbackID:            taskData.Callback.AgentCallbackID,
+					SearchCallbackPayloadTypes: &payloadTypeNames,
+				})
+				if err != nil {
+					logging.LogError(err, "failed to send mythicrpc message to mythic to search for callbacks")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if !callbacksSearchResp.Success {
+					logging.LogError(nil, "mythicrpc returned error", "error", callbacksSearchResp.Error)
+					response.Success = false
+					response.Error = callbacksSearchResp.Error
+					return response
+				}
+				callbackIDs := make([]int, len(callbacksSearchResp.Results))
+				for i, callback := range callbacksSearchResp.Results {
+					callbackIDs[i] = callback.ID
+				}
+				callbacksRemoveCommandResp, err := mythicrpc.SendMythicRPCCallbackRemoveCommand(mythicrpc.MythicRPCCallbackRemoveCommandMessage{
+					TaskID:      taskData.Task.ID,
+					PayloadType: PayloadTypeName,
+					CallbackIDs: callbackIDs,
+					Commands:    prefixedCommandNames,
+				})
+				if err != nil {
+					logging.LogError(err, "failed to send mythicrpc message to mythic to remove commands")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				if !callbacksRemoveCommandResp.Success {
+					logging.LogError(nil, "mythicrpc returned error", "error", callbacksSearchResp.Error)
+					response.Success = false
+					response.Error = callbacksSearchResp.Error
 					return response
 				}
+				recordForgeChange(taskData, fmt.Sprintf("removed %s from collection %s %s", commandName, collection, operationScopeText(operationID)))
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(fmt.Sprintf("Command Removed from use %s!\n", operationScopeText(operationID))),
+				})
+			} else {
+				recordForgeChange(taskData, fmt.Sprintf("registered %s from collection %s %s", commandName, collection, operationScopeText(operationID)))
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(fmt.Sprintf("Command Registered for use %s!\n", operationScopeText(operationID))),
+				})
 			}
-			response.Success = false
-			response.Error = "Failed to find that command in " + collectionSourceData.SourceFilename
 			return response
 		},
 		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
@@ -0,0 +1,139 @@
+package agentfunctions
+
+import (
+	"fmt"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+func init() {
+	agentstructs.AllPayloadData.Get(PayloadTypeName).AddCommand(agentstructs.Command{
+		Name:                fmt.Sprintf("%s_scan", PayloadTypeName),
+		Description:         "Scan the tools stored in the container with the configured YARA rules.",
+		HelpString:          fmt.Sprintf("%s_scan -collectionName SharpCollection", PayloadTypeName),
+		Version:             1,
+		Author:              "@its_a_feature_",
+		MitreAttackMappings: []string{},
+		SupportedUIFeatures: []string{},
+		ScriptOnlyCommand:   true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      []string{agentstructs.SUPPORTED_OS_WINDOWS},
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{
+			{
+				Name:             "collectionName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE_CUSTOM,
+				Description:      "The collection to scan, or leave empty to scan all of them",
+				ModalDisplayName: "Collection Name",
+				DynamicQueryFunction: func(message agentstructs.PTRPCDynamicQueryFunctionMessage) []string {
+					return getCollectionSourceNameOptions(message)
+				},
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     0,
+					},
+				},
+			},
+			{
+				Name:             "commandName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The name of a single tool to scan",
+				ModalDisplayName: "Command Name",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     1,
+					},
+				},
+			},
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				Success: true,
+				TaskID:  taskData.Task.ID,
+			}
+			collection, _ := taskData.Args.GetChooseOneArg("collectionName")
+			commandName, _ := taskData.Args.GetStringArg("commandName")
+			displayParams := ""
+			if collection != "" {
+				displayParams = fmt.Sprintf("-collectionName %s", collection)
+			}
+			if commandName != "" {
+				displayParams += fmt.Sprintf(" -commandName %s", commandName)
+			}
+			displayParams = strings.TrimSpace(displayParams)
+			response.DisplayParams = &displayParams
+			if commandName != "" && collection == "" {
+				response.Success = false
+				response.Error = "collectionName is required to scan a single tool"
+				return response
+			}
+			collectionSources := getCollectionSources()
+			if collection != "" {
+				collectionSourceData, err := getCollectionSource(collection)
+				if err != nil {
+					logging.LogError(err, "failed to get collection source by name")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				collectionSources = []collectionSource{collectionSourceData}
+			}
+			output := strings.Builder{}
+			scannedFiles := 0
+			matchedTools := 0
+			for _, collectionSourceData := range collectionSources {
+				commandSources := getCollectionSourceCommandsForOperation(collectionSourceData, taskData.Callback.OperationID)
+				if commandName != "" {
+					commandSource, ok := findSourceCommandForOperation(collectionSourceData.Name, commandName, taskData.Callback.OperationID)
+					if !ok {
+						response.Success = false
+						response.Error = "Failed to find that command in " + collectionSourceData.SourceFilename
+						return response
+					}
+					commandSources = []collectionSourceCommandData{commandSource}
+				}
+				updatedStatus := fmt.Sprintf("Scanning %s...", collectionSourceData.Name)
+				mythicrpc.SendMythicRPCTaskUpdate(mythicrpc.MythicRPCTaskUpdateMessage{
+					TaskID:       taskData.Task.ID,
+					UpdateStatus: &updatedStatus,
+				})
+				scanned, err := scanToolsWithYara(collectionSourceData, commandSources)
+				if err != nil {
+					logging.LogError(err, "failed to scan collection with YARA", "collection", collectionSourceData.Name)
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				for _, toolResults := range scanned {
+					scannedFiles += len(toolResults.Files)
+					if len(toolResults.matchedFiles()) > 0 {
+						matchedTools++
+						output.WriteString(toolResults.report())
+					}
+				}
+			}
+			output.WriteString(fmt.Sprintf("Scanned %d files, %d tools matched YARA rules\n", scannedFiles, matchedTools))
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(output.String()),
+			})
+			return response
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			if len(input) > 0 {
+				return args.LoadArgsFromJSONString(input)
+			}
+			return nil
+		},
+	})
+}
@@ -213,6 +213,91 @@ func init() {
 					},
 				},
 			},
+			{
+				Name:             "bof_beacon_api",
+				CLIName:          "bofBeaconAPI",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_ARRAY,
+				Description:      "Beacon API functions the bof loader supports, glob patterns like BeaconFormat* are allowed. Leave empty to not check bofs' imports",
+				ModalDisplayName: "Supported Beacon API functions",
+				DefaultValue:     []string{},
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     12,
+					},
+				},
+			},
+			{
+				Name:             "bof_unsupported_api_action",
+				CLIName:          "bofUnsupportedAPIAction",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE,
+				Description:      "What to do when a bof imports a Beacon API function the loader doesn't support",
+				ModalDisplayName: "Unsupported Beacon API action",
+				DefaultValue:     beaconAPIActionBlock,
+				Choices:          []string{beaconAPIActionBlock, beaconAPIActionWarn},
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     13,
+					},
+				},
+			},
+			{
+				Name:             "dll_command",
+				CLIName:          "dllCommand",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "Name of the command that loads a dll, used by Sliver armory aliases that aren't .NET assemblies. Leave empty if the agent can't load dlls",
+				ModalDisplayName: "DLL Command Name",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     14,
+					},
+				},
+			},
+			{
+				Name:             "dll_file_parameter_name",
+				CLIName:          "dllFileParameterName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "Name of the parameter that specifies the dll file UUID",
+				ModalDisplayName: "DLL File Parameter Name",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     15,
+					},
+				},
+			},
+			{
+				Name:             "dll_argument_parameter_name",
+				CLIName:          "dllArgumentParameterName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "Name of the parameter that specifies the dll argument string",
+				ModalDisplayName: "DLL argument string Parameter Name",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     16,
+					},
+				},
+			},
+			{
+				Name:             "dll_entrypoint_parameter_name",
+				CLIName:          "dllEntrypointParameterName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "Name of the parameter that specifies the dll export to call",
+				ModalDisplayName: "DLL Entrypoint Parameter Name",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     17,
+					},
+				},
+			},
 			{
 				Name:             "remove_support",
 				CLIName:          "remove",
@@ -245,7 +330,18 @@ func init() {
 			inputExecuteAssemblyFileParameterName, _ := taskData.Args.GetStringArg("execute_assembly_file_parameter_name")
 			inputExecuteAssemblyArgumentParameterName, _ := taskData.Args.GetStringArg("execute_assembly_argument_parameter_name")
 			inputAssemblyDefaultExecutionMethod, _ := taskData.Args.GetStringArg("assembly_default_execution_method")
+			inputBofBeaconAPI, _ := taskData.Args.GetArrayArg("bof_beacon_api")
+			inputBofUnsupportedAPIAction, _ := taskData.Args.GetChooseOneArg("bof_unsupported_api_action")
+			inputDllCommand, _ := taskData.Args.GetStringArg("dll_command")
+			inputDllFileParameterName, _ := taskData.Args.GetStringArg("dll_file_parameter_name")
+			inputDllArgumentParameterName, _ := taskData.Args.GetStringArg("dll_argument_parameter_name")
+			inputDllEntrypointParameterName, _ := taskData.Args.GetStringArg("dll_entrypoint_parameter_name")
 			remove, _ := taskData.Args.GetBooleanArg("remove_support")
+			if err := checkOperatorAccess("modify payload type support", taskData); err != nil {
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
 			supportedAgentsFile, err := getOrCreateFile(PayloadTypeSupportFilename)
 			if err != nil {
 				response.Success = false
@@ -265,6 +361,12 @@ func init() {
 				ExecuteAssemblyFileParameterName:     inputExecuteAssemblyFileParameterName,
 				ExecuteAssemblyArgumentParameterName: inputExecuteAssemblyArgumentParameterName,
 				AssemblyDefaultExecutionMethod:       inputAssemblyDefaultExecutionMethod,
+				BofBeaconAPI:                         inputBofBeaconAPI,
+				BofUnsupportedAPIAction:              inputBofUnsupportedAPIAction,
+				DllCommand:                           inputDllCommand,
+				DllFileParameterName:                 inputDllFileParameterName,
+				DllArgumentParameterName:             inputDllArgumentParameterName,
+				DllEntryPointParameterName:           inputDllEntrypointParameterName,
 			}
 			supportedAgents := []agentDefinition{}
 			err = json.Unmarshal(supportedAgentsFile, &supportedAgents)
@@ -302,11 +404,13 @@ func init() {
 			Initialize()
 			rabbitmq.SyncPayloadData(&payloadDefinition.Name, false)
 			if remove {
+				recordForgeChange(taskData, fmt.Sprintf("removed %s support for %s", PayloadTypeName, inputAgent))
 				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
 					TaskID:   taskData.Task.ID,
 					Response: []byte(fmt.Sprintf("Successfully removed support for %s", inputAgent)),
 				})
 			} else {
+				recordForgeChange(taskData, fmt.Sprintf("updated %s support for %s", PayloadTypeName, inputAgent))
 				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
 					TaskID:   taskData.Task.ID,
 					Response: []byte(fmt.Sprintf("Successfully added support for %s", inputAgent)),
@@ -0,0 +1,146 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+// httpCacheEntry is the metadata saved next to a cached response body
+type httpCacheEntry struct {
+	URL          string    `json:"url"`
+	Accept       string    `json:"accept"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	SavedAt      time.Time `json:"saved_at"`
+}
+
+// httpCache is a persistent cache of GitHub release metadata and assets keyed by URL. Cached responses are
+// revalidated with If-None-Match/If-Modified-Since, and a 304 response is served from disk. GitHub only skips
+// counting a 304 against the rate limit when the request is authorized, so without a GITHUB_TOKEN it still costs one.
+type httpCache struct {
+	directory string
+}
+
+func newHTTPCache(directory string) *httpCache {
+	return &httpCache{directory: directory}
+}
+
+func (c *httpCache) paths(req *http.Request) (string, string) {
+	// the same URL returns json metadata or raw bytes depending on the Accept header, so it's part of the key
+	hash := sha256.Sum256([]byte(req.Method + " " + req.URL.String() + " " + req.Header.Get("Accept")))
+	key := hex.EncodeToString(hash[:])
+	return filepath.Join(c.directory, key+".json"), filepath.Join(c.directory, key+".body")
+}
+
+// lookup returns the cache entry and path to the cached body for a request, if there is one
+func (c *httpCache) lookup(req *http.Request) (httpCacheEntry, string, bool) {
+	entry := httpCacheEntry{}
+	if c == nil || req.Method != http.MethodGet {
+		return entry, "", false
+	}
+	entryPath, bodyPath := c.paths(req)
+	entryContents, err := os.ReadFile(entryPath)
+	if err != nil {
+		return entry, "", false
+	}
+	if err = json.Unmarshal(entryContents, &entry); err != nil {
+		logging.LogError(err, "failed to parse http cache entry, ignoring it", "url", req.URL.String())
+		return entry, "", false
+	}
+	if _, err = os.Stat(bodyPath); err != nil {
+		return entry, "", false
+	}
+	return entry, bodyPath, true
+}
+
+// addConditionalHeaders turns a request into a conditional one if there's a cached response for it
+func (c *httpCache) addConditionalHeaders(req *http.Request) bool {
+	entry, _, ok := c.lookup(req)
+	if !ok {
+		return false
+	}
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+	return entry.ETag != "" || entry.LastModified != ""
+}
+
+// store saves a response body and its validators, skipping responses that can't be revalidated
+func (c *httpCache) store(req *http.Request, header http.Header, body io.Reader) {
+	if c == nil || req.Method != http.MethodGet {
+		return
+	}
+	entry := httpCacheEntry{
+		URL:          req.URL.String(),
+		Accept:       req.Header.Get("Accept"),
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		SavedAt:      time.Now().UTC(),
+	}
+	if entry.ETag == "" && entry.LastModified == "" {
+		return
+	}
+	if err := os.MkdirAll(c.directory, os.ModePerm); err != nil {
+		logging.LogError(err, "failed to create http cache folder")
+		return
+	}
+	entryPath, bodyPath := c.paths(req)
+	if err := writeFileAtomic(bodyPath, body); err != nil {
+		logging.LogError(err, "failed to save response to http cache", "url", entry.URL)
+		return
+	}
+	entryContents, err := json.Marshal(entry)
+	if err != nil {
+		logging.LogError(err, "failed to marshal http cache entry")
+		return
+	}
+	if err = writeFileAtomic(entryPath, bytes.NewReader(entryContents)); err != nil {
+		logging.LogError(err, "failed to save http cache entry", "url", entry.URL)
+	}
+}
+
+// storeFile saves a downloaded file in the cache
+func (c *httpCache) storeFile(req *http.Request, header http.Header, path string) {
+	if c == nil {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		logging.LogError(err, "failed to open download for http cache", "path", path)
+		return
+	}
+	defer file.Close()
+	c.store(req, header, file)
+}
+
+// writeFileAtomic writes contents to a temporary file and renames it into place so readers never see partial files
+func writeFileAtomic(path string, contents io.Reader) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tempFile, contents)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+// MitreCatalogFilename maps each collection's tools to MITRE ATT&CK technique IDs, keyed by collection name and then
+// by command name (or source name). Edit it to change the mappings on the generated commands.
+const MitreCatalogFilename = "mitre_catalog.json"
+
+type mitreCatalog map[string]map[string][]string
+
+var mitreTechniqueIDRegex = regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+
+func readMitreCatalog() (mitreCatalog, error) {
+	catalog := mitreCatalog{}
+	catalogBytes, err := os.ReadFile(MitreCatalogFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return catalog, nil
+	}
+	if err != nil {
+		return catalog, err
+	}
+	if err = json.Unmarshal(catalogBytes, &catalog); err != nil {
+		return catalog, fmt.Errorf("failed to parse %s: %w", MitreCatalogFilename, err)
+	}
+	return catalog, nil
+}
+
+// lookup returns the mappings for the first name that's in the catalog for that collection, so more specific names
+// (ex: a single command within a bof package) should come first. Names are case-insensitive.
+func (c mitreCatalog) lookup(collectionName string, names ...string) []string {
+	for catalogCollection, tools := range c {
+		if !strings.EqualFold(catalogCollection, collectionName) {
+			continue
+		}
+		for _, name := range names {
+			for toolName, techniques := range tools {
+				if strings.EqualFold(toolName, name) {
+					return techniques
+				}
+			}
+		}
+	}
+	return []string{}
+}
+
+func parseMitreMappings(mappings []string) ([]string, error) {
+	techniques := []string{}
+	for _, mapping := range mappings {
+		for _, technique := range strings.Split(mapping, ",") {
+			technique = strings.ToUpper(strings.TrimSpace(technique))
+			if technique == "" {
+				continue
+			}
+			if !mitreTechniqueIDRegex.MatchString(technique) {
+				return nil, fmt.Errorf("%q isn't a MITRE ATT&CK technique ID like T1003 or T1003.001", technique)
+			}
+			techniques = append(techniques, technique)
+		}
+	}
+	return techniques, nil
+}
+
+// setMitreMappings saves the mappings for a custom command in the catalog, removing the entry if there aren't any
+func setMitreMappings(collectionName string, commandName string, techniques []string) error {
+	catalog, err := readMitreCatalog()
+	if err != nil {
+		return err
+	}
+	if _, ok := catalog[collectionName]; !ok {
+		catalog[collectionName] = map[string][]string{}
+	}
+	if len(techniques) == 0 {
+		delete(catalog[collectionName], commandName)
+	} else {
+		catalog[collectionName][commandName] = techniques
+	}
+	catalogBytes, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeForgeFile(MitreCatalogFilename, catalogBytes, 0644)
+}
+
+// replaceMitreMappings is setMitreMappings that also returns a function to put the command's old mappings back, for
+// when registering the command fails after they've been saved
+func replaceMitreMappings(collectionName string, commandName string, techniques []string) (func(), error) {
+	catalog, err := readMitreCatalog()
+	if err != nil {
+		return nil, err
+	}
+	previous := catalog[collectionName][commandName]
+	if err = setMitreMappings(collectionName, commandName, techniques); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := setMitreMappings(collectionName, commandName, previous); err != nil {
+			logging.LogError(err, "failed to restore mitre mappings", "command", commandName)
+		}
+	}, nil
+}
+
+func getMitreMappings(collectionName string, names ...string) []string {
+	return forgeRegistry.getMitreMappings(collectionName, names...)
+}
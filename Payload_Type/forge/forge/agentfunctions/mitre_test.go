@@ -0,0 +1,61 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBundledMitreCatalogIsValid(t *testing.T) {
+	catalogBytes, err := os.ReadFile(filepath.Join("..", "..", MitreCatalogFilename))
+	if err != nil {
+		t.Fatalf("failed to read bundled catalog: %v", err)
+	}
+	catalog := mitreCatalog{}
+	if err = json.Unmarshal(catalogBytes, &catalog); err != nil {
+		t.Fatalf("failed to parse bundled catalog: %v", err)
+	}
+	for collection, tools := range catalog {
+		for tool, techniques := range tools {
+			if _, err = parseMitreMappings(techniques); err != nil || len(techniques) == 0 {
+				t.Errorf("%s/%s has invalid techniques %v: %v", collection, tool, techniques, err)
+			}
+		}
+	}
+	if !slices.Contains(catalog.lookup("sharpcollection", "rubeus"), "T1558.003") {
+		t.Fatalf("expected case-insensitive lookup of Rubeus to include kerberoasting")
+	}
+}
+
+func TestMitreMappingsForCustomCommands(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	if _, err := parseMitreMappings([]string{"T1003.001", "credential dumping"}); err == nil {
+		t.Fatalf("expected invalid technique IDs to be rejected")
+	}
+	techniques, err := parseMitreMappings([]string{"t1003.001, T1055", ""})
+	if err != nil || !slices.Equal(techniques, []string{"T1003.001", "T1055"}) {
+		t.Fatalf("unexpected techniques %v: %v", techniques, err)
+	}
+	if err = setMitreMappings("Bench", "bof-0", techniques); err != nil {
+		t.Fatalf("failed to save mappings: %v", err)
+	}
+	if mappings := getMitreMappings("Bench", "missing", "bof-0"); !slices.Equal(mappings, techniques) {
+		t.Fatalf("expected saved mappings to be used after the registry reloads, got %v", mappings)
+	}
+	if mappings := getMitreMappings("Other", "bof-0"); len(mappings) != 0 {
+		t.Fatalf("expected mappings to be per collection, got %v", mappings)
+	}
+	restore, err := replaceMitreMappings("Bench", "bof-0", []string{"T1059"})
+	if err != nil {
+		t.Fatalf("failed to replace mappings: %v", err)
+	}
+	if mappings := getMitreMappings("Bench", "bof-0"); !slices.Equal(mappings, []string{"T1059"}) {
+		t.Fatalf("expected the replaced mappings, got %v", mappings)
+	}
+	restore()
+	if mappings := getMitreMappings("Bench", "bof-0"); !slices.Equal(mappings, techniques) {
+		t.Fatalf("expected a failed registration to restore the old mappings, got %v", mappings)
+	}
+}
@@ -0,0 +1,300 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+// what forge_register and forge_create do when a command name is already registered by another collection
+const collisionFail = "fail"
+const collisionReplace = "replace"
+const collisionRename = "rename"
+
+var collisionChoices = []string{collisionFail, collisionReplace, collisionRename}
+
+var commandCollisionError = errors.New("command name is already registered by another collection")
+var invalidCommandNameError = errors.New("command names and namespaces can only have letters, numbers, '.', '-', and '_'")
+
+var validCommandName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// forgeCommandName is the name a collection's command is registered under. A rename from the *_sources.json entry
+// replaces the command name, otherwise the collection's namespace is added in front of it, ex: forge_net_sc_Rubeus.
+func forgeCommandName(prefix string, commandSource collectionSourceCommandData, collectionSourceData collectionSource, commandName string) string {
+	if renamed, ok := commandSource.Renames[commandName]; ok && renamed != "" {
+		return prefix + renamed
+	}
+	if collectionSourceData.Namespace != "" {
+		return fmt.Sprintf("%s%s_%s", prefix, collectionSourceData.Namespace, commandName)
+	}
+	return prefix + commandName
+}
+
+func assemblyCommandName(commandSource collectionSourceCommandData, collectionSourceData collectionSource) string {
+	return forgeCommandName(AssemblyPrefix, commandSource, collectionSourceData, commandSource.CommandName)
+}
+
+// commandCollision is a command name that's already registered by a different collection
+type commandCollision struct {
+	CommandName           string
+	CollectionName        string
+	CollectionCommandName string
+}
+
+func (c commandCollision) String() string {
+	return fmt.Sprintf("%s is already registered by %s's %s", c.CommandName, c.CollectionName, c.CollectionCommandName)
+}
+
+// findCommandCollisions checks which of a collection's command names are already registered by other collections
+func findCommandCollisions(collectionSourceData collectionSource, commandNames []string) []commandCollision {
+	collisions := []commandCollision{}
+	for _, commandName := range commandNames {
+		registeredCommand, ok := forgeRegistry.findRegisteredCommand(commandName)
+		if !ok || registeredCommand.CollectionType == collectionSourceData.Name {
+			continue
+		}
+		collisions = append(collisions, commandCollision{
+			CommandName:           commandName,
+			CollectionName:        registeredCommand.CollectionType,
+			CollectionCommandName: registeredCommand.CollectionCommandName,
+		})
+	}
+	return collisions
+}
+
+func collisionErrorMessage(collisions []commandCollision) error {
+	lines := []string{}
+	for _, collision := range collisions {
+		lines = append(lines, collision.String())
+	}
+	return fmt.Errorf("%w: %s\nSet collision to %s to take the name over, to %s with a new name, or set a namespace for this collection in %s",
+		commandCollisionError, strings.Join(lines, ", "), collisionReplace, collisionRename, CollectionSources)
+}
+
+// unregisterCollisions removes the other collections' entries for the colliding names from their *_commands.json
+// files so only one collection claims each name
+func unregisterCollisions(collisions []commandCollision) error {
+	for _, collision := range collisions {
+		otherCollection, err := getCollectionSource(collision.CollectionName)
+		if err != nil {
+			return err
+		}
+		commandsFile, err := getOrCreateFile(otherCollection.CommandsFilename)
+		if err != nil {
+			return err
+		}
+		commands := []json.RawMessage{}
+		if err = json.Unmarshal(commandsFile, &commands); err != nil {
+			logging.LogError(err, "failed to parse commands file", "collection", otherCollection.Name)
+			return err
+		}
+		remainingCommands := []json.RawMessage{}
+		for _, command := range commands {
+			registeredCommand := registeredCollectionCommand{}
+			if json.Unmarshal(command, &registeredCommand) == nil && registeredCommand.CommandName == collision.CommandName {
+				continue
+			}
+			remainingCommands = append(remainingCommands, command)
+		}
+		commandsFile, err = json.MarshalIndent(remainingCommands, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err = writeForgeFile(otherCollection.CommandsFilename, commandsFile, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveSourceCommandRenames saves a source entry's renamed commands in the collection's *_sources.json
+func saveSourceCommandRenames(commandSource collectionSourceCommandData, collectionSourceData collectionSource) error {
+	commandSources := getCollectionSourceCommands(collectionSourceData)
+	for i := range commandSources {
+		if commandSources[i].Name == commandSource.Name {
+			commandSources[i].Renames = commandSource.Renames
+		}
+	}
+	commandBytes, err := json.MarshalIndent(commandSources, "", "\t")
+	if err != nil {
+		logging.LogError(err, "failed to marshal command sources")
+		return err
+	}
+	return writeForgeFile(collectionSourceData.SourceFilename, commandBytes, os.ModePerm)
+}
+
+// generatedCommandNames maps every command name a source entry registers to the command name it came from
+func generatedCommandNames(commandSource collectionSourceCommandData, collectionSourceData collectionSource) map[string]string {
+	if collectionSourceData.Type == "assembly" {
+		return map[string]string{assemblyCommandName(commandSource, collectionSourceData): commandSource.CommandName}
+	}
+	commandNames := map[string]string{}
+	commandDefinitions, err := loadBofCommandDefinitions(commandSource, collectionSourceData)
+	if err != nil {
+		commandNames[forgeCommandName(BofPrefix, commandSource, collectionSourceData, commandSource.CommandName)] = commandSource.CommandName
+		return commandNames
+	}
+	for _, commandDefinition := range commandDefinitions {
+		commandName := commandDefinition.CommandName
+		if commandName == "" {
+			commandName = commandSource.CommandName
+		}
+		commandNames[forgeCommandName(commandDefinition.commandPrefix(), commandSource, collectionSourceData, commandName)] = commandName
+	}
+	return commandNames
+}
+
+func collisionsForSource(commandSource collectionSourceCommandData, collectionSourceData collectionSource) []commandCollision {
+	commandNames := []string{}
+	for commandName := range generatedCommandNames(commandSource, collectionSourceData) {
+		commandNames = append(commandNames, commandName)
+	}
+	slices.Sort(commandNames)
+	return findCommandCollisions(collectionSourceData, commandNames)
+}
+
+// collisionResolution is how a source entry's collisions were resolved. Replacing the other collections' commands and
+// saving a rename are left to apply, so nothing changes if registering the command fails.
+type collisionResolution struct {
+	choice               string
+	originalSource       collectionSourceCommandData
+	commandSource        collectionSourceCommandData
+	collectionSourceData collectionSource
+	collisions           []commandCollision
+}
+
+// apply unregisters the other collections' commands or saves the rename once the command has been registered (or
+// quarantined), reporting what was done to the task when there is one
+func (r collisionResolution) apply(taskData *agentstructs.PTTaskMessageAllData) error {
+	if len(r.collisions) == 0 {
+		return nil
+	}
+	switch r.choice {
+	case collisionReplace:
+		if err := unregisterCollisions(r.collisions); err != nil {
+			return err
+		}
+	case collisionRename:
+		if err := saveSourceCommandRenames(r.commandSource, r.collectionSourceData); err != nil {
+			return err
+		}
+	}
+	if taskData == nil {
+		return nil
+	}
+	for _, collision := range r.collisions {
+		mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+			TaskID:   taskData.Task.ID,
+			Response: []byte(collisionMessage(collision, r.choice, r.originalSource, r.commandSource, r.collectionSourceData)),
+		})
+	}
+	return nil
+}
+
+// resolveCommandCollisions checks the operator's collision choice before a source entry's commands are registered,
+// returning the source entry to register and the changes to apply once it has been
+func resolveCommandCollisions(commandSource collectionSourceCommandData, collectionSourceData collectionSource, choice string, newName string) (collisionResolution, error) {
+	resolution := collisionResolution{
+		choice:               choice,
+		originalSource:       commandSource,
+		commandSource:        commandSource,
+		collectionSourceData: collectionSourceData,
+	}
+	if collectionSourceData.Namespace != "" && !validCommandName.MatchString(collectionSourceData.Namespace) {
+		return resolution, fmt.Errorf("%w: %s namespace %s", invalidCommandNameError, collectionSourceData.Name, collectionSourceData.Namespace)
+	}
+	resolution.collisions = collisionsForSource(commandSource, collectionSourceData)
+	if len(resolution.collisions) == 0 {
+		return resolution, nil
+	}
+	switch choice {
+	case collisionReplace:
+		return resolution, nil
+	case collisionRename:
+		if len(resolution.collisions) != 1 {
+			return resolution, fmt.Errorf("%w: only one command can be renamed at a time, set a namespace for this collection in %s instead",
+				commandCollisionError, CollectionSources)
+		}
+		if newName == "" {
+			return resolution, fmt.Errorf("%w: a new name is needed to rename %s", commandCollisionError, resolution.collisions[0].CommandName)
+		}
+		if !validCommandName.MatchString(newName) {
+			return resolution, fmt.Errorf("%w: %s", invalidCommandNameError, newName)
+		}
+		renamedSource := commandSource
+		renamedSource.Renames = maps.Clone(commandSource.Renames)
+		if renamedSource.Renames == nil {
+			renamedSource.Renames = map[string]string{}
+		}
+		renamedSource.Renames[generatedCommandNames(commandSource, collectionSourceData)[resolution.collisions[0].CommandName]] = newName
+		if remaining := collisionsForSource(renamedSource, collectionSourceData); len(remaining) > 0 {
+			return resolution, collisionErrorMessage(remaining)
+		}
+		resolution.commandSource = renamedSource
+		return resolution, nil
+	default:
+		return resolution, collisionErrorMessage(resolution.collisions)
+	}
+}
+
+// collisionParameters are the collision and newName parameters for forge_register and forge_create in each group
+func collisionParameters(groupNames []string, position uint32) []agentstructs.CommandParameter {
+	collisionGroups := []agentstructs.ParameterGroupInfo{}
+	newNameGroups := []agentstructs.ParameterGroupInfo{}
+	for _, groupName := range groupNames {
+		collisionGroups = append(collisionGroups, agentstructs.ParameterGroupInfo{GroupName: groupName, UIModalPosition: position})
+		newNameGroups = append(newNameGroups, agentstructs.ParameterGroupInfo{GroupName: groupName, UIModalPosition: position + 1})
+	}
+	return []agentstructs.CommandParameter{
+		{
+			Name:                      "collision",
+			ParameterType:             agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE,
+			Choices:                   collisionChoices,
+			Description:               "What to do when another collection already registered a command with the same name: fail, replace it, or rename this one",
+			DefaultValue:              collisionFail,
+			ModalDisplayName:          "On Name Collision",
+			ParameterGroupInformation: collisionGroups,
+		},
+		{
+			Name:                      "newName",
+			ParameterType:             agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+			Description:               "The new command name (without the forge prefix) when collision is rename",
+			DefaultValue:              "",
+			ModalDisplayName:          "New Command Name",
+			ParameterGroupInformation: newNameGroups,
+		},
+	}
+}
+
+// collisionMessage tells the operator how a collision was handled. originalSource is the source entry before any rename
+// and commandSource is the one being registered.
+func collisionMessage(collision commandCollision, choice string, originalSource collectionSourceCommandData,
+	commandSource collectionSourceCommandData, collectionSourceData collectionSource) string {
+	if choice != collisionRename {
+		return fmt.Sprintf("[!] %s, replacing it\n", collision.String())
+	}
+	originalName := generatedCommandNames(originalSource, collectionSourceData)[collision.CommandName]
+	for commandName, unprefixedName := range generatedCommandNames(commandSource, collectionSourceData) {
+		if unprefixedName == originalName {
+			return fmt.Sprintf("[*] %s, registering this one as %s instead\n", collision.String(), commandName)
+		}
+	}
+	return fmt.Sprintf("[*] %s, renaming this one\n", collision.String())
+}
+
+// applyCollisionChoice checks a source entry's command names against other collections using the task's collision
+// choice. The returned resolution has the source entry to register, and has to be applied once it's registered.
+func applyCollisionChoice(taskData *agentstructs.PTTaskMessageAllData, commandSource collectionSourceCommandData, collectionSourceData collectionSource) (collisionResolution, error) {
+	choice, _ := taskData.Args.GetChooseOneArg("collision")
+	newName, _ := taskData.Args.GetStringArg("newName")
+	return resolveCommandCollisions(commandSource, collectionSourceData, choice, newName)
+}
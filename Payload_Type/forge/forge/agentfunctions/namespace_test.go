@@ -0,0 +1,126 @@
+package agentfunctions
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupCollisionFixture adds an Other bof collection with a bof-0 package that collides with the registry fixture's
+func setupCollisionFixture(t *testing.T) (collectionSourceCommandData, collectionSource) {
+	t.Helper()
+	setupRegistryFixture(t, 1)
+	writeJSONFile(t, CollectionSources, []collectionSource{{Name: "Bench", Type: "bof"}, {Name: "Other", Type: "bof"}})
+	writeJSONFile(t, filepath.Join(".", PayloadTypeName, "collections", "Other", "bof-0", "extension.json"), bofCommandDefinition{
+		Name:        "bof-0",
+		CommandName: "bof-0",
+		Entrypoint:  "go",
+		Files:       []bofCommandDefinitionFiles{{OS: "windows", Arch: "amd64", Path: "bof-0.x64.o"}},
+	})
+	commandSource := collectionSourceCommandData{Name: "bof-0", CommandName: "bof-0"}
+	writeJSONFile(t, "Other_sources.json", []collectionSourceCommandData{commandSource})
+	forgeRegistry.invalidate()
+	collectionSourceData, err := getCollectionSource("Other")
+	if err != nil {
+		t.Fatalf("expected Other collection to be found, got %v", err)
+	}
+	return commandSource, collectionSourceData
+}
+
+func TestForgeCommandName(t *testing.T) {
+	commandSource := collectionSourceCommandData{CommandName: "Rubeus", Renames: map[string]string{"Seatbelt": "sb"}}
+	tests := []struct {
+		namespace   string
+		commandName string
+		expected    string
+	}{
+		{"", "Rubeus", "forge_net_Rubeus"},
+		{"sc", "Rubeus", "forge_net_sc_Rubeus"},
+		{"sc", "Seatbelt", "forge_net_sb"},
+	}
+	for _, test := range tests {
+		name := forgeCommandName(AssemblyPrefix, commandSource, collectionSource{Namespace: test.namespace}, test.commandName)
+		if name != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, name)
+		}
+	}
+}
+
+func TestResolveCommandCollisions(t *testing.T) {
+	commandSource, collectionSourceData := setupCollisionFixture(t)
+	collisions := collisionsForSource(commandSource, collectionSourceData)
+	if len(collisions) != 1 || collisions[0].CommandName != BofPrefix+"bof-0" || collisions[0].CollectionName != "Bench" {
+		t.Fatalf("expected a collision with Bench's bof-0, got %v", collisions)
+	}
+	if _, err := resolveCommandCollisions(commandSource, collectionSourceData, collisionFail, ""); !errors.Is(err, commandCollisionError) {
+		t.Fatalf("expected collision error, got %v", err)
+	}
+	if _, err := resolveCommandCollisions(commandSource, collectionSourceData, collisionRename, "bad name"); !errors.Is(err, invalidCommandNameError) {
+		t.Fatalf("expected invalid name error, got %v", err)
+	}
+	if _, err := resolveCommandCollisions(commandSource, collectionSourceData, collisionRename, "bof-0"); !errors.Is(err, commandCollisionError) {
+		t.Fatalf("expected renaming onto the same name to still collide, got %v", err)
+	}
+
+	resolution, err := resolveCommandCollisions(commandSource, collectionSourceData, collisionRename, "other-bof")
+	if err != nil {
+		t.Fatalf("expected rename to succeed, got %v", err)
+	}
+	renamedSource := resolution.commandSource
+	if names := getBofCommandNamesForSource(renamedSource, collectionSourceData); len(names) != 1 || names[0] != BofPrefix+"other-bof" {
+		t.Fatalf("expected renamed command name, got %v", names)
+	}
+	message := collisionMessage(collisions[0], collisionRename, commandSource, renamedSource, collectionSourceData)
+	if !strings.HasSuffix(message, "registering this one as "+BofPrefix+"other-bof instead\n") {
+		t.Fatalf("expected the rename message to name the new command, got %q", message)
+	}
+	if savedSource, _ := forgeRegistry.findSourceCommand("Other", "bof-0"); len(savedSource.Renames) != 0 {
+		t.Fatalf("expected the rename to wait until the command is registered, got %v", savedSource.Renames)
+	}
+	if err = resolution.apply(nil); err != nil {
+		t.Fatalf("failed to apply the rename: %v", err)
+	}
+	savedSource, ok := forgeRegistry.findSourceCommand("Other", "bof-0")
+	if !ok || savedSource.Renames["bof-0"] != "other-bof" {
+		t.Fatalf("expected rename to be saved in the sources file, got %v", savedSource.Renames)
+	}
+	if len(collisionsForSource(savedSource, collectionSourceData)) != 0 {
+		t.Fatalf("expected no collisions after the rename")
+	}
+}
+
+func TestResolveCommandCollisionsReplace(t *testing.T) {
+	commandSource, collectionSourceData := setupCollisionFixture(t)
+	resolution, err := resolveCommandCollisions(commandSource, collectionSourceData, collisionReplace, "")
+	if err != nil || len(resolution.collisions) != 1 {
+		t.Fatalf("expected one collision to be replaced, got %v, %v", resolution.collisions, err)
+	}
+	if len(forgeRegistry.getRegisteredCommands("Bench")) != 1 {
+		t.Fatalf("expected Bench's command to stay registered until the replacement is registered")
+	}
+	if err = resolution.apply(nil); err != nil {
+		t.Fatalf("failed to apply the replacement: %v", err)
+	}
+	if len(forgeRegistry.getRegisteredCommands("Bench")) != 0 {
+		t.Fatalf("expected Bench's command to be unregistered")
+	}
+	if len(collisionsForSource(commandSource, collectionSourceData)) != 0 {
+		t.Fatalf("expected no collisions after replacing")
+	}
+}
+
+func TestNamespaceAvoidsCollisions(t *testing.T) {
+	commandSource, collectionSourceData := setupCollisionFixture(t)
+	collectionSourceData.Namespace = "other"
+	if names := getBofCommandNamesForSource(commandSource, collectionSourceData); len(names) != 1 || names[0] != BofPrefix+"other_bof-0" {
+		t.Fatalf("expected namespaced command name, got %v", names)
+	}
+	if collisions := collisionsForSource(commandSource, collectionSourceData); len(collisions) != 0 {
+		t.Fatalf("expected no collisions with a namespace, got %v", collisions)
+	}
+	collectionSourceData.Namespace = "my tools"
+	if _, err := resolveCommandCollisions(commandSource, collectionSourceData, collisionFail, ""); !errors.Is(err, invalidCommandNameError) {
+		t.Fatalf("expected invalid namespace error, got %v", err)
+	}
+}
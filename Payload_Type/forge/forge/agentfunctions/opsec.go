@@ -0,0 +1,96 @@
+package agentfunctions
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+)
+
+const opsecNoiseLow = "low"
+const opsecNoiseMedium = "medium"
+const opsecNoiseHigh = "high"
+
+// commandOPSEC is optional per-tool metadata from a *_sources.json file that's turned into OPSEC pre-checks
+type commandOPSEC struct {
+	Noise                     string   `json:"noise,omitempty"`
+	RequiredExecutionMethod   string   `json:"required_execution_method,omitempty"`
+	ForbiddenExecutionMethods []string `json:"forbidden_execution_methods,omitempty"`
+	Notes                     string   `json:"notes,omitempty"`
+}
+
+// description is added to the generated command's description so operators see it before tasking
+func (o *commandOPSEC) description() string {
+	if o == nil {
+		return ""
+	}
+	details := []string{}
+	if o.Noise != "" {
+		details = append(details, fmt.Sprintf("noise %s", o.Noise))
+	}
+	if o.RequiredExecutionMethod != "" {
+		details = append(details, fmt.Sprintf("requires %s", o.RequiredExecutionMethod))
+	}
+	if len(o.ForbiddenExecutionMethods) > 0 {
+		details = append(details, fmt.Sprintf("don't use %s", strings.Join(o.ForbiddenExecutionMethods, ", ")))
+	}
+	if o.Notes != "" {
+		details = append(details, o.Notes)
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nOPSEC: %s", strings.Join(details, "; "))
+}
+
+// evaluate returns the OPSEC messages for a task and if the task should be blocked until the operator bypasses it.
+// High noise tools and execution methods that the tool doesn't support are blocked, everything else is a warning.
+func (o *commandOPSEC) evaluate(executionMethod string) (bool, []string) {
+	if o == nil {
+		return false, nil
+	}
+	blocked := false
+	messages := []string{}
+	if o.RequiredExecutionMethod != "" && executionMethod != o.RequiredExecutionMethod {
+		blocked = true
+		messages = append(messages, fmt.Sprintf("This tool needs to run with %s, not %s", o.RequiredExecutionMethod, executionMethod))
+	}
+	if slices.Contains(o.ForbiddenExecutionMethods, executionMethod) {
+		blocked = true
+		messages = append(messages, fmt.Sprintf("This tool is known to have problems with %s", executionMethod))
+	}
+	switch o.Noise {
+	case opsecNoiseHigh:
+		blocked = true
+		messages = append(messages, "This tool is noisy and likely to be detected")
+	case opsecNoiseMedium:
+		messages = append(messages, "This tool generates a moderate amount of activity")
+	}
+	if o.Notes != "" {
+		messages = append(messages, o.Notes)
+	}
+	return blocked, messages
+}
+
+// forgeOPSECPre combines the engagement policy with the tool's OPSEC metadata. Engagement approvals need a lead,
+// while tool OPSEC blocks can be bypassed by the operator that issued the task.
+func forgeOPSECPre(taskData *agentstructs.PTTaskMessageAllData, task engagementTask, opsec *commandOPSEC) agentstructs.PTTTaskOPSECPreTaskMessageResponse {
+	response := engagementPolicyOPSECPre(taskData, task)
+	if !response.Success {
+		return response
+	}
+	blocked, messages := opsec.evaluate(task.ExecutionMethod)
+	if len(messages) == 0 {
+		return response
+	}
+	if response.OpsecPreMessage != "" {
+		messages = append(messages, response.OpsecPreMessage)
+	}
+	response.OpsecPreMessage = strings.Join(messages, "\n")
+	if blocked && !response.OpsecPreBlocked {
+		response.OpsecPreBlocked = true
+		response.OpsecPreBypassRole = agentstructs.OPSEC_ROLE_OPERATOR
+	}
+	return response
+}
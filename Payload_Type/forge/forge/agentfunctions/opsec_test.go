@@ -0,0 +1,50 @@
+package agentfunctions
+
+import (
+	"strings"
+	"testing"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+)
+
+func TestCommandOPSECEvaluate(t *testing.T) {
+	var missing *commandOPSEC
+	if blocked, messages := missing.evaluate("execute_assembly"); blocked || len(messages) != 0 || missing.description() != "" {
+		t.Fatalf("expected no metadata to have no effect")
+	}
+	opsec := &commandOPSEC{Noise: opsecNoiseMedium, ForbiddenExecutionMethods: []string{"inline_assembly"}, Notes: "calls Environment.Exit"}
+	if blocked, messages := opsec.evaluate("execute_assembly"); blocked || len(messages) != 2 {
+		t.Fatalf("expected medium noise to only warn, got %v %v", blocked, messages)
+	}
+	if blocked, _ := opsec.evaluate("inline_assembly"); !blocked {
+		t.Fatalf("expected forbidden execution method to be blocked")
+	}
+	opsec = &commandOPSEC{RequiredExecutionMethod: "execute_assembly"}
+	if blocked, _ := opsec.evaluate("inline_assembly"); !blocked {
+		t.Fatalf("expected other execution methods to be blocked")
+	}
+	opsec = &commandOPSEC{Noise: opsecNoiseHigh}
+	if !strings.Contains(opsec.description(), "noise high") {
+		t.Fatalf("expected noise in description, got %q", opsec.description())
+	}
+}
+
+func TestForgeOPSECPreBypassRoles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	taskData := &agentstructs.PTTaskMessageAllData{}
+	task := engagementTask{Tools: []string{"SharpHound"}, ExecutionMethod: "execute_assembly"}
+	response := forgeOPSECPre(taskData, task, &commandOPSEC{Noise: opsecNoiseHigh})
+	if !response.OpsecPreBlocked || response.OpsecPreBypassRole != agentstructs.OPSEC_ROLE_OPERATOR {
+		t.Fatalf("expected noisy tool to be blocked for the operator to bypass, got %+v", response)
+	}
+	writeJSONFile(t, EngagementPolicyFilename, engagementPolicy{Rules: []engagementRule{
+		{Name: "collection", Action: engagementActionRequireApproval, Tools: []string{"sharphound"}},
+	}})
+	response = forgeOPSECPre(taskData, task, &commandOPSEC{Noise: opsecNoiseHigh})
+	if !response.OpsecPreBlocked || response.OpsecPreBypassRole != agentstructs.OPSEC_ROLE_LEAD {
+		t.Fatalf("expected engagement approval to need a lead, got %+v", response)
+	}
+	if !strings.Contains(response.OpsecPreMessage, "noisy") || !strings.Contains(response.OpsecPreMessage, "collection") {
+		t.Fatalf("expected both messages, got %q", response.OpsecPreMessage)
+	}
+}
@@ -0,0 +1,220 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+const EngagementPolicyFilename = "forge_engagement_policy.json"
+
+// engagement rule actions, ordered from least to most severe
+const engagementActionAllow = ""
+const engagementActionWarn = "warn"
+const engagementActionRequireApproval = "require_approval"
+const engagementActionDeny = "deny"
+
+// bofExecutionMethod is the execution method rules match against for forge_bof_ commands
+const bofExecutionMethod = "bof"
+
+// dllExecutionMethod is the execution method rules match against for forge_alias_ commands that load a dll
+const dllExecutionMethod = "dll"
+
+var engagementPolicyDeniedError = errors.New("blocked by engagement policy")
+
+// engagementRule matches tasking for forge commands. Every field that's set has to match for the rule to apply, and
+// a field matches if any of its values match. String values are case-insensitive glob patterns.
+type engagementRule struct {
+	Name             string   `json:"name"`
+	Action           string   `json:"action"`
+	Message          string   `json:"message"`
+	Tools            []string `json:"tools"`
+	Collections      []string `json:"collections"`
+	ExecutionMethods []string `json:"execution_methods"`
+	Hosts            []string `json:"hosts"`
+	Users            []string `json:"users"`
+	ProcessNames     []string `json:"process_names"`
+	IntegrityLevels  []int    `json:"integrity_levels"`
+	PayloadTypes     []string `json:"payload_types"`
+	YaraRules        []string `json:"yara_rules"`
+}
+
+type engagementPolicy struct {
+	Rules []engagementRule `json:"rules"`
+}
+
+// engagementTask is everything about a task that engagement rules can match on
+type engagementTask struct {
+	Tools           []string
+	Collection      string
+	ExecutionMethod string
+	Host            string
+	User            string
+	ProcessName     string
+	IntegrityLevel  int
+	PayloadType     string
+	YaraMatches     []string
+}
+
+// engagementDecision is the most severe action out of all matching rules, along with the rule that caused it
+type engagementDecision struct {
+	Action   string
+	Rule     engagementRule
+	Warnings []engagementRule
+}
+
+func newEngagementTask(taskData *agentstructs.PTTaskMessageAllData, collectionName string, executionMethod string, tools ...string) engagementTask {
+	return engagementTask{
+		Tools:           tools,
+		Collection:      collectionName,
+		ExecutionMethod: executionMethod,
+		Host:            taskData.Callback.Host,
+		User:            taskData.Callback.User,
+		ProcessName:     taskData.Callback.ProcessName,
+		IntegrityLevel:  taskData.Callback.IntegrityLevel,
+		PayloadType:     taskData.PayloadType,
+		YaraMatches:     getYaraMatches(collectionName, tools...),
+	}
+}
+
+func getEngagementPolicy() (engagementPolicy, error) {
+	policy := engagementPolicy{}
+	policyBytes, err := os.ReadFile(EngagementPolicyFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, err
+	}
+	if err = json.Unmarshal(policyBytes, &policy); err != nil {
+		return policy, fmt.Errorf("failed to parse %s: %w", EngagementPolicyFilename, err)
+	}
+	for i, rule := range policy.Rules {
+		switch rule.Action {
+		case engagementActionWarn, engagementActionRequireApproval, engagementActionDeny:
+		default:
+			return policy, fmt.Errorf("rule %d (%s) in %s has unknown action %q", i, rule.Name, EngagementPolicyFilename, rule.Action)
+		}
+	}
+	return policy, nil
+}
+
+func engagementActionSeverity(action string) int {
+	return slices.Index([]string{engagementActionAllow, engagementActionWarn, engagementActionRequireApproval, engagementActionDeny}, action)
+}
+
+func matchesEngagementPatterns(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			if matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(value)); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r engagementRule) matches(task engagementTask) bool {
+	return matchesEngagementPatterns(r.Tools, task.Tools...) &&
+		matchesEngagementPatterns(r.Collections, task.Collection) &&
+		matchesEngagementPatterns(r.ExecutionMethods, task.ExecutionMethod) &&
+		matchesEngagementPatterns(r.Hosts, task.Host) &&
+		matchesEngagementPatterns(r.Users, task.User) &&
+		matchesEngagementPatterns(r.ProcessNames, task.ProcessName) &&
+		matchesEngagementPatterns(r.PayloadTypes, task.PayloadType) &&
+		matchesEngagementPatterns(r.YaraRules, task.YaraMatches...) &&
+		(len(r.IntegrityLevels) == 0 || slices.Contains(r.IntegrityLevels, task.IntegrityLevel))
+}
+
+func (r engagementRule) String() string {
+	name := r.Name
+	if name == "" {
+		name = "unnamed"
+	}
+	if r.Message == "" {
+		return fmt.Sprintf("rule %q (%s)", name, r.Action)
+	}
+	return fmt.Sprintf("rule %q (%s): %s", name, r.Action, r.Message)
+}
+
+func (p engagementPolicy) evaluate(task engagementTask) engagementDecision {
+	decision := engagementDecision{Action: engagementActionAllow}
+	for _, rule := range p.Rules {
+		if !rule.matches(task) {
+			continue
+		}
+		if rule.Action == engagementActionWarn {
+			decision.Warnings = append(decision.Warnings, rule)
+		}
+		if engagementActionSeverity(rule.Action) > engagementActionSeverity(decision.Action) {
+			decision.Action = rule.Action
+			decision.Rule = rule
+		}
+	}
+	return decision
+}
+
+// evaluateEngagementPolicy loads the policy and evaluates it for a task. A policy file that can't be read denies the task.
+func evaluateEngagementPolicy(task engagementTask) (engagementDecision, error) {
+	policy, err := getEngagementPolicy()
+	if err != nil {
+		logging.LogError(err, "failed to load engagement policy")
+		return engagementDecision{Action: engagementActionDeny}, fmt.Errorf("%w: %s", engagementPolicyDeniedError, err.Error())
+	}
+	return policy.evaluate(task), nil
+}
+
+// engagementPolicyOPSECPre blocks tasks that match a require_approval rule until a lead bypasses the block in Mythic
+func engagementPolicyOPSECPre(taskData *agentstructs.PTTaskMessageAllData, task engagementTask) agentstructs.PTTTaskOPSECPreTaskMessageResponse {
+	response := agentstructs.PTTTaskOPSECPreTaskMessageResponse{
+		TaskID:  taskData.Task.ID,
+		Success: true,
+	}
+	decision, err := evaluateEngagementPolicy(task)
+	if err != nil || decision.Action != engagementActionRequireApproval {
+		// denied tasks are failed during tasking so they can't be bypassed
+		return response
+	}
+	response.OpsecPreBlocked = true
+	response.OpsecPreBypassRole = agentstructs.OPSEC_ROLE_LEAD
+	response.OpsecPreMessage = fmt.Sprintf("Engagement policy %s\nA lead needs to approve this task.", decision.Rule.String())
+	return response
+}
+
+// checkEngagementPolicy is called during tasking before passing execution to the callback's payload type.
+// Denied tasks fail with the rule that blocked them, and warnings are added to the task's output.
+func checkEngagementPolicy(taskData *agentstructs.PTTaskMessageAllData, task engagementTask) error {
+	decision, err := evaluateEngagementPolicy(task)
+	if err != nil {
+		return err
+	}
+	switch decision.Action {
+	case engagementActionDeny:
+		return fmt.Errorf("%w %s", engagementPolicyDeniedError, decision.Rule.String())
+	case engagementActionRequireApproval:
+		if !taskData.Task.OpsecPreBypassed {
+			return fmt.Errorf("%w %s, and it hasn't been approved", engagementPolicyDeniedError, decision.Rule.String())
+		}
+	}
+	for _, warning := range decision.Warnings {
+		mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+			TaskID:   taskData.Task.ID,
+			Response: []byte(fmt.Sprintf("[!] Engagement policy %s\n", warning.String())),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package agentfunctions
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEngagementPolicyEvaluate(t *testing.T) {
+	policy := engagementPolicy{Rules: []engagementRule{
+		{Name: "no sharphound", Action: engagementActionDeny, Tools: []string{"sharphound"}},
+		{Name: "no fork and run on prod", Action: engagementActionDeny, ExecutionMethods: []string{"execute_assembly"}, Hosts: []string{"prod-*"}},
+		{Name: "inline in lsass", Action: engagementActionRequireApproval, ExecutionMethods: []string{"inline_assembly"}, ProcessNames: []string{"*lsass*"}},
+		{Name: "system bofs", Action: engagementActionWarn, Collections: []string{"SliverArmory"}, IntegrityLevels: []int{4}},
+	}}
+	for _, test := range []struct {
+		name   string
+		task   engagementTask
+		action string
+		rule   string
+	}{
+		{"tool name is case-insensitive", engagementTask{Tools: []string{"SharpHound", "forge_net_SharpHound"}}, engagementActionDeny, "no sharphound"},
+		{"host glob and method", engagementTask{Tools: []string{"Rubeus"}, ExecutionMethod: "execute_assembly", Host: "PROD-DC01"}, engagementActionDeny, "no fork and run on prod"},
+		{"other hosts allowed", engagementTask{Tools: []string{"Rubeus"}, ExecutionMethod: "execute_assembly", Host: "dev-ws01"}, engagementActionAllow, ""},
+		{"approval", engagementTask{ExecutionMethod: "inline_assembly", ProcessName: `C:\Windows\System32\lsass.exe`}, engagementActionRequireApproval, "inline in lsass"},
+		{"warning", engagementTask{Collection: "SliverArmory", ExecutionMethod: bofExecutionMethod, IntegrityLevel: 4}, engagementActionWarn, "system bofs"},
+	} {
+		decision := policy.evaluate(test.task)
+		if decision.Action != test.action || decision.Rule.Name != test.rule {
+			t.Errorf("%s: expected %q from %q, got %q from %q", test.name, test.action, test.rule, decision.Action, decision.Rule.Name)
+		}
+	}
+	decision := policy.evaluate(engagementTask{Tools: []string{"SharpHound"}, Collection: "SliverArmory", IntegrityLevel: 4})
+	if decision.Action != engagementActionDeny || len(decision.Warnings) != 1 {
+		t.Fatalf("expected deny to win over warn and keep the warning, got %+v", decision)
+	}
+}
+
+func TestEngagementPolicyFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if decision, err := evaluateEngagementPolicy(engagementTask{}); err != nil || decision.Action != engagementActionAllow {
+		t.Fatalf("expected no policy file to allow everything, got %+v %v", decision, err)
+	}
+	writeJSONFile(t, EngagementPolicyFilename, engagementPolicy{Rules: []engagementRule{{Name: "bad", Action: "block"}}})
+	decision, err := evaluateEngagementPolicy(engagementTask{})
+	if !errors.Is(err, engagementPolicyDeniedError) || decision.Action != engagementActionDeny {
+		t.Fatalf("expected an invalid policy to deny tasking, got %+v %v", decision, err)
+	}
+}
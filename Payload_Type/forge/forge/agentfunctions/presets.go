@@ -0,0 +1,536 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+// PresetsFilename has the saved argument presets for generated commands, shared by everyone in an operation
+const PresetsFilename = "forge_presets.json"
+
+const presetActionList = "list"
+const presetActionAdd = "add"
+const presetActionRemove = "remove"
+
+// presetParameterName is the parameter that picks a preset on generated commands, and presetGroup is the parameter
+// group it's in so the arguments a preset fills in don't have to be given
+const presetParameterName = "preset"
+const presetGroup = "Preset"
+
+var presetNotFoundError = errors.New("preset not found")
+var invalidPresetNameError = errors.New("preset names can only have letters, numbers, '.', '-', and '_'")
+
+// presetsMutex serializes reads and writes of the presets file between concurrent tasks
+var presetsMutex sync.Mutex
+
+// commandPreset is a named argument string for a generated command (ex: forge_net_Rubeus), in the same format as
+// the command's arguments are typed
+type commandPreset struct {
+	CommandName string    `json:"command_name"`
+	Name        string    `json:"name"`
+	Arguments   string    `json:"arguments"`
+	OperationID int       `json:"operation_id"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func readPresets() ([]commandPreset, error) {
+	presets := []commandPreset{}
+	presetBytes, err := os.ReadFile(PresetsFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return presets, nil
+	}
+	if err != nil {
+		return presets, err
+	}
+	if err = json.Unmarshal(presetBytes, &presets); err != nil {
+		return presets, fmt.Errorf("failed to parse %s: %w", PresetsFilename, err)
+	}
+	return presets, nil
+}
+
+func writePresets(presets []commandPreset) error {
+	presetBytes, err := json.MarshalIndent(presets, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(PresetsFilename, presetBytes, 0644)
+}
+
+func findPreset(presets []commandPreset, operationID int, commandName string, name string) int {
+	return slices.IndexFunc(presets, func(preset commandPreset) bool {
+		return preset.OperationID == operationID && preset.CommandName == commandName && preset.Name == name
+	})
+}
+
+// getOperationPresets returns the presets an operation has for commandName, or for every command when it's empty
+func getOperationPresets(operationID int, commandName string) ([]commandPreset, error) {
+	presetsMutex.Lock()
+	defer presetsMutex.Unlock()
+	presets, err := readPresets()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(presets, func(preset commandPreset) bool {
+		return preset.OperationID != operationID || (commandName != "" && preset.CommandName != commandName)
+	}), nil
+}
+
+func getPreset(operationID int, commandName string, name string) (commandPreset, error) {
+	presets, err := getOperationPresets(operationID, commandName)
+	if err != nil {
+		return commandPreset{}, err
+	}
+	i := findPreset(presets, operationID, commandName, name)
+	if i < 0 {
+		return commandPreset{}, fmt.Errorf("%w: %s has no preset named %s in this operation, see %s_presets", presetNotFoundError, commandName, name, PayloadTypeName)
+	}
+	return presets[i], nil
+}
+
+// savePreset adds a preset or replaces the operation's existing one with the same name
+func savePreset(preset commandPreset) error {
+	if !validCommandName.MatchString(preset.Name) {
+		return fmt.Errorf("%w: %s", invalidPresetNameError, preset.Name)
+	}
+	presetsMutex.Lock()
+	defer presetsMutex.Unlock()
+	presets, err := readPresets()
+	if err != nil {
+		return err
+	}
+	if i := findPreset(presets, preset.OperationID, preset.CommandName, preset.Name); i >= 0 {
+		presets[i] = preset
+	} else {
+		presets = append(presets, preset)
+	}
+	return writePresets(presets)
+}
+
+func removePreset(operationID int, commandName string, name string) error {
+	presetsMutex.Lock()
+	defer presetsMutex.Unlock()
+	presets, err := readPresets()
+	if err != nil {
+		return err
+	}
+	i := findPreset(presets, operationID, commandName, name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s has no preset named %s in this operation", presetNotFoundError, commandName, name)
+	}
+	return writePresets(slices.Delete(presets, i, i+1))
+}
+
+// callbackOperationID looks up a callback's operation for dynamic queries, which don't include it
+func callbackOperationID(callbackID int) (int, error) {
+	searchResponse, err := mythicrpc.SendMythicRPCCallbackSearch(mythicrpc.MythicRPCCallbackSearchMessage{
+		CallbackID:       callbackID,
+		SearchCallbackID: &callbackID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !searchResponse.Success {
+		return 0, errors.New(searchResponse.Error)
+	}
+	if len(searchResponse.Results) == 0 {
+		return 0, fmt.Errorf("failed to find callback %d", callbackID)
+	}
+	return searchResponse.Results[0].OperationID, nil
+}
+
+// presetOptions are the names of the presets the callback's operation has for the command being tasked
+func presetOptions(message agentstructs.PTRPCDynamicQueryFunctionMessage) []string {
+	operationID, err := callbackOperationID(message.Callback)
+	if err != nil {
+		logging.LogError(err, "failed to get the callback's operation for presets")
+		return []string{}
+	}
+	presets, err := getOperationPresets(operationID, message.Command)
+	if err != nil {
+		logging.LogError(err, "failed to read presets")
+		return []string{}
+	}
+	names := []string{}
+	for _, preset := range presets {
+		names = append(names, preset.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// presetParameter is the preset parameter added to generated commands in the preset parameter group
+func presetParameter() agentstructs.CommandParameter {
+	return agentstructs.CommandParameter{
+		Name:                 presetParameterName,
+		ParameterType:        agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE,
+		Description:          fmt.Sprintf("A saved set of arguments for this command, managed with %s_presets", PayloadTypeName),
+		ModalDisplayName:     "Preset",
+		DefaultValue:         "",
+		DynamicQueryFunction: presetOptions,
+		ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+			{
+				ParameterIsRequired: true,
+				GroupName:           presetGroup,
+				UIModalPosition:     0,
+			},
+		},
+	}
+}
+
+// withPresetGroup adds a parameter to the preset group as well as the default one, after the preset parameter
+func withPresetGroup(parameter agentstructs.CommandParameter) agentstructs.CommandParameter {
+	groups := []agentstructs.ParameterGroupInfo{}
+	for _, group := range parameter.ParameterGroupInformation {
+		groups = append(groups, group)
+		groups = append(groups, agentstructs.ParameterGroupInfo{
+			ParameterIsRequired: false,
+			GroupName:           presetGroup,
+			UIModalPosition:     group.UIModalPosition + 1,
+		})
+	}
+	parameter.ParameterGroupInformation = groups
+	return parameter
+}
+
+// withPreset adds the preset parameter to a generated command's parameters and puts the rest in the preset group
+func withPreset(parameters []agentstructs.CommandParameter) []agentstructs.CommandParameter {
+	presetParameters := []agentstructs.CommandParameter{presetParameter()}
+	for _, parameter := range parameters {
+		presetParameters = append(presetParameters, withPresetGroup(parameter))
+	}
+	return presetParameters
+}
+
+// presetArgumentString puts a preset's arguments for a command that takes an argument string in front of the
+// arguments given with the task, and removes the preset parameter before the task is passed on
+func presetArgumentString(taskData *agentstructs.PTTaskMessageAllData, commandName string, arguments string) (string, string, error) {
+	presetName, _ := taskData.Args.GetChooseOneArg(presetParameterName)
+	taskData.Args.RemoveArg(presetParameterName)
+	if presetName == "" {
+		return arguments, "", nil
+	}
+	preset, err := getPreset(taskData.Callback.OperationID, commandName, presetName)
+	if err != nil {
+		return arguments, presetName, err
+	}
+	return strings.TrimSpace(preset.Arguments + " " + arguments), presetName, nil
+}
+
+// bofArgumentOverridden checks if the task gave a value for a bof argument instead of leaving it to the preset.
+// Command lines only set the arguments that were typed, so anything there counts, even a 0. Mythic's modal (and other
+// dictionary tasking) sends every parameter, so there a value that's still the argument's default, or empty when it
+// doesn't have one, counts as not given.
+func bofArgumentOverridden(taskData *agentstructs.PTTaskMessageAllData, arg bofCommandDefinitionArguments) bool {
+	if !taskData.Args.IsArgUserSupplied(arg.Name) {
+		return false
+	}
+	if taskData.Args.GetTaskingLocation() == "command_line" {
+		return true
+	}
+	value, err := taskData.Args.GetArg(arg.Name)
+	if err != nil {
+		return false
+	}
+	if arg.Default != nil {
+		return fmt.Sprint(value) != fmt.Sprint(arg.Default)
+	}
+	switch typedValue := value.(type) {
+	case nil:
+		return false
+	case string:
+		return typedValue != ""
+	case float64:
+		return typedValue != 0
+	case int:
+		return typedValue != 0
+	default:
+		return true
+	}
+}
+
+// applyBofPreset fills in a generated bof command's arguments that the task didn't give from a preset, and removes
+// the preset parameter before the task is passed on
+func applyBofPreset(taskData *agentstructs.PTTaskMessageAllData, commandName string, arguments []bofCommandDefinitionArguments) (string, error) {
+	presetName, _ := taskData.Args.GetChooseOneArg(presetParameterName)
+	taskData.Args.RemoveArg(presetParameterName)
+	if presetName == "" {
+		return "", nil
+	}
+	preset, err := getPreset(taskData.Callback.OperationID, commandName, presetName)
+	if err != nil {
+		return presetName, err
+	}
+	words, err := splitCommandLine(preset.Arguments)
+	if err != nil {
+		return presetName, fmt.Errorf("%w: preset %s: %s", bofUsageError, presetName, err.Error())
+	}
+	values, err := parseBofArgWords(commandName, arguments, words, false)
+	if err != nil {
+		return presetName, fmt.Errorf("preset %s: %w", presetName, err)
+	}
+	for _, arg := range arguments {
+		if bofArgumentOverridden(taskData, arg) {
+			continue
+		}
+		if value, ok := values[arg.Name]; ok {
+			if err = taskData.Args.SetArgValue(arg.Name, value); err != nil {
+				return presetName, err
+			}
+			continue
+		}
+		if !arg.Optional {
+			return presetName, fmt.Errorf("%w: missing %s, it isn't in preset %s either\n%s", bofUsageError, arg.Name, presetName,
+				bofArgumentUsage(commandName, arguments))
+		}
+	}
+	return presetName, nil
+}
+
+// hasBofPreset reports if a generated bof command gets the preset parameter, which it doesn't when one of its own
+// arguments is already called preset
+func hasBofPreset(arguments []bofCommandDefinitionArguments) bool {
+	return !slices.ContainsFunc(arguments, func(arg bofCommandDefinitionArguments) bool {
+		return strings.EqualFold(arg.Name, presetParameterName)
+	})
+}
+
+// parseBofArgStringWithPreset is parseBofArgString that also takes -preset <name> anywhere before a --. When there's a
+// preset, required arguments can be left out since the preset fills them in.
+func parseBofArgStringWithPreset(commandName string, arguments []bofCommandDefinitionArguments, input string) (map[string]interface{}, error) {
+	if !hasBofPreset(arguments) {
+		return parseBofArgString(commandName, arguments, input)
+	}
+	words, err := splitCommandLine(input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s\n%s", bofUsageError, err.Error(), bofArgumentUsage(commandName, arguments))
+	}
+	presetName := ""
+	for i := 0; i+1 < len(words) && words[i] != "--"; i++ {
+		if strings.EqualFold(words[i], "-"+presetParameterName) {
+			presetName = words[i+1]
+			words = slices.Delete(words, i, i+2)
+			break
+		}
+	}
+	values, err := parseBofArgWords(commandName, arguments, words, presetName == "")
+	if err != nil {
+		return nil, err
+	}
+	if presetName != "" {
+		values[presetParameterName] = presetName
+	}
+	return values, nil
+}
+
+// forgeCommandOptions are the generated forge commands the callback's operation can task
+func forgeCommandOptions(message agentstructs.PTRPCDynamicQueryFunctionMessage) []string {
+	operationID, err := callbackOperationID(message.Callback)
+	if err != nil {
+		logging.LogError(err, "failed to get the callback's operation for commands")
+		return []string{}
+	}
+	commandNames := []string{}
+	for _, collectionSourceData := range getCollectionSources() {
+		for _, registeredCommand := range forgeRegistry.getRegisteredCommands(collectionSourceData.Name) {
+			if operationAllowed(registeredCommand.OperationIDs, operationID) {
+				commandNames = append(commandNames, registeredCommand.CommandName)
+			}
+		}
+	}
+	slices.Sort(commandNames)
+	return slices.Compact(commandNames)
+}
+
+func presetReport(preset commandPreset) string {
+	return fmt.Sprintf("%s %s: %s (by %s, %s)", preset.CommandName, preset.Name, preset.Arguments, preset.CreatedBy,
+		preset.CreatedAt.Format(time.RFC3339))
+}
+
+func init() {
+	agentstructs.AllPayloadData.Get(PayloadTypeName).AddCommand(agentstructs.Command{
+		Name:                fmt.Sprintf("%s_presets", PayloadTypeName),
+		Description:         "List, add, or remove saved argument presets for generated forge commands. Presets are shared with everyone in the operation.",
+		HelpString:          fmt.Sprintf("%s_presets -action add -commandName forge_net_Rubeus -name kerberoast -arguments \"kerberoast /nowrap\"", PayloadTypeName),
+		Version:             1,
+		Author:              "@its_a_feature_",
+		MitreAttackMappings: []string{},
+		SupportedUIFeatures: []string{},
+		ScriptOnlyCommand:   true,
+		CommandAttributes: agentstructs.CommandAttribute{
+			SupportedOS:      []string{agentstructs.SUPPORTED_OS_WINDOWS},
+			CommandIsBuiltin: true,
+		},
+		CommandParameters: []agentstructs.CommandParameter{
+			{
+				Name:             "action",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE,
+				Choices:          []string{presetActionList, presetActionAdd, presetActionRemove},
+				Description:      "List the operation's presets, add (or replace) one, or remove one",
+				ModalDisplayName: "Action",
+				DefaultValue:     presetActionList,
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     0,
+					},
+				},
+			},
+			{
+				Name:             "commandName",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_CHOOSE_ONE_CUSTOM,
+				Description:      "The generated command the preset is for (ex: forge_net_Rubeus)",
+				ModalDisplayName: "Command Name",
+				DefaultValue:     "",
+				DynamicQueryFunction: func(message agentstructs.PTRPCDynamicQueryFunctionMessage) []string {
+					return forgeCommandOptions(message)
+				},
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     1,
+					},
+				},
+			},
+			{
+				Name:             "name",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The name of the preset",
+				ModalDisplayName: "Preset Name",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     2,
+					},
+				},
+			},
+			{
+				Name:             "arguments",
+				ParameterType:    agentstructs.COMMAND_PARAMETER_TYPE_STRING,
+				Description:      "The arguments to save, typed the same way as they are for the command",
+				ModalDisplayName: "Arguments",
+				DefaultValue:     "",
+				ParameterGroupInformation: []agentstructs.ParameterGroupInfo{
+					{
+						ParameterIsRequired: false,
+						UIModalPosition:     3,
+					},
+				},
+			},
+		},
+		TaskFunctionCreateTasking: func(taskData *agentstructs.PTTaskMessageAllData) agentstructs.PTTaskCreateTaskingMessageResponse {
+			response := agentstructs.PTTaskCreateTaskingMessageResponse{
+				Success: true,
+				TaskID:  taskData.Task.ID,
+			}
+			action, err := taskData.Args.GetChooseOneArg("action")
+			if err != nil {
+				logging.LogError(err, "failed to get action")
+				response.Success = false
+				response.Error = err.Error()
+				return response
+			}
+			commandName, _ := taskData.Args.GetChooseOneArg("commandName")
+			name, _ := taskData.Args.GetStringArg("name")
+			arguments, _ := taskData.Args.GetStringArg("arguments")
+			displayParams := fmt.Sprintf("-action %s", action)
+			if commandName != "" {
+				displayParams += fmt.Sprintf(" -commandName %s", commandName)
+			}
+			if name != "" {
+				displayParams += fmt.Sprintf(" -name %s", name)
+			}
+			if arguments != "" {
+				displayParams += fmt.Sprintf(" -arguments \"%s\"", arguments)
+			}
+			response.DisplayParams = &displayParams
+			operationID := taskData.Callback.OperationID
+			if action == presetActionList {
+				presets, err := getOperationPresets(operationID, commandName)
+				if err != nil {
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				reports := []string{}
+				for _, preset := range presets {
+					reports = append(reports, presetReport(preset))
+				}
+				output := "No presets have been saved in this operation\n"
+				if len(reports) > 0 {
+					slices.Sort(reports)
+					output = strings.Join(reports, "\n") + "\n"
+				}
+				mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+					TaskID:   taskData.Task.ID,
+					Response: []byte(output),
+				})
+				return response
+			}
+			if commandName == "" || name == "" {
+				response.Success = false
+				response.Error = fmt.Sprintf("commandName and name are required to %s a preset", action)
+				return response
+			}
+			output := ""
+			if action == presetActionAdd {
+				registeredCommand, ok := forgeRegistry.findRegisteredCommand(commandName)
+				if !ok || !operationAllowed(registeredCommand.OperationIDs, operationID) {
+					response.Success = false
+					response.Error = fmt.Sprintf("%s isn't registered in this operation", commandName)
+					return response
+				}
+				preset := commandPreset{
+					CommandName: commandName,
+					Name:        name,
+					Arguments:   arguments,
+					OperationID: operationID,
+					CreatedBy:   taskData.Task.OperatorUsername,
+					CreatedAt:   time.Now().UTC(),
+				}
+				if err = savePreset(preset); err != nil {
+					logging.LogError(err, "failed to save preset")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				recordForgeChange(taskData, fmt.Sprintf("saved preset %s for %s", name, commandName))
+				output = fmt.Sprintf("Saved preset %s, use it with %s -%s %s\n", presetReport(preset), commandName, presetParameterName, name)
+			} else {
+				if err = removePreset(operationID, commandName, name); err != nil {
+					logging.LogError(err, "failed to remove preset")
+					response.Success = false
+					response.Error = err.Error()
+					return response
+				}
+				recordForgeChange(taskData, fmt.Sprintf("removed preset %s for %s", name, commandName))
+				output = fmt.Sprintf("Removed preset %s for %s\n", name, commandName)
+			}
+			mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+				TaskID:   taskData.Task.ID,
+				Response: []byte(output),
+			})
+			return response
+		},
+		TaskFunctionParseArgDictionary: func(args *agentstructs.PTTaskMessageArgsData, input map[string]interface{}) error {
+			return args.LoadArgsFromDictionary(input)
+		},
+		TaskFunctionParseArgString: func(args *agentstructs.PTTaskMessageArgsData, input string) error {
+			if len(input) > 0 {
+				return args.LoadArgsFromJSONString(input)
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,130 @@
+package agentfunctions
+
+import (
+	"errors"
+	"testing"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+)
+
+func TestPresetsAreScopedToOperations(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := savePreset(commandPreset{CommandName: "forge_net_Rubeus", Name: "kerberoast", Arguments: "kerberoast /nowrap", OperationID: 1}); err != nil {
+		t.Fatalf("failed to save preset: %v", err)
+	}
+	if err := savePreset(commandPreset{CommandName: "forge_net_Rubeus", Name: "kerberoast", Arguments: "kerberoast", OperationID: 2}); err != nil {
+		t.Fatalf("failed to save preset: %v", err)
+	}
+	if err := savePreset(commandPreset{CommandName: "forge_net_Rubeus", Name: "bad name", OperationID: 1}); !errors.Is(err, invalidPresetNameError) {
+		t.Fatalf("expected invalid name error, got %v", err)
+	}
+	preset, err := getPreset(1, "forge_net_Rubeus", "kerberoast")
+	if err != nil || preset.Arguments != "kerberoast /nowrap" {
+		t.Fatalf("expected operation 1's preset, got %v, %v", preset, err)
+	}
+	// saving again replaces the preset instead of adding another one
+	if err = savePreset(commandPreset{CommandName: "forge_net_Rubeus", Name: "kerberoast", Arguments: "kerberoast /outfile:x", OperationID: 1}); err != nil {
+		t.Fatalf("failed to replace preset: %v", err)
+	}
+	presets, err := getOperationPresets(1, "")
+	if err != nil || len(presets) != 1 || presets[0].Arguments != "kerberoast /outfile:x" {
+		t.Fatalf("expected the replaced preset, got %v, %v", presets, err)
+	}
+	if err = removePreset(1, "forge_net_Rubeus", "kerberoast"); err != nil {
+		t.Fatalf("failed to remove preset: %v", err)
+	}
+	if _, err = getPreset(1, "forge_net_Rubeus", "kerberoast"); !errors.Is(err, presetNotFoundError) {
+		t.Fatalf("expected removed preset to be gone, got %v", err)
+	}
+	if _, err = getPreset(2, "forge_net_Rubeus", "kerberoast"); err != nil {
+		t.Fatalf("expected operation 2's preset to be kept, got %v", err)
+	}
+}
+
+func TestParseBofArgStringWithPreset(t *testing.T) {
+	arguments := []bofCommandDefinitionArguments{
+		{Name: "target", Type: "z"},
+		{Name: "port", Type: "i"},
+	}
+	values, err := parseBofArgStringWithPreset("forge_bof_test", arguments, "-preset dc -port 445")
+	if err != nil {
+		t.Fatalf("expected a preset to allow missing arguments, got %v", err)
+	}
+	if values[presetParameterName] != "dc" || values["port"] != float64(445) || len(values) != 2 {
+		t.Fatalf("unexpected values %v", values)
+	}
+	if _, err = parseBofArgStringWithPreset("forge_bof_test", arguments, "445"); !errors.Is(err, bofUsageError) {
+		t.Fatalf("expected missing arguments to fail without a preset, got %v", err)
+	}
+	values, err = parseBofArgStringWithPreset("forge_bof_test", arguments, "-port 445 -- -preset")
+	if err != nil || values["target"] != "-preset" || values[presetParameterName] != nil {
+		t.Fatalf("expected -preset after -- to be positional, got %v, %v", values, err)
+	}
+}
+
+func TestApplyBofPreset(t *testing.T) {
+	t.Chdir(t.TempDir())
+	arguments := []bofCommandDefinitionArguments{
+		{Name: "target", Type: "z"},
+		{Name: "port", Type: "i"},
+		{Name: "verbose", Type: "i", Optional: true},
+	}
+	if err := savePreset(commandPreset{CommandName: "forge_bof_test", Name: "dc", Arguments: "dc01 389", OperationID: 1}); err != nil {
+		t.Fatalf("failed to save preset: %v", err)
+	}
+	parameters := []agentstructs.CommandParameter{}
+	for _, arg := range arguments {
+		parameters = append(parameters, agentstructs.CommandParameter{Name: arg.Name, ParameterType: agentstructs.COMMAND_PARAMETER_TYPE_STRING})
+	}
+	parameters[1].ParameterType = agentstructs.COMMAND_PARAMETER_TYPE_NUMBER
+	parameters[2].ParameterType = agentstructs.COMMAND_PARAMETER_TYPE_NUMBER
+	taskData := &agentstructs.PTTaskMessageAllData{}
+	taskData.Callback.OperationID = 1
+	args, err := agentstructs.GenerateArgsData(withPreset(parameters), *taskData)
+	if err != nil {
+		t.Fatalf("failed to generate args: %v", err)
+	}
+	taskData.Args = args
+	// the modal sends every parameter, so the empty target should still come from the preset
+	if err = taskData.Args.LoadArgsFromDictionary(map[string]interface{}{presetParameterName: "dc", "target": "", "port": float64(636)}); err != nil {
+		t.Fatalf("failed to load args: %v", err)
+	}
+	presetName, err := applyBofPreset(taskData, "forge_bof_test", arguments)
+	if err != nil || presetName != "dc" {
+		t.Fatalf("expected preset to apply, got %s, %v", presetName, err)
+	}
+	if target, _ := taskData.Args.GetStringArg("target"); target != "dc01" {
+		t.Fatalf("expected target from the preset, got %s", target)
+	}
+	if port, _ := taskData.Args.GetNumberArg("port"); port != 636 {
+		t.Fatalf("expected the task's port to override the preset, got %v", port)
+	}
+	if taskData.Args.HasArg(presetParameterName) {
+		t.Fatalf("expected the preset parameter to be removed")
+	}
+
+	// an explicit 0 on the command line overrides the preset, whether it's named or positional
+	taskData.Task.TaskingLocation = "command_line"
+	for _, input := range []string{"-preset dc -port 0", "-preset dc dc02 0"} {
+		taskData.Args, _ = agentstructs.GenerateArgsData(withPreset(parameters), *taskData)
+		values, err := parseBofArgStringWithPreset("forge_bof_test", arguments, input)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %v", input, err)
+		}
+		taskData.Args.LoadArgsFromDictionary(values)
+		if _, err = applyBofPreset(taskData, "forge_bof_test", arguments); err != nil {
+			t.Fatalf("%s: expected preset to apply, got %v", input, err)
+		}
+		if port, _ := taskData.Args.GetNumberArg("port"); port != 0 {
+			t.Fatalf("%s: expected the explicit 0 to override the preset, got %v", input, port)
+		}
+	}
+	taskData.Task.TaskingLocation = ""
+
+	taskData.Callback.OperationID = 2
+	taskData.Args, _ = agentstructs.GenerateArgsData(withPreset(parameters), *taskData)
+	taskData.Args.LoadArgsFromDictionary(map[string]interface{}{presetParameterName: "dc"})
+	if _, err = applyBofPreset(taskData, "forge_bof_test", arguments); !errors.Is(err, presetNotFoundError) {
+		t.Fatalf("expected another operation's preset to be missing, got %v", err)
+	}
+}
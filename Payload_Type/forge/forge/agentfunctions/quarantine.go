@@ -0,0 +1,478 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/pe"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+// QuarantineFilename tracks tools that are waiting for approval along with the files that were last approved
+const QuarantineFilename = "forge_quarantine.json"
+
+const quarantineStatusPending = "pending"
+const quarantineStatusApproved = "approved"
+
+const signatureStatusSigned = "signed (authenticode present, not verified)"
+const signatureStatusUnsigned = "unsigned"
+const signatureStatusInvalidPE = "not a valid PE file"
+const signatureStatusNotApplicable = "n/a"
+
+var toolPendingApprovalError = errors.New("tool is pending approval")
+var quarantineEntryNotFoundError = errors.New("no quarantine entry for that tool")
+
+// quarantineMutex serializes reads and writes of the quarantine file between concurrent tasks
+var quarantineMutex sync.Mutex
+
+type quarantineFile struct {
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	Signature string `json:"signature"`
+}
+
+// quarantineEntry is a downloaded or uploaded tool. Files is what's on disk now, ApprovedFiles is what was on disk the
+// last time it was approved, and MythicFileIDs are files uploaded to Mythic for it (ex: from forge_create).
+type quarantineEntry struct {
+	Collection    string           `json:"collection"`
+	Name          string           `json:"name"`
+	Type          string           `json:"type"`
+	Status        string           `json:"status"`
+	Files         []quarantineFile `json:"files"`
+	ApprovedFiles []quarantineFile `json:"approved_files,omitempty"`
+	MythicFileIDs []string         `json:"mythic_file_ids,omitempty"`
+	OperationID   int              `json:"operation_id"`
+	RequestedBy   string           `json:"requested_by"`
+	RequestedAt   time.Time        `json:"requested_at"`
+	ApprovedBy    string           `json:"approved_by,omitempty"`
+	ApprovedAt    *time.Time       `json:"approved_at,omitempty"`
+}
+
+// toolApprovalRequired reports if new or updated tools have to be approved before they can be used
+func toolApprovalRequired() bool {
+	policy, err := getAccessPolicy()
+	if err != nil {
+		// an unreadable policy denies management actions, so err on the side of quarantining too
+		return true
+	}
+	return policy.RequireToolApproval
+}
+
+func readQuarantineEntries() ([]quarantineEntry, error) {
+	entries := []quarantineEntry{}
+	entryBytes, err := os.ReadFile(QuarantineFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return entries, err
+	}
+	if err = json.Unmarshal(entryBytes, &entries); err != nil {
+		return entries, fmt.Errorf("failed to parse %s: %w", QuarantineFilename, err)
+	}
+	return entries, nil
+}
+
+func writeQuarantineEntries(entries []quarantineEntry) error {
+	entryBytes, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(QuarantineFilename, entryBytes, 0644)
+}
+
+func findQuarantineEntry(entries []quarantineEntry, collectionName string, name string) int {
+	return slices.IndexFunc(entries, func(entry quarantineEntry) bool {
+		return entry.Collection == collectionName && entry.Name == name
+	})
+}
+
+func getQuarantineEntry(collectionName string, name string) (quarantineEntry, bool) {
+	quarantineMutex.Lock()
+	defer quarantineMutex.Unlock()
+	entries, err := readQuarantineEntries()
+	if err != nil {
+		logging.LogError(err, "failed to read quarantine file")
+		return quarantineEntry{}, false
+	}
+	if i := findQuarantineEntry(entries, collectionName, name); i >= 0 {
+		return entries[i], true
+	}
+	return quarantineEntry{}, false
+}
+
+// checkToolApproval stops a tool from being tasked while its files are waiting for approval
+func checkToolApproval(collectionName string, name string) error {
+	entry, ok := getQuarantineEntry(collectionName, name)
+	if !ok || entry.Status != quarantineStatusPending {
+		return nil
+	}
+	return fmt.Errorf("%w: %s/%s, use %s_approve to approve or reject it", toolPendingApprovalError, collectionName, name, PayloadTypeName)
+}
+
+func collectionFolder(collectionSourceData collectionSource) string {
+	return filepath.Join(".", PayloadTypeName, "collections", collectionSourceData.Name)
+}
+
+// toolFilePaths lists the files on disk for a tool relative to its collection's folder
+func toolFilePaths(commandSource collectionSourceCommandData, collectionSourceData collectionSource) ([]string, error) {
+	root := collectionFolder(collectionSourceData)
+	paths := []string{}
+	switch collectionSourceData.Type {
+	case "assembly":
+		versions := slices.Clone(assemblyVersions)
+		if commandSource.CustomVersion != "" && !slices.Contains(versions, commandSource.CustomVersion) {
+			versions = append(versions, commandSource.CustomVersion)
+		}
+		for _, version := range versions {
+			relativePath := filepath.Join(version, commandSource.Name+".exe")
+			if _, err := os.Stat(filepath.Join(root, relativePath)); err == nil {
+				paths = append(paths, relativePath)
+			}
+		}
+	case "bof":
+		commandFolder := filepath.Join(root, commandSource.CommandName)
+		err := filepath.WalkDir(commandFolder, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.Type().IsRegular() {
+				relativePath, err := filepath.Rel(root, filePath)
+				if err != nil {
+					return err
+				}
+				paths = append(paths, relativePath)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+func fileSignatureStatus(filename string, contents []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".exe", ".dll":
+	default:
+		return signatureStatusNotApplicable
+	}
+	peFile, err := pe.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return signatureStatusInvalidPE
+	}
+	defer peFile.Close()
+	var securityDirectory pe.DataDirectory
+	switch optionalHeader := peFile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if optionalHeader.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			securityDirectory = optionalHeader.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		}
+	case *pe.OptionalHeader64:
+		if optionalHeader.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			securityDirectory = optionalHeader.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		}
+	default:
+		return signatureStatusInvalidPE
+	}
+	if securityDirectory.VirtualAddress != 0 && securityDirectory.Size != 0 {
+		return signatureStatusSigned
+	}
+	return signatureStatusUnsigned
+}
+
+func scanQuarantineFile(root string, relativePath string) (quarantineFile, error) {
+	// hashes are of the plaintext so they don't change when stored files are encrypted
+	contents, err := readStoredFile(filepath.Join(root, relativePath))
+	if err != nil {
+		return quarantineFile{}, err
+	}
+	hash := sha256.Sum256(contents)
+	return quarantineFile{
+		Path:      filepath.ToSlash(relativePath),
+		SHA256:    hex.EncodeToString(hash[:]),
+		Size:      int64(len(contents)),
+		Signature: fileSignatureStatus(relativePath, contents),
+	}, nil
+}
+
+func scanToolFiles(commandSource collectionSourceCommandData, collectionSourceData collectionSource) ([]quarantineFile, error) {
+	paths, err := toolFilePaths(commandSource, collectionSourceData)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]quarantineFile, 0, len(paths))
+	for _, relativePath := range paths {
+		file, err := scanQuarantineFile(collectionFolder(collectionSourceData), relativePath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// diffQuarantineFiles describes what changed between the approved files and the current ones
+func diffQuarantineFiles(previous []quarantineFile, current []quarantineFile) []string {
+	changes := []string{}
+	for _, file := range current {
+		i := slices.IndexFunc(previous, func(previousFile quarantineFile) bool { return previousFile.Path == file.Path })
+		if i < 0 {
+			changes = append(changes, fmt.Sprintf("+ %s (added)", file.Path))
+		} else if previous[i].SHA256 != file.SHA256 {
+			changes = append(changes, fmt.Sprintf("~ %s (%s, %d bytes -> %s, %d bytes)", file.Path,
+				previous[i].SHA256, previous[i].Size, file.SHA256, file.Size))
+		}
+	}
+	for _, file := range previous {
+		if !slices.ContainsFunc(current, func(currentFile quarantineFile) bool { return currentFile.Path == file.Path }) {
+			changes = append(changes, fmt.Sprintf("- %s (removed)", file.Path))
+		}
+	}
+	return changes
+}
+
+func quarantineReport(entry quarantineEntry) string {
+	report := strings.Builder{}
+	report.WriteString(fmt.Sprintf("[!] %s/%s is %s\n", entry.Collection, entry.Name, entry.Status))
+	for _, file := range entry.Files {
+		report.WriteString(fmt.Sprintf("%s\n\tSHA256: %s\n\tSize: %d bytes\n\tSignature: %s\n", file.Path, file.SHA256, file.Size, file.Signature))
+	}
+	if entry.Status == quarantineStatusPending {
+		if entry.ApprovedFiles == nil {
+			report.WriteString("No previously approved version\n")
+		} else if changes := diffQuarantineFiles(entry.ApprovedFiles, entry.Files); len(changes) == 0 {
+			report.WriteString("No changes from the approved version\n")
+		} else {
+			report.WriteString(fmt.Sprintf("Changes from the approved version:\n\t%s\n", strings.Join(changes, "\n\t")))
+		}
+		report.WriteString(fmt.Sprintf("Use %s_approve -action approve -collectionName %s -commandName %s to allow it, or -action reject to delete it\n",
+			PayloadTypeName, entry.Collection, entry.Name))
+	}
+	return report.String()
+}
+
+// quarantineTool marks a tool's current files as pending approval and returns the report to show the operator
+func quarantineTool(taskData *agentstructs.PTTaskMessageAllData, commandSource collectionSourceCommandData, collectionSourceData collectionSource,
+	operationID int, mythicFileIDs []string) (string, error) {
+	files, err := scanToolFiles(commandSource, collectionSourceData)
+	if err != nil {
+		return "", err
+	}
+	quarantineMutex.Lock()
+	defer quarantineMutex.Unlock()
+	entries, err := readQuarantineEntries()
+	if err != nil {
+		return "", err
+	}
+	entry := quarantineEntry{
+		Collection: collectionSourceData.Name,
+		Name:       commandSource.Name,
+		Type:       collectionSourceData.Type,
+	}
+	i := findQuarantineEntry(entries, entry.Collection, entry.Name)
+	if i >= 0 {
+		entry = entries[i]
+	}
+	entry.Status = quarantineStatusPending
+	entry.Files = files
+	entry.MythicFileIDs = append(entry.MythicFileIDs, mythicFileIDs...)
+	entry.OperationID = operationID
+	entry.RequestedAt = time.Now().UTC()
+	if taskData != nil {
+		entry.RequestedBy = taskData.Task.OperatorUsername
+	}
+	if i >= 0 {
+		entries[i] = entry
+	} else {
+		entries = append(entries, entry)
+	}
+	if err = writeQuarantineEntries(entries); err != nil {
+		return "", err
+	}
+	if taskData != nil {
+		recordForgeChange(taskData, fmt.Sprintf("quarantined %s/%s pending approval", entry.Collection, entry.Name))
+	}
+	return quarantineReport(entry), nil
+}
+
+// approvedCopyFolder keeps a copy of every approved tool's files, so rejecting an update that was downloaded over them
+// can put the approved version back
+func approvedCopyFolder(collectionName string) string {
+	return filepath.Join(".", PayloadTypeName, "approved", collectionName)
+}
+
+// copyToolFiles copies a tool's files between collection folders exactly as they're stored on disk
+func copyToolFiles(sourceRoot string, destinationRoot string, files []quarantineFile) error {
+	for _, file := range files {
+		relativePath := filepath.FromSlash(file.Path)
+		contents, err := os.ReadFile(filepath.Join(sourceRoot, relativePath))
+		if err != nil {
+			return err
+		}
+		destination := filepath.Join(destinationRoot, relativePath)
+		if err = os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+			return err
+		}
+		if err = os.WriteFile(destination, contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeToolFiles(root string, files []quarantineFile) error {
+	for _, file := range files {
+		if err := os.Remove(filepath.Join(root, filepath.FromSlash(file.Path))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasApprovedCopy checks that every approved file has a copy to restore (tools approved before copies were kept don't)
+func hasApprovedCopy(entry quarantineEntry) bool {
+	if len(entry.ApprovedFiles) == 0 {
+		return false
+	}
+	for _, file := range entry.ApprovedFiles {
+		if _, err := os.Stat(filepath.Join(approvedCopyFolder(entry.Collection), filepath.FromSlash(file.Path))); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// approveQuarantinedTool records the pending files as the approved version and keeps a copy of them
+func approveQuarantinedTool(collectionName string, name string, approver string) (quarantineEntry, error) {
+	quarantineMutex.Lock()
+	defer quarantineMutex.Unlock()
+	entries, err := readQuarantineEntries()
+	if err != nil {
+		return quarantineEntry{}, err
+	}
+	i := findQuarantineEntry(entries, collectionName, name)
+	if i < 0 || entries[i].Status != quarantineStatusPending {
+		return quarantineEntry{}, quarantineEntryNotFoundError
+	}
+	copyRoot := approvedCopyFolder(collectionName)
+	if err = removeToolFiles(copyRoot, entries[i].ApprovedFiles); err != nil {
+		return entries[i], err
+	}
+	if err = copyToolFiles(collectionFolder(collectionSource{Name: collectionName}), copyRoot, entries[i].Files); err != nil {
+		return entries[i], fmt.Errorf("failed to keep a copy of the approved files: %w", err)
+	}
+	now := time.Now().UTC()
+	entries[i].Status = quarantineStatusApproved
+	entries[i].ApprovedFiles = entries[i].Files
+	entries[i].ApprovedBy = approver
+	entries[i].ApprovedAt = &now
+	entries[i].MythicFileIDs = nil
+	return entries[i], writeQuarantineEntries(entries)
+}
+
+// rejectQuarantinedTool deletes a pending tool's files from disk and Mythic. If there's an approved version, its files
+// are restored and it stays approved, otherwise the tool is forgotten about.
+func rejectQuarantinedTool(taskID int, commandSource collectionSourceCommandData, collectionSourceData collectionSource) (quarantineEntry, error) {
+	quarantineMutex.Lock()
+	defer quarantineMutex.Unlock()
+	entries, err := readQuarantineEntries()
+	if err != nil {
+		return quarantineEntry{}, err
+	}
+	i := findQuarantineEntry(entries, collectionSourceData.Name, commandSource.Name)
+	if i < 0 || entries[i].Status != quarantineStatusPending {
+		return quarantineEntry{}, quarantineEntryNotFoundError
+	}
+	entry := entries[i]
+	root := collectionFolder(collectionSourceData)
+	if err = removeToolFiles(root, entry.Files); err != nil {
+		return entry, err
+	}
+	if collectionSourceData.Type == "bof" {
+		if err = os.RemoveAll(filepath.Join(root, commandSource.CommandName)); err != nil {
+			return entry, err
+		}
+	}
+	restore := hasApprovedCopy(entry)
+	if restore {
+		if err = copyToolFiles(approvedCopyFolder(entry.Collection), root, entry.ApprovedFiles); err != nil {
+			return entry, fmt.Errorf("failed to restore the approved version: %w", err)
+		}
+	}
+	if collectionSourceData.Type == "bof" {
+		forgeRegistry.invalidateBofDefinitions(collectionSourceData.Name, commandSource.CommandName)
+	}
+	deleteMythicFiles(entry.MythicFileIDs)
+	if restore {
+		entries[i].Status = quarantineStatusApproved
+		entries[i].Files = entry.ApprovedFiles
+		entries[i].MythicFileIDs = nil
+		return entries[i], writeQuarantineEntries(entries)
+	}
+	entries = append(entries[:i], entries[i+1:]...)
+	return entry, writeQuarantineEntries(entries)
+}
+
+// deleteMythicFiles removes a rejected tool's files from Mythic's file storage. Only the files uploaded for the pending
+// version are deleted, other tools can have files with the same names (ex: extension.json).
+func deleteMythicFiles(agentFileIDs []string) {
+	for _, agentFileID := range agentFileIDs {
+		_, err := mythicrpc.SendMythicRPCFileUpdate(mythicrpc.MythicRPCFileUpdateMessage{
+			AgentFileID: agentFileID,
+			Delete:      true,
+		})
+		if err != nil {
+			logging.LogError(err, "failed to send file delete request to Mythic")
+		}
+	}
+}
+
+// quarantineIfRequired quarantines a freshly downloaded or uploaded tool when approval is required, sending the
+// report to the task. It returns true if the tool is now pending and shouldn't be registered.
+func quarantineIfRequired(taskData *agentstructs.PTTaskMessageAllData, commandSource collectionSourceCommandData, collectionSourceData collectionSource,
+	operationID int, mythicFileIDs []string) (bool, error) {
+	if !toolApprovalRequired() {
+		return false, nil
+	}
+	report, err := quarantineTool(taskData, commandSource, collectionSourceData, operationID, mythicFileIDs)
+	if err != nil {
+		logging.LogError(err, "failed to quarantine tool")
+		return false, err
+	}
+	mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+		TaskID:   taskData.Task.ID,
+		Response: []byte(report),
+	})
+	return true, nil
+}
+
+// quarantineTaskDownload is for files that a command downloads on demand when it's tasked. The files are scanned like
+// any other download, and the task fails if they need to be approved first.
+func quarantineTaskDownload(taskData *agentstructs.PTTaskMessageAllData, commandSource collectionSourceCommandData, collectionSourceData collectionSource) error {
+	scanDownloadedTool(taskData, commandSource, collectionSourceData)
+	quarantined, err := quarantineIfRequired(taskData, commandSource, collectionSourceData, taskOperationID(taskData, false), nil)
+	if err != nil {
+		return err
+	}
+	if quarantined {
+		return fmt.Errorf("%w: %s/%s was downloaded and needs to be approved before it can run", toolPendingApprovalError,
+			collectionSourceData.Name, commandSource.Name)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package agentfunctions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuarantineToolLifecycle(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	objectPath := filepath.Join(".", PayloadTypeName, "collections", "Bench", "bof-0", "bof-0.x64.o")
+	os.WriteFile(objectPath, []byte("object"), 0644)
+
+	report, err := quarantineTool(nil, commandSource, source, 3, []string{"file-id"})
+	if err != nil {
+		t.Fatalf("failed to quarantine tool: %v", err)
+	}
+	if !strings.Contains(report, "bof-0/bof-0.x64.o") || !strings.Contains(report, "No previously approved version") {
+		t.Fatalf("expected report to list files for a new tool, got %s", report)
+	}
+	if err = checkToolApproval("Bench", "bof-0"); !errors.Is(err, toolPendingApprovalError) {
+		t.Fatalf("expected pending tool to be blocked, got %v", err)
+	}
+	entry, err := approveQuarantinedTool("Bench", "bof-0", "lead")
+	if err != nil || entry.OperationID != 3 || entry.ApprovedBy != "lead" || len(entry.ApprovedFiles) != 2 {
+		t.Fatalf("unexpected approved entry %+v: %v", entry, err)
+	}
+	if err = checkToolApproval("Bench", "bof-0"); err != nil {
+		t.Fatalf("expected approved tool to be allowed, got %v", err)
+	}
+	if _, err = approveQuarantinedTool("Bench", "bof-0", "lead"); !errors.Is(err, quarantineEntryNotFoundError) {
+		t.Fatalf("expected approving twice to fail, got %v", err)
+	}
+
+	os.WriteFile(objectPath, []byte("updated object"), 0644)
+	os.WriteFile(filepath.Join(filepath.Dir(objectPath), "bof-0.x86.o"), []byte("x86"), 0644)
+	report, err = quarantineTool(nil, commandSource, source, 3, nil)
+	if err != nil {
+		t.Fatalf("failed to quarantine update: %v", err)
+	}
+	if !strings.Contains(report, "~ bof-0/bof-0.x64.o") || !strings.Contains(report, "+ bof-0/bof-0.x86.o") {
+		t.Fatalf("expected report to diff against the approved version, got %s", report)
+	}
+
+	// rejecting the update puts the approved version back instead of deleting it
+	entry, err = rejectQuarantinedTool(0, commandSource, source)
+	if err != nil || entry.Status != quarantineStatusApproved {
+		t.Fatalf("expected the approved version to be restored, got %+v: %v", entry, err)
+	}
+	if contents, _ := os.ReadFile(objectPath); string(contents) != "object" {
+		t.Fatalf("expected the approved object file, got %q", contents)
+	}
+	if _, err = os.Stat(filepath.Join(filepath.Dir(objectPath), "bof-0.x86.o")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the pending x86 object to be deleted, got %v", err)
+	}
+	if err = checkToolApproval("Bench", "bof-0"); err != nil {
+		t.Fatalf("expected the restored tool to be allowed, got %v", err)
+	}
+}
+
+func TestRejectNewTool(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	commandFolder := filepath.Join(".", PayloadTypeName, "collections", "Bench", "bof-0")
+	os.WriteFile(filepath.Join(commandFolder, "bof-0.x64.o"), []byte("object"), 0644)
+	if _, err := quarantineTool(nil, commandSource, source, 3, nil); err != nil {
+		t.Fatalf("failed to quarantine tool: %v", err)
+	}
+	if _, err := rejectQuarantinedTool(0, commandSource, source); err != nil {
+		t.Fatalf("failed to reject tool: %v", err)
+	}
+	if _, err := os.Stat(commandFolder); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a rejected new tool's files to be deleted, got %v", err)
+	}
+	if _, ok := getQuarantineEntry("Bench", "bof-0"); ok {
+		t.Fatalf("expected a rejected new tool to be forgotten")
+	}
+}
+
+func TestFileSignatureStatus(t *testing.T) {
+	if status := fileSignatureStatus("whoami.x64.o", []byte("object")); status != signatureStatusNotApplicable {
+		t.Fatalf("expected object files to not have signatures, got %q", status)
+	}
+	if status := fileSignatureStatus("4.7_Any/Rubeus.exe", []byte("MZ not really")); status != signatureStatusInvalidPE {
+		t.Fatalf("expected invalid PE status, got %q", status)
+	}
+}
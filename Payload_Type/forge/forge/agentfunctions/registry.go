@@ -0,0 +1,252 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+// registeredCollectionCommand is the shared shape of assemblyCommand and bofCommand entries within a *_commands.json file
+type registeredCollectionCommand struct {
+	CommandName           string `json:"command_name"`
+	CollectionType        string `json:"collection_type"`
+	CollectionCommandName string `json:"collection_command_name"`
+	OperationIDs          []int  `json:"operation_ids,omitempty"`
+}
+
+type bofDefinitionCacheEntry struct {
+	definitions []bofCommandDefinition
+	err         error
+}
+
+type bofImportsCacheEntry struct {
+	imports map[string][]string
+	err     error
+}
+
+// commandRegistry is an in-memory index of collection_sources.json and every collection's *_sources.json and
+// *_commands.json files. It's built the first time it's needed and thrown away whenever forge writes one of those
+// files, so the next read rebuilds it. Parsed extension.json files are cached separately and only dropped when the
+// files for that specific command change on disk.
+type commandRegistry struct {
+	mutex              sync.RWMutex
+	loaded             bool
+	sources            []collectionSource
+	sourceIndex        map[string]int
+	sourceCommands     map[string][]collectionSourceCommandData
+	sourceCommandIndex map[string]map[string]int
+	registeredCommands map[string][]registeredCollectionCommand
+	registeredIndex    map[string]registeredCollectionCommand
+	mitreCatalog       mitreCatalog
+	bofMutex           sync.RWMutex
+	bofDefinitions     map[string]bofDefinitionCacheEntry
+	bofImports         map[string]bofImportsCacheEntry
+}
+
+var forgeRegistry = newCommandRegistry()
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{
+		bofDefinitions: make(map[string]bofDefinitionCacheEntry),
+		bofImports:     make(map[string]bofImportsCacheEntry),
+	}
+}
+
+func (r *commandRegistry) ensureLoaded() {
+	r.mutex.RLock()
+	loaded := r.loaded
+	r.mutex.RUnlock()
+	if loaded {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.loaded {
+		return
+	}
+	r.load()
+}
+
+// load reads all the collection files from disk, must be called with r.mutex held for writing
+func (r *commandRegistry) load() {
+	r.sources = []collectionSource{}
+	r.sourceIndex = make(map[string]int)
+	r.sourceCommands = make(map[string][]collectionSourceCommandData)
+	r.sourceCommandIndex = make(map[string]map[string]int)
+	r.registeredCommands = make(map[string][]registeredCollectionCommand)
+	r.registeredIndex = make(map[string]registeredCollectionCommand)
+	r.loaded = true
+	catalog, err := readMitreCatalog()
+	if err != nil {
+		logging.LogError(err, "failed to read mitre catalog")
+	}
+	r.mitreCatalog = catalog
+	collectionFile, err := getOrCreateFile(CollectionSources)
+	if err != nil {
+		logging.LogError(err, "Failed to read collection sources file")
+		return
+	}
+	err = json.Unmarshal(collectionFile, &r.sources)
+	if err != nil {
+		logging.LogError(err, "failed to parse collection sources")
+		r.sources = []collectionSource{}
+		return
+	}
+	for i := range r.sources {
+		r.sources[i].SourceFilename = fmt.Sprintf("%s_sources.json", r.sources[i].Name)
+		r.sources[i].CommandsFilename = fmt.Sprintf("%s_commands.json", r.sources[i].Name)
+		r.sourceIndex[r.sources[i].Name] = i
+		sourceCommandFile, err := getOrCreateFile(r.sources[i].SourceFilename)
+		if err != nil {
+			logging.LogError(err, "Failed to read collection source file", "collection", r.sources[i].Name)
+			continue
+		}
+		sourceCommands := []collectionSourceCommandData{}
+		err = json.Unmarshal(sourceCommandFile, &sourceCommands)
+		if err != nil {
+			logging.LogError(err, "failed to parse collection source file", "collection", r.sources[i].Name)
+			continue
+		}
+		commandIndex := make(map[string]int, len(sourceCommands))
+		for j := range sourceCommands {
+			commandIndex[sourceCommands[j].Name] = j
+		}
+		r.sourceCommands[r.sources[i].Name] = sourceCommands
+		r.sourceCommandIndex[r.sources[i].Name] = commandIndex
+		commandsFile, err := getOrCreateFile(r.sources[i].CommandsFilename)
+		if err != nil {
+			logging.LogError(err, "Failed to read commands file", "collection", r.sources[i].Name)
+			continue
+		}
+		registeredCommands := []registeredCollectionCommand{}
+		err = json.Unmarshal(commandsFile, &registeredCommands)
+		if err != nil {
+			logging.LogError(err, "failed to parse commands file", "collection", r.sources[i].Name)
+			continue
+		}
+		r.registeredCommands[r.sources[i].Name] = registeredCommands
+		for _, registeredCommand := range registeredCommands {
+			r.registeredIndex[registeredCommand.CommandName] = registeredCommand
+		}
+	}
+}
+
+func (r *commandRegistry) getMitreMappings(collectionName string, names ...string) []string {
+	r.ensureLoaded()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.mitreCatalog.lookup(collectionName, names...)
+}
+
+// invalidate drops the collection index so the next read rebuilds it from disk
+func (r *commandRegistry) invalidate() {
+	r.mutex.Lock()
+	r.loaded = false
+	r.mutex.Unlock()
+}
+
+func (r *commandRegistry) getCollectionSources() []collectionSource {
+	r.ensureLoaded()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]collectionSource{}, r.sources...)
+}
+
+func (r *commandRegistry) getCollectionSource(name string) (collectionSource, bool) {
+	r.ensureLoaded()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if i, ok := r.sourceIndex[name]; ok {
+		return r.sources[i], true
+	}
+	return collectionSource{}, false
+}
+
+func (r *commandRegistry) getSourceCommands(collectionName string) []collectionSourceCommandData {
+	r.ensureLoaded()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]collectionSourceCommandData{}, r.sourceCommands[collectionName]...)
+}
+
+// findSourceCommand looks up a collection's source entry by its "name" field
+func (r *commandRegistry) findSourceCommand(collectionName string, name string) (collectionSourceCommandData, bool) {
+	r.ensureLoaded()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if i, ok := r.sourceCommandIndex[collectionName][name]; ok {
+		return r.sourceCommands[collectionName][i], true
+	}
+	return collectionSourceCommandData{}, false
+}
+
+func (r *commandRegistry) getRegisteredCommands(collectionName string) []registeredCollectionCommand {
+	r.ensureLoaded()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]registeredCollectionCommand{}, r.registeredCommands[collectionName]...)
+}
+
+// findRegisteredCommand looks up a registration by its full forge command name (ex: forge_net_Rubeus)
+func (r *commandRegistry) findRegisteredCommand(commandName string) (registeredCollectionCommand, bool) {
+	r.ensureLoaded()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	registeredCommand, ok := r.registeredIndex[commandName]
+	return registeredCommand, ok
+}
+
+func bofDefinitionCacheKey(collectionName string, commandName string) string {
+	return filepath.Join(collectionName, commandName)
+}
+
+// getBofCommandDefinitions returns the parsed extension.json for a command, only reading it from disk the first time
+func (r *commandRegistry) getBofCommandDefinitions(commandSource collectionSourceCommandData, collectionSourceData collectionSource) ([]bofCommandDefinition, error) {
+	key := bofDefinitionCacheKey(collectionSourceData.Name, commandSource.CommandName)
+	r.bofMutex.RLock()
+	entry, ok := r.bofDefinitions[key]
+	r.bofMutex.RUnlock()
+	if ok {
+		return entry.definitions, entry.err
+	}
+	definitions, err := readBofCommandDefinitions(commandSource, collectionSourceData)
+	r.bofMutex.Lock()
+	r.bofDefinitions[key] = bofDefinitionCacheEntry{definitions: definitions, err: err}
+	r.bofMutex.Unlock()
+	return definitions, err
+}
+
+// getBofImports returns the functions each architecture of a bof imports, only parsing the object files the first time
+func (r *commandRegistry) getBofImports(commandSource collectionSourceCommandData, collectionSourceData collectionSource) (map[string][]string, error) {
+	key := bofDefinitionCacheKey(collectionSourceData.Name, commandSource.CommandName)
+	r.bofMutex.RLock()
+	entry, ok := r.bofImports[key]
+	r.bofMutex.RUnlock()
+	if ok {
+		return entry.imports, entry.err
+	}
+	imports, err := readBofImports(commandSource, collectionSourceData)
+	r.bofMutex.Lock()
+	r.bofImports[key] = bofImportsCacheEntry{imports: imports, err: err}
+	r.bofMutex.Unlock()
+	return imports, err
+}
+
+// invalidateBofDefinitions drops the cached extension.json and imports for a command after its files change on disk
+func (r *commandRegistry) invalidateBofDefinitions(collectionName string, commandName string) {
+	r.bofMutex.Lock()
+	delete(r.bofDefinitions, bofDefinitionCacheKey(collectionName, commandName))
+	delete(r.bofImports, bofDefinitionCacheKey(collectionName, commandName))
+	r.bofMutex.Unlock()
+}
+
+// writeForgeFile writes one of the collection json files and invalidates the registry so readers pick up the change
+func writeForgeFile(filename string, contents []byte, perm os.FileMode) error {
+	err := os.WriteFile(filename, contents, perm)
+	forgeRegistry.invalidate()
+	return err
+}
@@ -0,0 +1,161 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MythicMeta/MythicContainer/utils/sharedStructs"
+)
+
+const registryBenchmarkCommandCount = 1000
+
+func writeJSONFile(tb testing.TB, filename string, data interface{}) {
+	tb.Helper()
+	contents, err := json.Marshal(data)
+	if err != nil {
+		tb.Fatalf("failed to marshal %s: %v", filename, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		tb.Fatalf("failed to create folder for %s: %v", filename, err)
+	}
+	if err = os.WriteFile(filename, contents, 0644); err != nil {
+		tb.Fatalf("failed to write %s: %v", filename, err)
+	}
+}
+
+// setupRegistryFixture creates a bof collection with commandCount packages, all registered, in a temp working directory
+func setupRegistryFixture(tb testing.TB, commandCount int) {
+	tb.Chdir(tb.TempDir())
+	writeJSONFile(tb, CollectionSources, []collectionSource{{Name: "Bench", Type: "bof"}})
+	sources := make([]collectionSourceCommandData, commandCount)
+	registered := make([]bofCommand, commandCount)
+	for i := 0; i < commandCount; i++ {
+		commandName := fmt.Sprintf("bof-%d", i)
+		sources[i] = collectionSourceCommandData{Name: commandName, CommandName: commandName}
+		registered[i] = bofCommand{
+			CommandName:           BofPrefix + commandName,
+			CollectionType:        "Bench",
+			CollectionCommandName: commandName,
+		}
+		writeJSONFile(tb, filepath.Join(".", PayloadTypeName, "collections", "Bench", commandName, "extension.json"), bofCommandDefinition{
+			Name:        commandName,
+			CommandName: commandName,
+			Entrypoint:  "go",
+			Files:       []bofCommandDefinitionFiles{{OS: "windows", Arch: "amd64", Path: commandName + ".x64.o"}},
+			Arguments:   []bofCommandDefinitionArguments{{Name: "target", Type: "z"}},
+		})
+	}
+	writeJSONFile(tb, "Bench_sources.json", sources)
+	writeJSONFile(tb, "Bench_commands.json", registered)
+	forgeRegistry = newCommandRegistry()
+	tb.Cleanup(func() {
+		forgeRegistry = newCommandRegistry()
+	})
+}
+
+func TestRegistryIndexesSourcesAndRegisteredCommands(t *testing.T) {
+	setupRegistryFixture(t, 3)
+
+	source, err := getCollectionSource("Bench")
+	if err != nil {
+		t.Fatalf("expected collection to be found, got %v", err)
+	}
+	if source.SourceFilename != "Bench_sources.json" {
+		t.Fatalf("expected sources filename to be filled in, got %q", source.SourceFilename)
+	}
+	if _, ok := forgeRegistry.findSourceCommand("Bench", "bof-2"); !ok {
+		t.Fatalf("expected bof-2 to be indexed")
+	}
+	if len(forgeRegistry.getRegisteredCommands("Bench")) != 3 {
+		t.Fatalf("expected 3 registered commands")
+	}
+	if _, err = getCollectionSource("Missing"); err != collectionSourceNotFoundError {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestRegistryReloadsAfterWrite(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	if len(getCollectionSourceCommands(collectionSource{Name: "Bench"})) != 1 {
+		t.Fatalf("expected one source command before write")
+	}
+	contents, _ := json.Marshal([]collectionSourceCommandData{{Name: "a", CommandName: "a"}, {Name: "b", CommandName: "b"}})
+	if err := writeForgeFile("Bench_sources.json", contents, 0644); err != nil {
+		t.Fatalf("failed to write sources: %v", err)
+	}
+	if len(getCollectionSourceCommands(collectionSource{Name: "Bench"})) != 2 {
+		t.Fatalf("expected registry to reload source commands after write")
+	}
+}
+
+func TestRegistryCachesExtensionUntilInvalidated(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	extensionPath := filepath.Join(".", PayloadTypeName, "collections", "Bench", "bof-0", "extension.json")
+
+	names := getBofCommandNamesForSource(commandSource, source)
+	if len(names) != 1 || names[0] != BofPrefix+"bof-0" {
+		t.Fatalf("unexpected command names %v", names)
+	}
+	writeJSONFile(t, extensionPath, bofCommandDefinition{
+		PackageName: "bof-0",
+		Commands: []*bofCommandDefinition{
+			{CommandName: "bof-0-a"},
+			{CommandName: "bof-0-b"},
+		},
+	})
+	if names = getBofCommandNamesForSource(commandSource, source); len(names) != 1 {
+		t.Fatalf("expected cached definition to be used until invalidated, got %v", names)
+	}
+	forgeRegistry.invalidateBofDefinitions("Bench", "bof-0")
+	if names = getBofCommandNamesForSource(commandSource, source); len(names) != 2 {
+		t.Fatalf("expected reloaded definition after invalidation, got %v", names)
+	}
+}
+
+func BenchmarkRegistryLoad(b *testing.B) {
+	setupRegistryFixture(b, registryBenchmarkCommandCount)
+	b.ResetTimer()
+	for b.Loop() {
+		forgeRegistry.invalidate()
+		forgeRegistry.getCollectionSources()
+	}
+}
+
+func BenchmarkContainerStart(b *testing.B) {
+	setupRegistryFixture(b, registryBenchmarkCommandCount)
+	b.ResetTimer()
+	for b.Loop() {
+		forgeRegistry = newCommandRegistry()
+		payloadDefinition.OnContainerStartFunction(sharedStructs.ContainerOnStartMessage{})
+	}
+}
+
+func BenchmarkBofCommandNamesForSource(b *testing.B) {
+	setupRegistryFixture(b, registryBenchmarkCommandCount)
+	source, _ := getCollectionSource("Bench")
+	commandSources := getCollectionSourceCommands(source)
+	b.ResetTimer()
+	for b.Loop() {
+		for _, commandSource := range commandSources {
+			getBofCommandNamesForSource(commandSource, source)
+		}
+	}
+}
+
+func BenchmarkBofCommandNamesForSourceUncached(b *testing.B) {
+	setupRegistryFixture(b, registryBenchmarkCommandCount)
+	source, _ := getCollectionSource("Bench")
+	commandSources := getCollectionSourceCommands(source)
+	b.ResetTimer()
+	for b.Loop() {
+		for _, commandSource := range commandSources {
+			forgeRegistry.invalidateBofDefinitions(source.Name, commandSource.CommandName)
+			getBofCommandNamesForSource(commandSource, source)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package agentfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+// globalOperationID registers a command for every operation. Mythic operation IDs start at 1.
+const globalOperationID = 0
+
+var globalRegistrationError = errors.New("command is registered globally")
+var operationScopeError = errors.New("command is not registered for this operation")
+
+// taskOperationID returns the operation a task came from, or global when there's no task (ex: container start)
+func taskOperationID(taskData *agentstructs.PTTaskMessageAllData, global bool) int {
+	if taskData == nil || global {
+		return globalOperationID
+	}
+	return taskData.Callback.OperationID
+}
+
+// operationAllowed reports if a registration or command source with operationIDs is visible to operationID.
+// An empty list means the entry is global, which is how everything registered before scoping was added behaves.
+func operationAllowed(operationIDs []int, operationID int) bool {
+	return len(operationIDs) == 0 || slices.Contains(operationIDs, operationID)
+}
+
+// newOperationScope is the scope for an entry that's being registered for the first time
+func newOperationScope(operationID int) []int {
+	if operationID == globalOperationID {
+		return nil
+	}
+	return []int{operationID}
+}
+
+// scopeWithOperation adds operationID to an existing entry's scope, promoting it to global for globalOperationID
+func scopeWithOperation(operationIDs []int, operationID int) ([]int, bool) {
+	if len(operationIDs) == 0 {
+		return nil, false
+	}
+	if operationID == globalOperationID {
+		return nil, true
+	}
+	if slices.Contains(operationIDs, operationID) {
+		return operationIDs, false
+	}
+	return append(slices.Clone(operationIDs), operationID), true
+}
+
+// scopeWithoutOperation removes operationID from an existing entry's scope. removeEntry is true when no operations are
+// left or when the removal is global. Global entries can only be removed globally.
+func scopeWithoutOperation(operationIDs []int, operationID int) (remaining []int, removeEntry bool, err error) {
+	if operationID == globalOperationID {
+		return nil, true, nil
+	}
+	if len(operationIDs) == 0 {
+		return nil, false, globalRegistrationError
+	}
+	remaining = slices.DeleteFunc(slices.Clone(operationIDs), func(id int) bool {
+		return id == operationID
+	})
+	return remaining, len(remaining) == 0, nil
+}
+
+// checkOperationScope stops a forge command from being tasked in an operation it wasn't registered for
+func checkOperationScope(commandName string, taskData *agentstructs.PTTaskMessageAllData) error {
+	registeredCommand, ok := forgeRegistry.findRegisteredCommand(commandName)
+	if !ok {
+		return nil
+	}
+	if operationAllowed(registeredCommand.OperationIDs, taskData.Callback.OperationID) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s, use %s_register to add it to this operation", operationScopeError, commandName, PayloadTypeName)
+}
+
+// getCollectionSourceCommandsForOperation filters a collection's commands down to the ones an operation can see
+func getCollectionSourceCommandsForOperation(collectionSourceData collectionSource, operationID int) []collectionSourceCommandData {
+	commandSources := getCollectionSourceCommands(collectionSourceData)
+	return slices.DeleteFunc(commandSources, func(commandSource collectionSourceCommandData) bool {
+		return !operationAllowed(commandSource.OperationIDs, operationID)
+	})
+}
+
+// findSourceCommandForOperation looks up a collection's source entry, hiding entries that belong to other operations
+func findSourceCommandForOperation(collectionName string, name string, operationID int) (collectionSourceCommandData, bool) {
+	commandSource, ok := forgeRegistry.findSourceCommand(collectionName, name)
+	if !ok || !operationAllowed(commandSource.OperationIDs, operationID) {
+		return collectionSourceCommandData{}, false
+	}
+	return commandSource, true
+}
+
+func operationScopeText(operationID int) string {
+	if operationID == globalOperationID {
+		return "in every operation"
+	}
+	return "in this operation"
+}
+
+func unregisterErrorMessage(err error) string {
+	if errors.Is(err, globalRegistrationError) {
+		return fmt.Sprintf("%s; add -global to unregister it from every operation", err.Error())
+	}
+	return err.Error()
+}
+
+// promoteSourceCommand makes a command source that was created within one operation visible to all of them
+func promoteSourceCommand(commandSource collectionSourceCommandData, collectionSourceData collectionSource) error {
+	if len(commandSource.OperationIDs) == 0 {
+		return nil
+	}
+	commandSources := getCollectionSourceCommands(collectionSourceData)
+	for i := range commandSources {
+		if commandSources[i].Name == commandSource.Name {
+			commandSources[i].OperationIDs = nil
+		}
+	}
+	commandBytes, err := json.MarshalIndent(commandSources, "", "\t")
+	if err != nil {
+		logging.LogError(err, "failed to marshal command sources")
+		return err
+	}
+	return writeForgeFile(collectionSourceData.SourceFilename, commandBytes, os.ModePerm)
+}
@@ -0,0 +1,61 @@
+package agentfunctions
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+)
+
+func TestScopeWithAndWithoutOperation(t *testing.T) {
+	scope := newOperationScope(2)
+	if !operationAllowed(scope, 2) || operationAllowed(scope, 3) {
+		t.Fatalf("expected new scope to only allow operation 2, got %v", scope)
+	}
+	scope, changed := scopeWithOperation(scope, 3)
+	if !changed || !slices.Equal(scope, []int{2, 3}) {
+		t.Fatalf("expected operation 3 to be added, got %v", scope)
+	}
+	if global, changed := scopeWithOperation(scope, globalOperationID); !changed || global != nil {
+		t.Fatalf("expected global registration to clear the scope, got %v", global)
+	}
+	if global, changed := scopeWithOperation(nil, 4); changed || global != nil {
+		t.Fatalf("expected a global entry to stay global, got %v", global)
+	}
+
+	remaining, removeEntry, err := scopeWithoutOperation(scope, 2)
+	if err != nil || removeEntry || !slices.Equal(remaining, []int{3}) {
+		t.Fatalf("expected only operation 2 to be removed, got %v %v %v", remaining, removeEntry, err)
+	}
+	if _, removeEntry, _ = scopeWithoutOperation(remaining, 3); !removeEntry {
+		t.Fatalf("expected entry to be removed once no operations are left")
+	}
+	if _, _, err = scopeWithoutOperation(nil, 3); !errors.Is(err, globalRegistrationError) {
+		t.Fatalf("expected global entries to need a global removal, got %v", err)
+	}
+	if _, removeEntry, _ = scopeWithoutOperation(nil, globalOperationID); !removeEntry {
+		t.Fatalf("expected global removal to remove the entry")
+	}
+}
+
+func TestCheckOperationScope(t *testing.T) {
+	setupRegistryFixture(t, 2)
+	writeJSONFile(t, "Bench_commands.json", []bofCommand{
+		{CommandName: BofPrefix + "bof-0", CollectionType: "Bench", CollectionCommandName: "bof-0"},
+		{CommandName: BofPrefix + "bof-1", CollectionType: "Bench", CollectionCommandName: "bof-1", OperationIDs: []int{5}},
+	})
+	forgeRegistry.invalidate()
+	taskData := &agentstructs.PTTaskMessageAllData{}
+	taskData.Callback.OperationID = 7
+	if err := checkOperationScope(BofPrefix+"bof-0", taskData); err != nil {
+		t.Fatalf("expected registrations without operations to be global, got %v", err)
+	}
+	if err := checkOperationScope(BofPrefix+"bof-1", taskData); !errors.Is(err, operationScopeError) {
+		t.Fatalf("expected operation 7 to be blocked, got %v", err)
+	}
+	taskData.Callback.OperationID = 5
+	if err := checkOperationScope(BofPrefix+"bof-1", taskData); err != nil {
+		t.Fatalf("expected operation 5 to be allowed, got %v", err)
+	}
+}
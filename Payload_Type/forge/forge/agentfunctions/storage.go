@@ -0,0 +1,241 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MythicMeta/MythicContainer/logging"
+)
+
+// StorageKeyEnv holds a base64 or hex encoded 32 byte key, and StorageKeyFileEnv points at a file with the key in it
+// (ex: a docker or Mythic secret). When either is set, every file forge stores under ./forge/collections and the
+// http cache is encrypted with AES-256-GCM and only decrypted in memory when it's read.
+const StorageKeyEnv = "FORGE_STORAGE_KEY"
+const StorageKeyFileEnv = "FORGE_STORAGE_KEY_FILE"
+const storageKeySize = 32
+
+// storedFileMagic starts every encrypted file so plaintext files from before encryption was enabled can still be read
+var storedFileMagic = []byte("FORGEENC1\x00")
+
+var storageKeyMissingError = errors.New("file is encrypted but no storage key is configured")
+var invalidStorageKeyError = errors.New("storage key must be 32 bytes encoded as base64 or hex")
+
+func parseStorageKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if key, err := hex.DecodeString(value); err == nil && len(key) == storageKeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == storageKeySize {
+		return key, nil
+	}
+	return nil, invalidStorageKeyError
+}
+
+// getStorageKey returns nil when encryption isn't configured
+func getStorageKey() ([]byte, error) {
+	if value := os.Getenv(StorageKeyEnv); value != "" {
+		return parseStorageKey(value)
+	}
+	keyPath := os.Getenv(StorageKeyFileEnv)
+	if keyPath == "" {
+		return nil, nil
+	}
+	value, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage key file: %w", err)
+	}
+	return parseStorageKey(string(value))
+}
+
+func storageCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isEncryptedData(data []byte) bool {
+	return bytes.HasPrefix(data, storedFileMagic)
+}
+
+// sealStoredData encrypts contents when a storage key is configured, otherwise it returns them unchanged
+func sealStoredData(contents []byte) ([]byte, error) {
+	key, err := getStorageKey()
+	if err != nil || key == nil {
+		return contents, err
+	}
+	aead, err := storageCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append(bytes.Clone(storedFileMagic), nonce...)
+	return aead.Seal(sealed, nonce, contents, nil), nil
+}
+
+// openStoredData decrypts encrypted contents and passes plaintext through as is
+func openStoredData(data []byte) ([]byte, error) {
+	if !isEncryptedData(data) {
+		return data, nil
+	}
+	key, err := getStorageKey()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, storageKeyMissingError
+	}
+	aead, err := storageCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(storedFileMagic):]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file, was it encrypted with a different key? %w", err)
+	}
+	return plaintext, nil
+}
+
+// readStoredFile reads a tool file and decrypts it in memory if it was stored encrypted
+func readStoredFile(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openStoredData(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return plaintext, nil
+}
+
+// writeStoredFile writes a tool file, encrypting it first when a storage key is configured
+func writeStoredFile(filePath string, contents []byte, perm os.FileMode) error {
+	sealed, err := sealStoredData(contents)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, sealed, perm)
+}
+
+// copyToStoredFile is io.Copy for tool files. Encrypted files have to be sealed all at once, so the contents are
+// buffered in memory instead of streamed when a storage key is configured. It returns the number of plaintext bytes.
+func copyToStoredFile(destination io.Writer, source io.Reader) (int64, error) {
+	key, err := getStorageKey()
+	if err != nil {
+		return 0, err
+	}
+	if key == nil {
+		return io.Copy(destination, source)
+	}
+	contents, err := io.ReadAll(source)
+	if err != nil {
+		return int64(len(contents)), err
+	}
+	sealed, err := sealStoredData(contents)
+	if err != nil {
+		return 0, err
+	}
+	_, err = destination.Write(sealed)
+	return int64(len(contents)), err
+}
+
+// encryptStoredFile encrypts a plaintext file in place, returning false if it was already encrypted
+func encryptStoredFile(filePath string) (bool, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, err
+	}
+	if isEncryptedData(data) {
+		return false, nil
+	}
+	sealed, err := sealStoredData(data)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false, err
+	}
+	if err = writeFileAtomic(filePath, bytes.NewReader(sealed)); err != nil {
+		return false, err
+	}
+	return true, os.Chmod(filePath, info.Mode().Perm())
+}
+
+// encryptStoredFiles walks a folder and encrypts every plaintext file in it that ends with suffix
+func encryptStoredFiles(folder string, suffix string) (encrypted int, skipped int, err error) {
+	err = filepath.WalkDir(folder, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || !strings.HasSuffix(filePath, suffix) {
+			return nil
+		}
+		changed, err := encryptStoredFile(filePath)
+		if err != nil {
+			return err
+		}
+		if changed {
+			encrypted++
+		} else {
+			skipped++
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return encrypted, skipped, err
+}
+
+// EncryptCollections is the migration mode for `./main encrypt`, encrypting tool files that were stored before a
+// storage key was configured. It does nothing without a key so it's safe to run at every startup.
+func EncryptCollections(args []string) int {
+	flags := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+	collectionsPath := flags.String("path", filepath.Join(".", PayloadTypeName, "collections"), "folder of collections to encrypt")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	key, err := getStorageKey()
+	if err != nil {
+		logging.LogError(err, "invalid storage key")
+		return 1
+	}
+	if key == nil {
+		logging.LogInfo("[*] No storage key configured, leaving collections as they are", "env", StorageKeyEnv)
+		return 0
+	}
+	encrypted, skipped, err := encryptStoredFiles(*collectionsPath, "")
+	if err == nil {
+		// only cached response bodies are encrypted, the cache's json metadata files stay as they are
+		cacheEncrypted, cacheSkipped, cacheErr := encryptStoredFiles(httpCacheDirectory, ".body")
+		encrypted, skipped, err = encrypted+cacheEncrypted, skipped+cacheSkipped, cacheErr
+	}
+	if err != nil {
+		logging.LogError(err, "failed to encrypt stored files", "encrypted", encrypted)
+		return 1
+	}
+	logging.LogInfo("[*] Finished encrypting stored files", "encrypted", encrypted, "already_encrypted", skipped)
+	return 0
+}
@@ -0,0 +1,92 @@
+package agentfunctions
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testStorageKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestStoredFileEncryption(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("plain.exe", []byte("MZ plaintext"), 0644)
+	t.Setenv(StorageKeyEnv, testStorageKey)
+	if contents, err := readStoredFile("plain.exe"); err != nil || string(contents) != "MZ plaintext" {
+		t.Fatalf("expected plaintext files to be readable with a key set, got %q: %v", contents, err)
+	}
+	if err := writeStoredFile("sealed.exe", []byte("MZ secret"), 0644); err != nil {
+		t.Fatalf("failed to write stored file: %v", err)
+	}
+	onDisk, _ := os.ReadFile("sealed.exe")
+	if !isEncryptedData(onDisk) || bytes.Contains(onDisk, []byte("secret")) {
+		t.Fatalf("expected the file to be encrypted on disk, got %q", onDisk)
+	}
+	if contents, err := readStoredFile("sealed.exe"); err != nil || string(contents) != "MZ secret" {
+		t.Fatalf("failed to decrypt stored file, got %q: %v", contents, err)
+	}
+	if !assemblyFileVerified("sealed.exe") {
+		t.Fatalf("expected encrypted assemblies to still be verified as PE files")
+	}
+
+	t.Setenv(StorageKeyEnv, strings.Repeat("ff", storageKeySize))
+	if _, err := readStoredFile("sealed.exe"); err == nil {
+		t.Fatalf("expected decrypting with the wrong key to fail")
+	}
+	t.Setenv(StorageKeyEnv, "")
+	if _, err := readStoredFile("sealed.exe"); !errors.Is(err, storageKeyMissingError) {
+		t.Fatalf("expected a missing key error, got %v", err)
+	}
+	t.Setenv(StorageKeyEnv, "too short")
+	if err := writeStoredFile("sealed.exe", []byte("MZ"), 0644); !errors.Is(err, invalidStorageKeyError) {
+		t.Fatalf("expected an invalid key to fail instead of writing plaintext, got %v", err)
+	}
+}
+
+func TestEncryptCollectionsMigration(t *testing.T) {
+	setupRegistryFixture(t, 1)
+	source, _ := getCollectionSource("Bench")
+	commandSource, _ := forgeRegistry.findSourceCommand("Bench", "bof-0")
+	objectPath := filepath.Join(".", PayloadTypeName, "collections", "Bench", "bof-0", "bof-0.x64.o")
+	os.WriteFile(objectPath, []byte("object"), 0644)
+	before, _ := scanToolFiles(commandSource, source)
+	os.MkdirAll(httpCacheDirectory, 0755)
+	os.WriteFile(filepath.Join(httpCacheDirectory, "key.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(httpCacheDirectory, "key.body"), []byte("asset"), 0644)
+
+	if status := EncryptCollections(nil); status != 0 {
+		t.Fatalf("expected migration without a key to do nothing, got status %d", status)
+	}
+	if onDisk, _ := os.ReadFile(objectPath); isEncryptedData(onDisk) {
+		t.Fatalf("expected files to be left alone without a key")
+	}
+	t.Setenv(StorageKeyFileEnv, filepath.Join(t.TempDir(), "key"))
+	os.WriteFile(os.Getenv(StorageKeyFileEnv), []byte(testStorageKey+"\n"), 0600)
+	if status := EncryptCollections(nil); status != 0 {
+		t.Fatalf("migration failed with status %d", status)
+	}
+	for _, filePath := range []string{objectPath, filepath.Join(httpCacheDirectory, "key.body")} {
+		if onDisk, _ := os.ReadFile(filePath); !isEncryptedData(onDisk) {
+			t.Fatalf("expected %s to be encrypted", filePath)
+		}
+	}
+	if onDisk, _ := os.ReadFile(filepath.Join(httpCacheDirectory, "key.json")); string(onDisk) != "{}" {
+		t.Fatalf("expected http cache metadata to stay plaintext, got %q", onDisk)
+	}
+	if _, err := forgeRegistry.getBofCommandDefinitions(commandSource, source); err != nil {
+		t.Fatalf("expected encrypted extension.json files to still load: %v", err)
+	}
+	after, _ := scanToolFiles(commandSource, source)
+	if changes := diffQuarantineFiles(before, after); len(changes) != 0 {
+		t.Fatalf("expected hashes of encrypted files to match the plaintext, got %v", changes)
+	}
+	if status := EncryptCollections(nil); status != 0 {
+		t.Fatalf("expected running the migration again to succeed, got status %d", status)
+	}
+	if contents, err := readStoredFile(objectPath); err != nil || string(contents) != "object" {
+		t.Fatalf("expected files to only be encrypted once, got %q: %v", contents, err)
+	}
+}
@@ -0,0 +1,97 @@
+package agentfunctions
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+)
+
+var unknownContextVariableError = errors.New("unknown context variable")
+
+// contextVariablePattern matches placeholders like {{callback.user}} in argument strings
+var contextVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.]+)\s*\}\}`)
+
+// templateNow is when {{date}} and {{time}} are expanded, tests replace it
+var templateNow = time.Now
+
+// contextVariables are the values that can be used in forge command arguments, from the callback that's being tasked
+func contextVariables(taskData *agentstructs.PTTaskMessageAllData) map[string]string {
+	now := templateNow().UTC()
+	return map[string]string{
+		"callback.id":              strconv.Itoa(taskData.Callback.DisplayID),
+		"callback.user":            taskData.Callback.User,
+		"callback.domain":          taskData.Callback.Domain,
+		"callback.host":            taskData.Callback.Host,
+		"callback.pid":             strconv.Itoa(taskData.Callback.PID),
+		"callback.ip":              taskData.Callback.IP,
+		"callback.process_name":    taskData.Callback.ProcessName,
+		"callback.architecture":    taskData.Callback.Architecture,
+		"callback.integrity_level": strconv.Itoa(taskData.Callback.IntegrityLevel),
+		"callback.cwd":             taskData.Callback.Cwd,
+		"operation":                taskData.Callback.OperationName,
+		"operator":                 taskData.Task.OperatorUsername,
+		"date":                     now.Format("2006-01-02"),
+		"time":                     now.Format("150405"),
+	}
+}
+
+// expandContextVariables replaces {{name}} placeholders in an argument with values from the task's callback.
+// Unknown names fail instead of being passed through, since they're most likely typos.
+func expandContextVariables(taskData *agentstructs.PTTaskMessageAllData, input string) (string, error) {
+	if !strings.Contains(input, "{{") {
+		return input, nil
+	}
+	variables := contextVariables(taskData)
+	unknown := []string{}
+	expanded := contextVariablePattern.ReplaceAllStringFunc(input, func(placeholder string) string {
+		name := strings.ToLower(contextVariablePattern.FindStringSubmatch(placeholder)[1])
+		value, ok := variables[name]
+		if !ok {
+			unknown = append(unknown, placeholder)
+			return placeholder
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		names := []string{}
+		for name := range variables {
+			names = append(names, fmt.Sprintf("{{%s}}", name))
+		}
+		slices.Sort(names)
+		return input, fmt.Errorf("%w: %s, use one of %s", unknownContextVariableError, strings.Join(unknown, ", "), strings.Join(names, ", "))
+	}
+	return expanded, nil
+}
+
+// bofNumberArgument gets an int or short bof argument. It's a string when it was given with context variables, which
+// are expanded before it's converted.
+func bofNumberArgument(taskData *agentstructs.PTTaskMessageAllData, arg bofCommandDefinitionArguments) (int, error) {
+	value, err := taskData.Args.GetArg(arg.Name)
+	if err != nil {
+		return 0, err
+	}
+	text, ok := value.(string)
+	if !ok {
+		number, err := taskData.Args.GetNumberArg(arg.Name)
+		return int(number), err
+	}
+	text, err = expandContextVariables(taskData, text)
+	if err != nil {
+		return 0, err
+	}
+	converted, err := convertBofArgument(arg, strings.TrimSpace(text))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", bofUsageError, err.Error())
+	}
+	number, ok := converted.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s must be a number, got %q", bofUsageError, arg.Name, text)
+	}
+	return int(number), nil
+}
@@ -0,0 +1,89 @@
+package agentfunctions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+)
+
+func TestExpandContextVariables(t *testing.T) {
+	templateNow = func() time.Time {
+		return time.Date(2026, 10, 19, 8, 5, 9, 0, time.UTC)
+	}
+	t.Cleanup(func() {
+		templateNow = time.Now
+	})
+	taskData := &agentstructs.PTTaskMessageAllData{}
+	taskData.Callback.User = "svc_sql"
+	taskData.Callback.Domain = "CORP"
+	taskData.Callback.Host = "WS01"
+	taskData.Callback.PID = 4242
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"kerberoast /nowrap", "kerberoast /nowrap"},
+		{"/user:{{callback.domain}}\\{{callback.user}}", "/user:CORP\\svc_sql"},
+		{"/outfile:C:\\Windows\\Temp\\{{ callback.host }}_{{callback.pid}}_{{date}}.txt", "/outfile:C:\\Windows\\Temp\\WS01_4242_2026-10-19.txt"},
+		{"{{CALLBACK.HOST}}-{{time}}", "WS01-080509"},
+		{"{not a placeholder}", "{not a placeholder}"},
+	}
+	for _, test := range tests {
+		expanded, err := expandContextVariables(taskData, test.input)
+		if err != nil {
+			t.Fatalf("failed to expand %q: %v", test.input, err)
+		}
+		if expanded != test.expected {
+			t.Fatalf("expected %q, got %q", test.expected, expanded)
+		}
+	}
+	_, err := expandContextVariables(taskData, "{{callback.hostname}} {{callback.user}}")
+	if !errors.Is(err, unknownContextVariableError) || !strings.Contains(err.Error(), "{{callback.hostname}}") {
+		t.Fatalf("expected unknown variable error naming the placeholder, got %v", err)
+	}
+}
+
+func TestBofNumberArgument(t *testing.T) {
+	arguments := []bofCommandDefinitionArguments{
+		{Name: "pid", Type: "i"},
+		{Name: "flags", Type: "s"},
+	}
+	parameters := []agentstructs.CommandParameter{
+		{Name: "pid", ParameterType: agentstructs.COMMAND_PARAMETER_TYPE_NUMBER},
+		{Name: "flags", ParameterType: agentstructs.COMMAND_PARAMETER_TYPE_NUMBER},
+	}
+	taskData := &agentstructs.PTTaskMessageAllData{}
+	taskData.Callback.PID = 4242
+	args, err := agentstructs.GenerateArgsData(parameters, *taskData)
+	if err != nil {
+		t.Fatalf("failed to generate args: %v", err)
+	}
+	taskData.Args = args
+	values, err := parseBofArgString("forge_bof_test", arguments, "{{callback.pid}} 16")
+	if err != nil {
+		t.Fatalf("failed to parse args: %v", err)
+	}
+	if err = taskData.Args.LoadArgsFromDictionary(values); err != nil {
+		t.Fatalf("failed to load args: %v", err)
+	}
+	if pid, err := bofNumberArgument(taskData, arguments[0]); err != nil || pid != 4242 {
+		t.Fatalf("expected the callback's pid, got %d, %v", pid, err)
+	}
+	if flags, err := bofNumberArgument(taskData, arguments[1]); err != nil || flags != 16 {
+		t.Fatalf("expected 16, got %d, %v", flags, err)
+	}
+	for _, value := range []string{"{{callback.user}}", "{{callback.pid}}0"} {
+		taskData.Args.SetArgValue("flags", value)
+		taskData.Callback.User = "svc_sql"
+		if _, err = bofNumberArgument(taskData, arguments[1]); !errors.Is(err, bofUsageError) {
+			t.Fatalf("%s: expected a usage error, got %v", value, err)
+		}
+	}
+	taskData.Args.SetArgValue("pid", "{{callback.hostname}}")
+	if _, err = bofNumberArgument(taskData, arguments[0]); !errors.Is(err, unknownContextVariableError) {
+		t.Fatalf("expected unknown variable error, got %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+package agentfunctions
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	agentstructs "github.com/MythicMeta/MythicContainer/agent_structs"
+	"github.com/MythicMeta/MythicContainer/logging"
+	"github.com/MythicMeta/MythicContainer/mythicrpc"
+)
+
+// YaraResultsFilename stores the latest YARA matches for every scanned file
+const YaraResultsFilename = "forge_yara_results.json"
+
+const yaraRulesEnv = "FORGE_YARA_RULES"
+const yaraPathEnv = "FORGE_YARA_PATH"
+const defaultYaraRulesDirectory = "yara_rules"
+const defaultYaraPath = "yara"
+
+var yaraNoRulesError = errors.New("no YARA rules found")
+
+// yaraResultsMutex serializes reads and writes of the results file between concurrent tasks
+var yaraResultsMutex sync.Mutex
+
+// yaraFileResult is one scanned file. Version is the assembly version folder the file is in, and is empty for bofs.
+type yaraFileResult struct {
+	Path      string    `json:"path"`
+	Version   string    `json:"version,omitempty"`
+	SHA256    string    `json:"sha256"`
+	Matches   []string  `json:"matches"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+type yaraToolResults struct {
+	Collection string           `json:"collection"`
+	Name       string           `json:"name"`
+	Files      []yaraFileResult `json:"files"`
+}
+
+func getYaraRulesDirectory() string {
+	if directory := os.Getenv(yaraRulesEnv); directory != "" {
+		return directory
+	}
+	return defaultYaraRulesDirectory
+}
+
+// getYaraRuleFiles returns every .yar and .yara file in the rules directory. A missing directory just means no rules.
+func getYaraRuleFiles() ([]string, error) {
+	ruleFiles := []string{}
+	err := filepath.WalkDir(getYaraRulesDirectory(), func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".yar", ".yara":
+			if entry.Type().IsRegular() {
+				ruleFiles = append(ruleFiles, filePath)
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return ruleFiles, nil
+}
+
+// parseYaraOutput reads the "rule path" lines printed by the yara command line tool into the rules matched per path
+func parseYaraOutput(output []byte) map[string][]string {
+	matches := map[string][]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		rule, filePath, found := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !found || rule == "" || filePath == "" {
+			continue
+		}
+		filePath = filepath.Clean(filePath)
+		if !slices.Contains(matches[filePath], rule) {
+			matches[filePath] = append(matches[filePath], rule)
+		}
+	}
+	return matches
+}
+
+// decryptForYara returns the paths to scan for each file. Files that are stored encrypted are decrypted into anonymous
+// memory files that yara gets as extra file descriptors (/dev/fd/N), so a plaintext copy is never written to disk.
+// The returned files have to be passed to the yara process as ExtraFiles, in order, and closed when the scan is done.
+func decryptForYara(filePaths []string) ([]string, []*os.File, error) {
+	scanPaths := slices.Clone(filePaths)
+	memoryFiles := []*os.File{}
+	closeMemoryFiles := func() {
+		for _, memoryFile := range memoryFiles {
+			memoryFile.Close()
+		}
+	}
+	for i, filePath := range filePaths {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			closeMemoryFiles()
+			return nil, nil, err
+		}
+		if !isEncryptedData(data) {
+			continue
+		}
+		contents, err := openStoredData(data)
+		if err != nil {
+			closeMemoryFiles()
+			return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		memoryFile, err := newMemoryFile(filepath.Base(filePath), contents)
+		if err != nil {
+			closeMemoryFiles()
+			return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		// ExtraFiles start at descriptor 3 in the child process
+		scanPaths[i] = fmt.Sprintf("/dev/fd/%d", 3+len(memoryFiles))
+		memoryFiles = append(memoryFiles, memoryFile)
+	}
+	return scanPaths, memoryFiles, nil
+}
+
+// runYara scans files with the yara command line tool so rules are compiled once for the whole list of files.
+// Everything happens locally, nothing is sent anywhere.
+func runYara(ruleFiles []string, filePaths []string) (map[string][]string, error) {
+	if len(filePaths) == 0 {
+		return map[string][]string{}, nil
+	}
+	scanPaths, memoryFiles, err := decryptForYara(filePaths)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, memoryFile := range memoryFiles {
+			memoryFile.Close()
+		}
+	}()
+	scanList, err := os.CreateTemp("", "forge-yara-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(scanList.Name())
+	_, err = scanList.WriteString(strings.Join(scanPaths, "\n") + "\n")
+	if closeErr := scanList.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	yaraPath := os.Getenv(yaraPathEnv)
+	if yaraPath == "" {
+		yaraPath = defaultYaraPath
+	}
+	args := append([]string{"--no-warnings", "--scan-list"}, ruleFiles...)
+	cmd := exec.Command(yaraPath, append(args, scanList.Name())...)
+	cmd.ExtraFiles = memoryFiles
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w: %s", yaraPath, err, strings.TrimSpace(stderr.String()))
+	}
+	scanMatches := parseYaraOutput(output)
+	matches := map[string][]string{}
+	for i, scanPath := range scanPaths {
+		if fileMatches, ok := scanMatches[filepath.Clean(scanPath)]; ok {
+			matches[filepath.Clean(filePaths[i])] = fileMatches
+		}
+	}
+	return matches, nil
+}
+
+func readYaraResults() ([]yaraToolResults, error) {
+	results := []yaraToolResults{}
+	resultBytes, err := os.ReadFile(YaraResultsFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(resultBytes, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", YaraResultsFilename, err)
+	}
+	return results, nil
+}
+
+func writeYaraResults(results []yaraToolResults) error {
+	resultBytes, err := json.MarshalIndent(results, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(YaraResultsFilename, resultBytes, 0644)
+}
+
+// scanToolsWithYara scans every file on disk for the given tools, replacing their previous results
+func scanToolsWithYara(collectionSourceData collectionSource, commandSources []collectionSourceCommandData) ([]yaraToolResults, error) {
+	ruleFiles, err := getYaraRuleFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(ruleFiles) == 0 {
+		return nil, fmt.Errorf("%w in %s", yaraNoRulesError, getYaraRulesDirectory())
+	}
+	root := collectionFolder(collectionSourceData)
+	scanned := make([]yaraToolResults, 0, len(commandSources))
+	filePaths := []string{}
+	for _, commandSource := range commandSources {
+		files, err := scanToolFiles(commandSource, collectionSourceData)
+		if err != nil {
+			return nil, err
+		}
+		toolResults := yaraToolResults{Collection: collectionSourceData.Name, Name: commandSource.Name}
+		for _, file := range files {
+			fileResult := yaraFileResult{Path: file.Path, SHA256: file.SHA256, Matches: []string{}}
+			if collectionSourceData.Type == "assembly" {
+				fileResult.Version = strings.Split(file.Path, "/")[0]
+			}
+			toolResults.Files = append(toolResults.Files, fileResult)
+			filePaths = append(filePaths, filepath.Join(root, filepath.FromSlash(file.Path)))
+		}
+		scanned = append(scanned, toolResults)
+	}
+	matches, err := runYara(ruleFiles, filePaths)
+	if err != nil {
+		return nil, err
+	}
+	scannedAt := time.Now().UTC()
+	for i := range scanned {
+		for j := range scanned[i].Files {
+			if fileMatches, ok := matches[filepath.Join(root, filepath.FromSlash(scanned[i].Files[j].Path))]; ok {
+				scanned[i].Files[j].Matches = fileMatches
+			}
+			scanned[i].Files[j].ScannedAt = scannedAt
+		}
+	}
+	yaraResultsMutex.Lock()
+	defer yaraResultsMutex.Unlock()
+	results, err := readYaraResults()
+	if err != nil {
+		return nil, err
+	}
+	for _, toolResults := range scanned {
+		i := slices.IndexFunc(results, func(existing yaraToolResults) bool {
+			return existing.Collection == toolResults.Collection && existing.Name == toolResults.Name
+		})
+		if i >= 0 {
+			results[i] = toolResults
+		} else {
+			results = append(results, toolResults)
+		}
+	}
+	return scanned, writeYaraResults(results)
+}
+
+// matchedFiles filters a tool's results down to the files that matched at least one rule
+func (r yaraToolResults) matchedFiles() []yaraFileResult {
+	return slices.DeleteFunc(slices.Clone(r.Files), func(file yaraFileResult) bool {
+		return len(file.Matches) == 0
+	})
+}
+
+func (r yaraToolResults) report() string {
+	matched := r.matchedFiles()
+	if len(matched) == 0 {
+		return fmt.Sprintf("%s/%s: no YARA matches in %d files\n", r.Collection, r.Name, len(r.Files))
+	}
+	report := strings.Builder{}
+	report.WriteString(fmt.Sprintf("[!] %s/%s matched YARA rules:\n", r.Collection, r.Name))
+	for _, file := range matched {
+		report.WriteString(fmt.Sprintf("\t%s: %s\n", file.Path, strings.Join(file.Matches, ", ")))
+	}
+	return report.String()
+}
+
+// getYaraMatchedFiles returns the matching files for every scanned tool in a collection, keyed by the tool's name
+func getYaraMatchedFiles(collectionName string) map[string][]yaraFileResult {
+	yaraResultsMutex.Lock()
+	results, err := readYaraResults()
+	yaraResultsMutex.Unlock()
+	matched := map[string][]yaraFileResult{}
+	if err != nil {
+		logging.LogError(err, "failed to read YARA results")
+		return matched
+	}
+	for _, toolResults := range results {
+		if toolResults.Collection != collectionName {
+			continue
+		}
+		if files := toolResults.matchedFiles(); len(files) > 0 {
+			matched[toolResults.Name] = files
+		}
+	}
+	return matched
+}
+
+// getYaraMatches returns every rule matched by any of a tool's files, checking each name in order like getMitreMappings
+func getYaraMatches(collectionName string, names ...string) []string {
+	matchedFiles := getYaraMatchedFiles(collectionName)
+	for _, name := range names {
+		files, ok := matchedFiles[name]
+		if !ok {
+			continue
+		}
+		rules := []string{}
+		for _, file := range files {
+			for _, rule := range file.Matches {
+				if !slices.Contains(rules, rule) {
+					rules = append(rules, rule)
+				}
+			}
+		}
+		return rules
+	}
+	return nil
+}
+
+// scanDownloadedTool scans a freshly downloaded or uploaded tool when YARA rules are configured and adds any matches
+// to the task's output. Scanning problems are reported but don't fail the download.
+func scanDownloadedTool(taskData *agentstructs.PTTaskMessageAllData, commandSource collectionSourceCommandData, collectionSourceData collectionSource) {
+	scanned, err := scanToolsWithYara(collectionSourceData, []collectionSourceCommandData{commandSource})
+	output := ""
+	if errors.Is(err, yaraNoRulesError) {
+		return
+	} else if err != nil {
+		logging.LogError(err, "failed to scan tool with YARA", "collection", collectionSourceData.Name, "name", commandSource.Name)
+		output = fmt.Sprintf("[!] Failed to scan %s/%s with YARA: %s\n", collectionSourceData.Name, commandSource.Name, err.Error())
+	} else if len(scanned) > 0 && len(scanned[0].matchedFiles()) > 0 {
+		output = scanned[0].report()
+	}
+	if output == "" {
+		return
+	}
+	mythicrpc.SendMythicRPCResponseCreate(mythicrpc.MythicRPCResponseCreateMessage{
+		TaskID:   taskData.Task.ID,
+		Response: []byte(output),
+	})
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package agentfunctions
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// newMemoryFile puts contents in an anonymous memory backed file that only exists as an open file descriptor
+func newMemoryFile(name string, contents []byte) (*os.File, error) {
+	fd, err := unix.MemfdCreate("forge-yara-"+name, unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	memoryFile := os.NewFile(uintptr(fd), name)
+	if _, err = memoryFile.Write(contents); err != nil {
+		memoryFile.Close()
+		return nil, err
+	}
+	return memoryFile, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package agentfunctions
+
+import (
+	"errors"
+	"os"
+)
+
+// newMemoryFile needs memfd_create, so encrypted files can only be scanned in the linux container
+func newMemoryFile(name string, contents []byte) (*os.File, error) {
+	return nil, errors.New("scanning encrypted files is only supported on linux")
+}
@@ -0,0 +1,81 @@
+package agentfunctions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseYaraOutput(t *testing.T) {
+	matches := parseYaraOutput([]byte("Rubeus_Strings ./forge/collections/Sharp/4.7_Any/Rubeus.exe\n" +
+		"Kerberos_Tool forge/collections/Sharp/4.7_Any/Rubeus.exe\nRubeus_Strings forge/collections/Sharp/4.7_Any/Rubeus.exe\n\nwarning\n"))
+	if rules := matches[filepath.Join("forge", "collections", "Sharp", "4.7_Any", "Rubeus.exe")]; !slices.Equal(rules, []string{"Rubeus_Strings", "Kerberos_Tool"}) {
+		t.Fatalf("unexpected matches %v", matches)
+	}
+}
+
+func TestScanToolsWithYara(t *testing.T) {
+	setupRegistryFixture(t, 2)
+	source, _ := getCollectionSource("Bench")
+	commandSources := getCollectionSourceCommands(source)
+	if _, err := scanToolsWithYara(source, commandSources); !errors.Is(err, yaraNoRulesError) {
+		t.Fatalf("expected scanning without rules to fail, got %v", err)
+	}
+	os.Mkdir(defaultYaraRulesDirectory, 0755)
+	os.WriteFile(filepath.Join(defaultYaraRulesDirectory, "tools.yar"), []byte("rule Evil { condition: true }"), 0644)
+	// stands in for the yara command line tool by matching every listed file that contains "evil"
+	fakeYara := filepath.Join(t.TempDir(), "yara")
+	os.WriteFile(fakeYara, []byte("#!/bin/sh\nfor last; do :; done\nwhile read -r f; do grep -q evil \"$f\" && echo \"Evil $f\"; done < \"$last\"\nexit 0\n"), 0755)
+	t.Setenv(yaraPathEnv, fakeYara)
+	bofFolder := filepath.Join(".", PayloadTypeName, "collections", "Bench")
+	os.WriteFile(filepath.Join(bofFolder, "bof-0", "bof-0.x64.o"), []byte("evil object"), 0644)
+	os.WriteFile(filepath.Join(bofFolder, "bof-1", "bof-1.x64.o"), []byte("object"), 0644)
+
+	scanned, err := scanToolsWithYara(source, commandSources)
+	if err != nil {
+		t.Fatalf("failed to scan tools: %v", err)
+	}
+	if len(scanned) != 2 || len(scanned[0].matchedFiles()) != 1 || len(scanned[1].matchedFiles()) != 0 {
+		t.Fatalf("expected only bof-0's object file to match, got %+v", scanned)
+	}
+	if matches := getYaraMatches("Bench", "forge_bof_bof-0", "bof-0"); !slices.Equal(matches, []string{"Evil"}) {
+		t.Fatalf("expected stored matches for bof-0, got %v", matches)
+	}
+	matchedFiles := getYaraMatchedFiles("Bench")
+	if _, ok := matchedFiles["bof-1"]; ok || matchedFiles["bof-0"][0].Path != "bof-0/bof-0.x64.o" {
+		t.Fatalf("unexpected matched files %+v", matchedFiles)
+	}
+
+	policy := engagementPolicy{Rules: []engagementRule{{Name: "detected", Action: engagementActionWarn, YaraRules: []string{"*"}}}}
+	task := engagementTask{Collection: "Bench", YaraMatches: getYaraMatches("Bench", "bof-0")}
+	if decision := policy.evaluate(task); decision.Action != engagementActionWarn {
+		t.Fatalf("expected yara matches to trigger the rule, got %+v", decision)
+	}
+	task.YaraMatches = getYaraMatches("Bench", "bof-1")
+	if decision := policy.evaluate(task); decision.Action != engagementActionAllow {
+		t.Fatalf("expected tools without matches to be allowed, got %+v", decision)
+	}
+}
+
+func TestRunYaraOnEncryptedFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(StorageKeyEnv, testStorageKey)
+	if err := writeStoredFile("sealed.o", []byte("evil object"), 0644); err != nil {
+		t.Fatalf("failed to write stored file: %v", err)
+	}
+	os.WriteFile("plain.o", []byte("evil object"), 0644)
+	// matches every listed file that contains "evil", and fails if it's handed a decrypted copy on disk
+	fakeYara := filepath.Join(t.TempDir(), "yara")
+	os.WriteFile(fakeYara, []byte("#!/bin/sh\nfor last; do :; done\nwhile read -r f; do case \"$f\" in /dev/fd/*|plain.o) ;; *) exit 1;; esac; "+
+		"grep -q evil \"$f\" && echo \"Evil $f\"; done < \"$last\"\nexit 0\n"), 0755)
+	t.Setenv(yaraPathEnv, fakeYara)
+	matches, err := runYara([]string{"rules.yar"}, []string{"sealed.o", "plain.o"})
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	if !slices.Equal(matches["sealed.o"], []string{"Evil"}) || !slices.Equal(matches["plain.o"], []string{"Evil"}) {
+		t.Fatalf("expected both files to match, got %v", matches)
+	}
+}
@@ -12,10 +12,15 @@ function(task, responses){
             {"plaintext": "Reg", "type": "button", "width": 50, "disableSort": true},
             {"plaintext": "Name", "type": "string", "fillWidth": true},
             {"plaintext": "Command", "type": "string", "fillWidth": true},
+            {"plaintext": "YARA", "type": "string", "width": 80},
+            {"plaintext": "Agents", "type": "string", "width": 100},
             {"plaintext": "Description", "type": "string", "fillWidth": true}
         ];
         let rows = [];
         for(let i = 0; i < collection.length; i++){
+            let yaraMatches = collection[i]["yara_matches"] || [];
+            let compatibility = collection[i]["bof_compatibility"] || [];
+            let missingAgents = compatibility.filter(agent => agent["status"] === "missing");
             rows.push({
                 "DL": {"button":{
                         "name": "",
@@ -38,6 +43,18 @@ function(task, responses){
                     }},
                 "Name": {"plaintext": collection[i]["name"]},
                 "Command": {"plaintext": collection[i]["command_name"]},
+                "YARA": yaraMatches.length > 0 ? {
+                    "plaintext": String(yaraMatches.length),
+                    "startIcon": "warning",
+                    "startIconColor": "error",
+                    "startIconHoverText": yaraMatches.map(file => file["path"] + ": " + file["matches"].join(", ")).join("\n")
+                } : {"plaintext": ""},
+                "Agents": compatibility.length > 0 ? {
+                    "plaintext": String(compatibility.length - missingAgents.length) + "/" + String(compatibility.length),
+                    "startIcon": missingAgents.length > 0 ? "warning" : "check",
+                    "startIconColor": missingAgents.length > 0 ? "warning" : "success",
+                    "startIconHoverText": compatibility.map(agent => agent["agent"] + ": " + (agent["status"] === "missing" ? "missing " + agent["missing"].join(", ") : agent["status"])).join("\n")
+                } : {"plaintext": ""},
                 "Description": {"plaintext": collection[i]["description"]}
             });
         }
@@ -4,7 +4,11 @@ go 1.25.1
 
 //replace github.com/MythicMeta/MythicContainer => ../../../../MythicMeta/MythicContainer
 
-require github.com/MythicMeta/MythicContainer v1.6.4
+require (
+	github.com/MythicMeta/MythicContainer v1.6.4
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/sys v0.43.0
+)
 
 require (
 	github.com/fsnotify/fsnotify v1.10.1 // indirect
@@ -24,7 +28,6 @@ require (
 	github.com/subosito/gotenv v1.6.0 // indirect
 	go.yaml.in/yaml/v3 v3.0.4 // indirect
 	golang.org/x/net v0.53.0 // indirect
-	golang.org/x/sys v0.43.0 // indirect
 	golang.org/x/text v0.36.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20260504160031-60b97b32f348 // indirect
 	google.golang.org/grpc v1.81.0 // indirect
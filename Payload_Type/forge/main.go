@@ -8,12 +8,22 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "download" {
+		// the console logger writes to whatever os.Stdout is when it's created, so point it at stderr to keep a
+		// -summary - report on stdout machine-readable
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		logging.UpdateLogToStdout("debug")
+		os.Stdout = stdout
+	}
 	agentfunctions.Initialize()
 	if len(os.Args) > 1 {
 		if os.Args[1] == "download" {
+			os.Exit(agentfunctions.DownloadEverything(os.Args[2:]))
+		}
+		if os.Args[1] == "encrypt" {
 			logging.UpdateLogToStdout("debug")
-			agentfunctions.DownloadEverything()
-			return
+			os.Exit(agentfunctions.EncryptCollections(os.Args[2:]))
 		}
 	}
 	MythicContainer.StartAndRunForever([]MythicContainer.MythicServices{